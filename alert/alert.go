@@ -0,0 +1,186 @@
+// Package alert 在死信桶收到不可恢复的死信时通知管理员。
+//
+// 死信按窗口汇总：窗口内收到的第一条死信开始计时，窗口结束时所有死信合并为一条告警，
+// 通过 Register 注册的渠道（例如邮件、Webhook）发送。告警由渠道直接发送，不经过消息队列，
+// 因此告警本身不会再产生死信；Notify 会等待告警发送完成，调用方据此决定是否确认死信。
+package alert
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Item 一条死信
+type Item struct {
+	Time       time.Time              `json:"time"`
+	Queue      string                 `json:"queue,omitempty"`       // 消息最初所在的队列
+	ErrorClass string                 `json:"error_class,omitempty"` // 最后一次失败的错误类别
+	Attempts   int                    `json:"attempts,omitempty"`    // 处理失败的次数
+	Error      string                 `json:"error,omitempty"`       // 最后一次失败的错误信息
+	Header     map[string]interface{} `json:"header"`                // 原消息头
+	Body       string                 `json:"body"`                  // 原消息体
+}
+
+// Summary 一个窗口内的死信汇总
+type Summary struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Total int       `json:"total"` // 窗口内的死信总数
+	Items []*Item   `json:"items"` // 死信详情，最多 alert.max_items 条
+}
+
+// Omitted 返回只计数、未展示详情的死信数量
+func (s *Summary) Omitted() int {
+	return s.Total - len(s.Items)
+}
+
+// Channel 告警渠道
+type Channel interface {
+	Send(ctx context.Context, s *Summary) error
+}
+
+var channels = map[string]Channel{}
+
+// Register 注册告警渠道，重复注册同名渠道会 panic
+func Register(name string, c Channel) {
+	if _, ok := channels[name]; ok {
+		panic("alert: 重复注册告警渠道 " + name)
+	}
+	channels[name] = c
+}
+
+func init() {
+	config.RegisterCallback(func() {
+		c := config.Alert()
+		if !c.Enabled() {
+			return
+		}
+		defer zap.L().Sync()
+		for _, name := range c.Channels() {
+			if _, ok := channels[name]; !ok {
+				zap.L().Fatal("未知的告警渠道", zap.String("channel", name))
+			}
+		}
+		zap.L().Info("已启用死信告警。", zap.Strings("channels", c.Channels()), zap.Duration("window", c.Window()))
+	})
+}
+
+// sendTimeout 窗口结束时发送告警的超时时间
+const sendTimeout = time.Minute
+
+// batch 一个窗口内的死信及其发送结果
+type batch struct {
+	summary *Summary
+	timer   *time.Timer
+	done    chan struct{} // 告警发送后关闭
+	err     error         // 所有渠道均发送失败时的错误，done 关闭后可读
+}
+
+// aggregator 汇总一个窗口内的死信
+type aggregator struct {
+	mu      sync.Mutex
+	pending *batch
+	send    func(ctx context.Context, s *Summary) error
+}
+
+var agg = &aggregator{send: send}
+
+// Notify 记录一条死信并等待所在窗口的告警发送完成，未启用告警时直接返回 nil。
+// 调用方应在 Notify 返回 nil 后才确认死信，这样进程在窗口结束前退出时，死信会重新投递而不会丢失告警；
+// 所有渠道均发送失败或 ctx 结束时返回错误
+func Notify(ctx context.Context, item *Item) error {
+	c := config.Alert()
+	if !c.Enabled() {
+		return nil
+	}
+	b := agg.add(item, c.Window(), c.MaxItems())
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush 立即发送当前窗口内的告警，用于进程退出前
+func Flush(ctx context.Context) {
+	agg.flush(ctx)
+}
+
+func (a *aggregator) add(item *Item, window time.Duration, maxItems int) *batch {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if item.Time.IsZero() {
+		item.Time = time.Now()
+	}
+	if a.pending == nil {
+		a.pending = &batch{summary: &Summary{Start: item.Time}, done: make(chan struct{})}
+		a.pending.timer = time.AfterFunc(window, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+			a.flush(ctx)
+		})
+	}
+	s := a.pending.summary
+	s.Total++
+	if len(s.Items) < maxItems {
+		s.Items = append(s.Items, item)
+	}
+	return a.pending
+}
+
+// take 取出当前窗口并开始新的窗口
+func (a *aggregator) take() *batch {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.pending
+	a.pending = nil
+	if b != nil {
+		b.timer.Stop()
+	}
+	return b
+}
+
+func (a *aggregator) flush(ctx context.Context) {
+	b := a.take()
+	if b == nil {
+		return
+	}
+	b.summary.End = time.Now()
+	b.err = a.send(ctx, b.summary)
+	close(b.done)
+}
+
+// send 通过所有已配置的渠道发送告警，只要有一个渠道发送成功即视为成功，全部失败时返回错误
+func send(ctx context.Context, s *Summary) error {
+	defer zap.L().Sync()
+	var errs error
+	sent := false
+	for _, name := range config.Alert().Channels() {
+		c, ok := channels[name]
+		if !ok {
+			zap.L().Error("[alert] 未知的告警渠道", zap.String("channel", name))
+			errs = errors.CombineErrors(errs, errors.Newf("未知的告警渠道：%s", name))
+			continue
+		}
+		if err := c.Send(ctx, s); err != nil {
+			zap.L().Error("[alert] 无法发送死信告警",
+				zap.String("channel", name),
+				zap.Int("total", s.Total),
+				zap.Error(err),
+			)
+			errs = errors.CombineErrors(errs, errors.Wrapf(err, "告警渠道 %s", name))
+			continue
+		}
+		sent = true
+		zap.L().Info("[alert] 已发送死信告警", zap.String("channel", name), zap.Int("total", s.Total))
+	}
+	if sent {
+		return nil
+	}
+	return errors.Wrap(errs, "无法发送死信告警")
+}
@@ -0,0 +1,144 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregatorWindow(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		summary []*Summary
+	)
+	a := &aggregator{send: func(_ context.Context, s *Summary) error {
+		mu.Lock()
+		defer mu.Unlock()
+		summary = append(summary, s)
+		return nil
+	}}
+	for i := 0; i < 3; i++ {
+		a.add(&Item{Queue: "hitokoto_appended"}, 20*time.Millisecond, 2)
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(summary) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	s := summary[0]
+	assert.Equal(t, 3, s.Total)
+	assert.Len(t, s.Items, 2)
+	assert.Equal(t, 1, s.Omitted())
+	assert.False(t, s.End.Before(s.Start))
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	var sent []*Summary
+	a := &aggregator{send: func(_ context.Context, s *Summary) error {
+		sent = append(sent, s)
+		return nil
+	}}
+	a.flush(context.Background())
+	assert.Empty(t, sent, "没有死信时不应发送告警")
+
+	b := a.add(&Item{}, time.Hour, 10)
+	a.flush(context.Background())
+	require.Len(t, sent, 1)
+	assert.Equal(t, 1, sent[0].Total)
+	assert.Nil(t, a.pending)
+	select {
+	case <-b.done:
+	default:
+		t.Fatal("发送后应通知等待的调用方")
+	}
+
+	a.add(&Item{}, time.Hour, 10)
+	a.flush(context.Background())
+	assert.Len(t, sent, 2, "发送后应开始新的窗口")
+}
+
+func TestNotifyWaitsForSend(t *testing.T) {
+	viper.Set("alert.enabled", true)
+	viper.Set("alert.window", time.Hour)
+	defer viper.Set("alert.enabled", nil)
+	defer viper.Set("alert.window", nil)
+	failed := errors.New("告警渠道不可用")
+	old := agg
+	defer func() { agg = old }()
+	agg = &aggregator{send: func(context.Context, *Summary) error { return failed }}
+
+	result := make(chan error, 1)
+	go func() { result <- Notify(context.Background(), &Item{}) }()
+	select {
+	case <-result:
+		t.Fatal("窗口结束前不应返回")
+	case <-time.After(20 * time.Millisecond):
+	}
+	Flush(context.Background())
+	assert.ErrorIs(t, <-result, failed, "发送失败时应返回错误，死信不应被确认")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Notify(ctx, &Item{}), context.Canceled)
+	Flush(context.Background())
+}
+
+func TestMailTemplate(t *testing.T) {
+	s := &Summary{
+		Start: time.Now(),
+		End:   time.Now(),
+		Total: 2,
+		Items: []*Item{{
+			Queue:      "hitokoto_reviewed",
+			ErrorClass: "permanent",
+			Error:      "解析消息失败",
+			Header:     map[string]interface{}{"x-route": "dead_letter"},
+			Body:       `{"to":"<user@example.com>"}`,
+		}},
+	}
+	var out bytes.Buffer
+	require.NoError(t, mailTemplate.Execute(&out, s))
+	html := out.String()
+	assert.Contains(t, html, "共收到 2 条死信，以下仅展示前 1 条")
+	assert.Contains(t, html, "hitokoto_reviewed")
+	assert.Contains(t, html, "&#34;x-route&#34;: &#34;dead_letter&#34;")
+	assert.Contains(t, html, "&lt;user@example.com&gt;")
+}
+
+func TestWebhookChannel(t *testing.T) {
+	var received Summary
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer srv.Close()
+	viper.Set("alert.webhook.url", srv.URL)
+	defer viper.Set("alert.webhook.url", nil)
+
+	s := &Summary{Total: 1, Items: []*Item{{Queue: "hitokoto_moved", Body: "{}"}}}
+	require.NoError(t, (&webhookChannel{}).Send(context.Background(), s))
+	assert.Equal(t, 1, received.Total)
+	require.Len(t, received.Items, 1)
+	assert.Equal(t, "hitokoto_moved", received.Items[0].Queue)
+}
+
+func TestWebhookChannelStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	viper.Set("alert.webhook.url", srv.URL)
+	defer viper.Set("alert.webhook.url", nil)
+
+	assert.Error(t, (&webhookChannel{}).Send(context.Background(), &Summary{}))
+}
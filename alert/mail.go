@@ -0,0 +1,77 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"html/template"
+	"time"
+)
+
+func init() {
+	Register("mail", &mailChannel{})
+}
+
+// mailChannel 通过邮件驱动将告警发送给 alert.mail.to 中的管理员
+type mailChannel struct{}
+
+var mailTemplate = template.Must(template.New("alert").Funcs(template.FuncMap{
+	"time":   func(t time.Time) string { return t.Local().Format(time.DateTime) },
+	"pretty": pretty,
+}).Parse(`<h1>一言通知服务：出现不可恢复的死信</h1>
+<p>{{time .Start}} 至 {{time .End}} 共收到 {{.Total}} 条死信{{if .Omitted}}，以下仅展示前 {{len .Items}} 条{{end}}。</p>
+{{range $v := .Items}}<hr>
+<h3>{{or $v.Queue "未知队列"}}</h3>
+<ul>
+<li>时间：{{time $v.Time}}</li>
+{{if $v.ErrorClass}}<li>错误类别：{{$v.ErrorClass}}</li>{{end}}
+{{if $v.Attempts}}<li>失败次数：{{$v.Attempts}}</li>{{end}}
+{{if $v.Error}}<li>错误信息：{{$v.Error}}</li>{{end}}
+</ul>
+<p>消息头：</p>
+<pre><code>{{pretty $v.Header}}</code></pre>
+<p>消息体：</p>
+<pre><code>{{pretty $v.Body}}</code></pre>
+{{end}}`))
+
+// pretty 将消息头或 JSON 格式的消息体格式化为缩进的 JSON，其余内容原样返回
+func pretty(v interface{}) string {
+	if s, ok := v.(string); ok {
+		var out bytes.Buffer
+		if json.Indent(&out, []byte(s), "", "  ") != nil {
+			return s
+		}
+		return out.String()
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(data)
+}
+
+func (t *mailChannel) Send(ctx context.Context, s *Summary) error {
+	c := config.Alert()
+	if len(c.MailTo()) == 0 {
+		return errors.New("未设置 alert.mail.to")
+	}
+	var body bytes.Buffer
+	if err := mailTemplate.Execute(&body, s); err != nil {
+		return errors.Wrap(err, "无法渲染告警邮件")
+	}
+	_, err := mail.SendSingle(ctx, &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      c.MailTo(),
+			Subject: fmt.Sprintf("%s（%d 条）", c.MailSubject(), s.Total),
+			Body:    body.String(),
+		},
+		Meta: mailer.Meta{Kind: "dead_letter_alert"},
+	})
+	return err
+}
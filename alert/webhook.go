@@ -0,0 +1,46 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"io"
+	"net/http"
+)
+
+func init() {
+	Register("webhook", &webhookChannel{})
+}
+
+// webhookChannel 将告警汇总以 JSON 格式 POST 到 alert.webhook.url
+type webhookChannel struct{}
+
+func (t *webhookChannel) Send(ctx context.Context, s *Summary) error {
+	c := config.Alert()
+	if c.WebhookURL() == "" {
+		return errors.New("未设置 alert.webhook.url")
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return errors.Wrap(err, "无法编码告警")
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.WebhookTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.WebhookURL(), bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "无效的告警回调地址")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "无法请求告警回调地址")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Newf("告警回调地址返回 %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Package cli 提供管理用的子命令，例如 `notification-worker suppression list`。
+// 子命令由各功能包在 init 中注册，与 worker 共用同一份配置。
+package cli
+
+import (
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"os"
+	"sort"
+	"time"
+)
+
+type Command struct {
+	Name  string
+	Usage string // 一行说明
+	Run   func(args []string) error
+}
+
+var commands = map[string]*Command{}
+
+// Register 注册子命令，重复注册同名命令会 panic
+func Register(c *Command) {
+	if _, ok := commands[c.Name]; ok {
+		panic("cli: 重复注册子命令 " + c.Name)
+	}
+	commands[c.Name] = c
+}
+
+// Run 执行 args[0] 对应的子命令，返回进程退出码
+func Run(args []string) int {
+	if len(args) == 0 {
+		PrintUsage()
+		return 2
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知的子命令：%s\n", args[0])
+		PrintUsage()
+		return 2
+	}
+	if err := c.Run(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", c.Name, err)
+		return 1
+	}
+	return 0
+}
+
+// PrintUsage 输出所有子命令的说明
+func PrintUsage() {
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "可用的子命令：")
+	for _, k := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", k, commands[k].Usage)
+	}
+}
+
+// ParseTime 解析日期、日期时间或相对于现在的时长，空字符串返回零值
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.DateTime, time.DateOnly, time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Newf("无法解析时间：%s", s)
+}
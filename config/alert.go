@@ -0,0 +1,68 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("alert.enabled", false)
+	viper.SetDefault("alert.channels", []string{"mail"})
+	viper.SetDefault("alert.window", 5*time.Minute)
+	viper.SetDefault("alert.max_items", 20)
+	viper.SetDefault("alert.mail.to", []string{})
+	viper.SetDefault("alert.mail.subject", "[一言告警] 出现不可恢复的死信")
+	viper.SetDefault("alert.webhook.url", "")
+	viper.SetDefault("alert.webhook.timeout", 10*time.Second)
+}
+
+type SAlert struct {
+}
+
+var alert *SAlert
+
+// Alert 返回死信告警相关配置
+func Alert() *SAlert {
+	if alert == nil {
+		alert = &SAlert{}
+	}
+	return alert
+}
+
+// Enabled 返回是否在收到不可恢复的死信时通知管理员
+func (t *SAlert) Enabled() bool {
+	return viper.GetBool("alert.enabled")
+}
+
+// Channels 返回告警渠道，可用渠道：mail、webhook
+func (t *SAlert) Channels() []string {
+	return viper.GetStringSlice("alert.channels")
+}
+
+// Window 返回告警的汇总窗口，窗口内的死信合并为一条告警。告警发送前死信不会被确认，窗口不应超过消息处理的超时时间（1 小时）
+func (t *SAlert) Window() time.Duration {
+	return viper.GetDuration("alert.window")
+}
+
+// MaxItems 返回一条告警中展示详情的死信数量上限，超出部分只计数
+func (t *SAlert) MaxItems() int {
+	return viper.GetInt("alert.max_items")
+}
+
+// MailTo 返回接收告警邮件的管理员地址
+func (t *SAlert) MailTo() []string {
+	return viper.GetStringSlice("alert.mail.to")
+}
+
+func (t *SAlert) MailSubject() string {
+	return viper.GetString("alert.mail.subject")
+}
+
+// WebhookURL 返回告警回调地址，告警以 JSON 格式 POST 到该地址
+func (t *SAlert) WebhookURL() string {
+	return viper.GetString("alert.webhook.url")
+}
+
+func (t *SAlert) WebhookTimeout() time.Duration {
+	return viper.GetDuration("alert.webhook.timeout")
+}
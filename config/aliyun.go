@@ -1,6 +1,9 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"github.com/spf13/viper"
+	"time"
+)
 
 func init() {
 	viper.SetDefault("aliyun.region_id", "cn-hangzhou")
@@ -9,6 +12,10 @@ func init() {
 	viper.SetDefault("aliyun.dm.name", "一言网")
 	viper.SetDefault("aliyun.dm.mail", "notification@mail.hitokoto.cn")
 	viper.SetDefault("aliyun.dm.endpoint", "dm.aliyuncs.com")
+	viper.SetDefault("aliyun.dm.timeout", 10*time.Second)
+	viper.SetDefault("aliyun.dm.retry.max_attempts", 3)
+	viper.SetDefault("aliyun.dm.retry.backoff", time.Second)
+	viper.SetDefault("aliyun.dm.retry.max_backoff", 10*time.Second)
 }
 
 type SAliyun struct {
@@ -82,3 +89,23 @@ func (t *dm) Name() string {
 func (t *dm) Mail() string {
 	return viper.GetString("aliyun.dm.mail")
 }
+
+// Timeout 单次请求的超时时间，实际超时不会超过调用方上下文的剩余时间
+func (t *dm) Timeout() time.Duration {
+	return viper.GetDuration("aliyun.dm.timeout")
+}
+
+// RetryMaxAttempts 暂时性错误（限流、5xx、网络错误）的最大尝试次数，包括第一次请求
+func (t *dm) RetryMaxAttempts() int {
+	return viper.GetInt("aliyun.dm.retry.max_attempts")
+}
+
+// RetryBackoff 第一次重试前的等待时间，之后每次翻倍
+func (t *dm) RetryBackoff() time.Duration {
+	return viper.GetDuration("aliyun.dm.retry.backoff")
+}
+
+// RetryMaxBackoff 重试等待时间的上限
+func (t *dm) RetryMaxBackoff() time.Duration {
+	return viper.GetDuration("aliyun.dm.retry.max_backoff")
+}
@@ -4,6 +4,7 @@ import (
 	"flag"
 	"github.com/hitokoto-osc/notification-worker/mail/driver"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 )
 
 var (
@@ -29,6 +30,14 @@ func Debug() bool {
 	return debug
 }
 
+// MailDriver 返回当前使用的邮件驱动，配置中可以填写驱动名称（如 smtp、aliyun）
 func MailDriver() driver.Type {
-	return viper.Get("mail.driver").(driver.Type)
+	if t, ok := viper.Get("mail.driver").(driver.Type); ok {
+		return t
+	}
+	t, err := driver.ParseType(viper.GetString("mail.driver"))
+	if err != nil {
+		zap.L().Fatal("无法解析邮件驱动配置", zap.Error(err))
+	}
+	return t
 }
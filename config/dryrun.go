@@ -0,0 +1,51 @@
+package config
+
+import (
+	"flag"
+	"github.com/spf13/viper"
+	"time"
+)
+
+var dryRun bool
+
+func init() {
+	flag.BoolVar(&dryRun, "dry-run", false, "演练模式：照常消费与渲染邮件，但不调用邮件驱动发送")
+	viper.SetDefault("dry_run.enabled", false)
+	viper.SetDefault("dry_run.output", "log")
+	viper.SetDefault("dry_run.requeue", false)
+	viper.SetDefault("dry_run.requeue_delay", 30*time.Second)
+}
+
+type SDryRun struct {
+}
+
+var dryRunConfig *SDryRun
+
+// DryRun 返回演练模式相关配置
+func DryRun() *SDryRun {
+	if dryRunConfig == nil {
+		dryRunConfig = &SDryRun{}
+	}
+	return dryRunConfig
+}
+
+// Enabled 返回是否启用演练模式，命令行参数 -dry-run 与配置 dry_run.enabled 任一开启即生效
+func (t *SDryRun) Enabled() bool {
+	return dryRun || viper.GetBool("dry_run.enabled")
+}
+
+// Output 返回渲染结果的去向：log 只记录主题与大小；outbox 写入 outbox 目录
+func (t *SDryRun) Output() string {
+	return viper.GetString("dry_run.output")
+}
+
+// Requeue 返回处理完成后是否将消息放回队列（nack requeue），为 false 时正常确认消息
+func (t *SDryRun) Requeue() bool {
+	return viper.GetBool("dry_run.requeue")
+}
+
+// RequeueDelay 返回放回队列前持有消息的时间，避免消息在只有演练 worker 时被立即反复投递。
+// 放回队列模式下必须大于 0
+func (t *SDryRun) RequeueDelay() time.Duration {
+	return viper.GetDuration("dry_run.requeue_delay")
+}
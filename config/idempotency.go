@@ -0,0 +1,41 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("idempotency.enabled", true)
+	viper.SetDefault("idempotency.window", 24*time.Hour)
+	viper.SetDefault("idempotency.lease", 10*time.Minute)
+}
+
+type SIdempotency struct {
+}
+
+var idempotency *SIdempotency
+
+// Idempotency 返回消息去重相关配置
+func Idempotency() *SIdempotency {
+	if idempotency == nil {
+		idempotency = &SIdempotency{}
+	}
+	return idempotency
+}
+
+// Enabled 返回是否跳过已经成功处理过的重复消息
+func (t *SIdempotency) Enabled() bool {
+	return viper.GetBool("idempotency.enabled")
+}
+
+// Window 返回已处理消息的记录保留时间，超过该时间重复投递的消息会再次处理
+func (t *SIdempotency) Window() time.Duration {
+	return viper.GetDuration("idempotency.window")
+}
+
+// Lease 返回处理中记录的有效期。进程在处理期间退出时，重新投递的消息需等待该时间后才会再次处理。
+// 去重只保证至少一次：进程在发送邮件后、记录已处理前退出时，消息会在该时间后再次处理，收件人可能收到重复的邮件
+func (t *SIdempotency) Lease() time.Duration {
+	return viper.GetDuration("idempotency.lease")
+}
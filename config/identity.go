@@ -0,0 +1,50 @@
+package config
+
+import "github.com/spf13/viper"
+
+func init() {
+	viper.SetDefault("mail.identities.default.from", "")
+	viper.SetDefault("mail.identities.default.name", "")
+	viper.SetDefault("mail.identities.default.reply_to", "")
+	viper.SetDefault("mail.identities.default.tag", "")
+}
+
+// SMailIdentity 某一通知类型的发件人身份。
+// 各字段先读取 mail.identities.<通知类型>，未配置时回退到 mail.identities.default，仍为空时使用驱动的默认配置。
+type SMailIdentity struct {
+	kind string
+}
+
+// MailIdentity 返回通知类型（例如 hitokoto_appended）的发件人身份，kind 为空时只读取默认配置
+func MailIdentity(kind string) *SMailIdentity {
+	return &SMailIdentity{kind: kind}
+}
+
+func (t *SMailIdentity) get(key string) string {
+	if t.kind != "" {
+		if v := viper.GetString("mail.identities." + t.kind + "." + key); v != "" {
+			return v
+		}
+	}
+	return viper.GetString("mail.identities.default." + key)
+}
+
+// From 发件地址，例如阿里云邮件推送的发信地址
+func (t *SMailIdentity) From() string {
+	return t.get("from")
+}
+
+// Name 发件人名称，只在配置了 From 时生效
+func (t *SMailIdentity) Name() string {
+	return t.get("name")
+}
+
+// ReplyTo 回复地址
+func (t *SMailIdentity) ReplyTo() string {
+	return t.get("reply_to")
+}
+
+// Tag 服务商的邮件标签，例如阿里云邮件推送的 TagName，需要先在控制台中创建
+func (t *SMailIdentity) Tag() string {
+	return t.get("tag")
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("mail.failover.drivers", []string{})
+	viper.SetDefault("mail.failover.failure_threshold", 3)
+	viper.SetDefault("mail.failover.cooldown", 5*time.Minute)
+	viper.SetDefault("mail.inline_logo", "")
+	viper.SetDefault("mail.routing.rules", []map[string]any{})
+	viper.SetDefault("mail.routing.default", "")
+}
+
+// MailInlineLogo 返回本地 Logo 文件路径。设置后，支持内联资源的驱动会将 Logo 嵌入邮件，而不是引用 CDN 地址
+func MailInlineLogo() string {
+	return viper.GetString("mail.inline_logo")
+}
+
+type SMailFailover struct {
+}
+
+var mailFailover *SMailFailover
+
+// MailFailover 返回故障转移相关配置
+func MailFailover() *SMailFailover {
+	if mailFailover == nil {
+		mailFailover = &SMailFailover{}
+	}
+	return mailFailover
+}
+
+// Drivers 返回按优先级排列的驱动列表，为空时不启用故障转移，仅使用 mail.driver
+func (t *SMailFailover) Drivers() []driver.Type {
+	names := viper.GetStringSlice("mail.failover.drivers")
+	types := make([]driver.Type, 0, len(names))
+	for _, v := range names {
+		d, err := driver.ParseType(v)
+		if err != nil {
+			zap.L().Fatal("无法解析故障转移驱动配置", zap.Error(err))
+		}
+		types = append(types, d)
+	}
+	return types
+}
+
+// FailureThreshold 返回连续失败多少次后将驱动标记为不可用
+func (t *SMailFailover) FailureThreshold() int {
+	return viper.GetInt("mail.failover.failure_threshold")
+}
+
+// Cooldown 返回驱动被标记为不可用后，再次尝试（探测）前的等待时间
+func (t *SMailFailover) Cooldown() time.Duration {
+	return viper.GetDuration("mail.failover.cooldown")
+}
+
+type SMailRateLimit struct {
+	prefix string
+}
+
+// MailRateLimit 返回驱动的限速配置，位于 mail.rate_limit.<驱动名称>，例如 mail.rate_limit.aliyun
+func MailRateLimit(d driver.Type) *SMailRateLimit {
+	return &SMailRateLimit{prefix: "mail.rate_limit." + d.String()}
+}
+
+// PerSecond 返回每秒允许发送的邮件数，0 表示不限制
+func (t *SMailRateLimit) PerSecond() float64 {
+	return viper.GetFloat64(t.prefix + ".per_second")
+}
+
+// Burst 返回令牌桶容量，未设置时取 PerSecond 向上取整
+func (t *SMailRateLimit) Burst() int {
+	return viper.GetInt(t.prefix + ".burst")
+}
+
+// PerDay 返回每日允许发送的邮件数，0 表示不限制
+func (t *SMailRateLimit) PerDay() int {
+	return viper.GetInt(t.prefix + ".per_day")
+}
+
+// MailRoute 一条按收件人域名选择驱动的规则
+type MailRoute struct {
+	Domains []string // 域名，如 qq.com；*.example.com 匹配其所有子域名
+	Driver  driver.Type
+}
+
+type SMailRouting struct {
+}
+
+var mailRouting *SMailRouting
+
+// MailRouting 返回按收件人域名路由的相关配置
+func MailRouting() *SMailRouting {
+	if mailRouting == nil {
+		mailRouting = &SMailRouting{}
+	}
+	return mailRouting
+}
+
+// Rules 返回路由规则，为空时不启用路由
+func (t *SMailRouting) Rules() []MailRoute {
+	var raw []struct {
+		Domains []string `mapstructure:"domains"`
+		Driver  string   `mapstructure:"driver"`
+	}
+	if err := viper.UnmarshalKey("mail.routing.rules", &raw); err != nil {
+		zap.L().Fatal("无法解析邮件路由配置", zap.Error(err))
+	}
+	rules := make([]MailRoute, 0, len(raw))
+	for _, v := range raw {
+		d, err := driver.ParseType(v.Driver)
+		if err != nil {
+			zap.L().Fatal("无法解析邮件路由配置", zap.Error(err))
+		}
+		rules = append(rules, MailRoute{Domains: v.Domains, Driver: d})
+	}
+	return rules
+}
+
+// Default 返回未匹配任何规则的收件人使用的驱动，ok 为 false 时沿用 mail.driver 或故障转移链
+func (t *SMailRouting) Default() (d driver.Type, ok bool) {
+	name := viper.GetString("mail.routing.default")
+	if name == "" {
+		return 0, false
+	}
+	d, err := driver.ParseType(name)
+	if err != nil {
+		zap.L().Fatal("无法解析邮件路由配置", zap.Error(err))
+	}
+	return d, true
+}
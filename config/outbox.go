@@ -0,0 +1,39 @@
+package config
+
+import "github.com/spf13/viper"
+
+func init() {
+	viper.SetDefault("outbox.dir", "./data/outbox")
+	viper.SetDefault("outbox.format", "eml") // eml, maildir
+	viper.SetDefault("outbox.name", "一言网")
+	viper.SetDefault("outbox.mail", "notification@mail.hitokoto.cn")
+}
+
+type SOutbox struct {
+}
+
+var outbox *SOutbox
+
+func Outbox() *SOutbox {
+	if outbox == nil {
+		outbox = &SOutbox{}
+	}
+	return outbox
+}
+
+func (t *SOutbox) Dir() string {
+	return viper.GetString("outbox.dir")
+}
+
+// Format 返回写入格式：eml（每封邮件一个 .eml 文件）或 maildir
+func (t *SOutbox) Format() string {
+	return viper.GetString("outbox.format")
+}
+
+func (t *SOutbox) Name() string {
+	return viper.GetString("outbox.name")
+}
+
+func (t *SOutbox) Mail() string {
+	return viper.GetString("outbox.mail")
+}
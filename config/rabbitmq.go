@@ -10,6 +10,7 @@ func init() {
 	viper.SetDefault("rabbitmq.user", "admin")
 	viper.SetDefault("rabbitmq.pass", "")
 	viper.SetDefault("rabbitmq.vhost", "")
+	viper.SetDefault("rabbitmq.delayed_exchange", false)
 }
 
 type RabbitMQ struct {
@@ -34,3 +35,8 @@ func (t *RabbitMQ) Pass() string {
 func (t *RabbitMQ) VHost() string {
 	return viper.GetString("rabbitmq.vhost")
 }
+
+// DelayedExchange 是否使用 rabbitmq_delayed_message_exchange 插件实现延迟重试，关闭时使用 TTL 重试队列
+func (t *RabbitMQ) DelayedExchange() bool {
+	return viper.GetBool("rabbitmq.delayed_exchange")
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("retry.default.max_attempts", 6)
+	viper.SetDefault("retry.default.backoff", 4*time.Second)
+	viper.SetDefault("retry.default.multiplier", 4)
+	viper.SetDefault("retry.default.max_backoff", 30*time.Minute)
+	viper.SetDefault("retry.default.jitter", 0.2)
+}
+
+// SRetry 某一消费者处理失败时的重试策略。
+// 各项先读取 retry.<队列名>，未配置时回退到 retry.default。
+type SRetry struct {
+	queue string
+}
+
+// Retry 返回消费者（以队列名区分，例如 hitokoto_appended）的重试策略，queue 为空时只读取默认配置
+func Retry(queue string) *SRetry {
+	return &SRetry{queue: queue}
+}
+
+func (t *SRetry) key(name string) string {
+	if t.queue != "" && viper.IsSet("retry."+t.queue+"."+name) {
+		return "retry." + t.queue + "." + name
+	}
+	return "retry.default." + name
+}
+
+// MaxAttempts 最多处理的次数，包括第一次处理
+func (t *SRetry) MaxAttempts() int {
+	return viper.GetInt(t.key("max_attempts"))
+}
+
+// Backoff 第一次重试前的等待时间
+func (t *SRetry) Backoff() time.Duration {
+	return viper.GetDuration(t.key("backoff"))
+}
+
+// Multiplier 每次重试后等待时间的倍数
+func (t *SRetry) Multiplier() float64 {
+	return viper.GetFloat64(t.key("multiplier"))
+}
+
+// MaxBackoff 等待时间的上限
+func (t *SRetry) MaxBackoff() time.Duration {
+	return viper.GetDuration(t.key("max_backoff"))
+}
+
+// Jitter 随机缩短等待时间的比例，例如 0.2 表示最多缩短 20%
+func (t *SRetry) Jitter() float64 {
+	return viper.GetFloat64(t.key("jitter"))
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("sendcloud.api_user", "")
+	viper.SetDefault("sendcloud.api_key", "")
+	viper.SetDefault("sendcloud.endpoint", "https://api.sendcloud.net/apiv2")
+	viper.SetDefault("sendcloud.timeout", 30*time.Second)
+	viper.SetDefault("sendcloud.name", "一言网")
+	viper.SetDefault("sendcloud.mail", "notification@mail.hitokoto.cn")
+}
+
+type SSendCloud struct {
+}
+
+var sendCloud *SSendCloud
+
+func SendCloud() *SSendCloud {
+	if sendCloud == nil {
+		sendCloud = &SSendCloud{}
+	}
+	return sendCloud
+}
+
+func (t *SSendCloud) APIUser() string {
+	return viper.GetString("sendcloud.api_user")
+}
+
+func (t *SSendCloud) APIKey() string {
+	return viper.GetString("sendcloud.api_key")
+}
+
+func (t *SSendCloud) Endpoint() string {
+	return viper.GetString("sendcloud.endpoint")
+}
+
+func (t *SSendCloud) Timeout() time.Duration {
+	return viper.GetDuration("sendcloud.timeout")
+}
+
+func (t *SSendCloud) Name() string {
+	return viper.GetString("sendcloud.name")
+}
+
+func (t *SSendCloud) Mail() string {
+	return viper.GetString("sendcloud.mail")
+}
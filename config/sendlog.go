@@ -0,0 +1,34 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("sendlog.enabled", true)
+	viper.SetDefault("sendlog.retention", 30*24*time.Hour)
+}
+
+type SSendLog struct {
+}
+
+var sendLog *SSendLog
+
+// SendLog 返回发送日志相关配置
+func SendLog() *SSendLog {
+	if sendLog == nil {
+		sendLog = &SSendLog{}
+	}
+	return sendLog
+}
+
+// Enabled 返回是否记录发送日志
+func (t *SSendLog) Enabled() bool {
+	return viper.GetBool("sendlog.enabled")
+}
+
+// Retention 返回发送日志的保留时间，超过该时间的记录会被定期清理，0 表示永久保留
+func (t *SSendLog) Retention() time.Duration {
+	return viper.GetDuration("sendlog.retention")
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("smtp.host", "127.0.0.1")
+	viper.SetDefault("smtp.port", 587)
+	viper.SetDefault("smtp.username", "")
+	viper.SetDefault("smtp.password", "")
+	viper.SetDefault("smtp.encryption", "starttls") // none, starttls, tls
+	viper.SetDefault("smtp.auth", "plain")          // none, plain, login
+	viper.SetDefault("smtp.helo", "localhost")
+	viper.SetDefault("smtp.insecure_skip_verify", false)
+	viper.SetDefault("smtp.timeout", 30*time.Second)
+	viper.SetDefault("smtp.name", "一言网")
+	viper.SetDefault("smtp.mail", "notification@mail.hitokoto.cn")
+}
+
+type SSMTP struct {
+}
+
+var smtp *SSMTP
+
+func SMTP() *SSMTP {
+	if smtp == nil {
+		smtp = &SSMTP{}
+	}
+	return smtp
+}
+
+func (t *SSMTP) Host() string {
+	return viper.GetString("smtp.host")
+}
+
+func (t *SSMTP) Port() int {
+	return viper.GetInt("smtp.port")
+}
+
+func (t *SSMTP) Username() string {
+	return viper.GetString("smtp.username")
+}
+
+func (t *SSMTP) Password() string {
+	return viper.GetString("smtp.password")
+}
+
+// Encryption 返回连接加密方式：none、starttls 或 tls（隐式 TLS，常见于 465 端口）
+func (t *SSMTP) Encryption() string {
+	return viper.GetString("smtp.encryption")
+}
+
+// Auth 返回认证方式：none、plain 或 login
+func (t *SSMTP) Auth() string {
+	return viper.GetString("smtp.auth")
+}
+
+func (t *SSMTP) Helo() string {
+	return viper.GetString("smtp.helo")
+}
+
+func (t *SSMTP) InsecureSkipVerify() bool {
+	return viper.GetBool("smtp.insecure_skip_verify")
+}
+
+func (t *SSMTP) Timeout() time.Duration {
+	return viper.GetDuration("smtp.timeout")
+}
+
+func (t *SSMTP) Name() string {
+	return viper.GetString("smtp.name")
+}
+
+func (t *SSMTP) Mail() string {
+	return viper.GetString("smtp.mail")
+}
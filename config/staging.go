@@ -0,0 +1,58 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"strings"
+)
+
+func init() {
+	viper.SetDefault("environment", "production")
+	viper.SetDefault("staging.mode", "rewrite")
+	viper.SetDefault("staging.catch_all", "")
+	viper.SetDefault("staging.allowlist", []string{})
+	viper.SetDefault("staging.subject_prefix", true)
+}
+
+// Environment 返回运行环境，例如 production、staging
+func Environment() string {
+	return viper.GetString("environment")
+}
+
+// IsProduction 判断是否为生产环境，非生产环境会启用收件人保护（见 staging 配置）
+func IsProduction() bool {
+	env := strings.ToLower(strings.TrimSpace(Environment()))
+	return env == "production" || env == "prod"
+}
+
+type SStaging struct {
+}
+
+var staging *SStaging
+
+// Staging 返回非生产环境下的收件人保护配置
+func Staging() *SStaging {
+	if staging == nil {
+		staging = &SStaging{}
+	}
+	return staging
+}
+
+// Mode 返回保护模式：rewrite 将所有收件人改写为 CatchAll；allowlist 丢弃白名单以外的收件人
+func (t *SStaging) Mode() string {
+	return strings.ToLower(viper.GetString("staging.mode"))
+}
+
+// CatchAll 返回 rewrite 模式下接收所有邮件的地址
+func (t *SStaging) CatchAll() string {
+	return viper.GetString("staging.catch_all")
+}
+
+// Allowlist 返回 allowlist 模式下允许的地址或域名，域名可以写作 example.com 或 *.example.com
+func (t *SStaging) Allowlist() []string {
+	return viper.GetStringSlice("staging.allowlist")
+}
+
+// SubjectPrefix 返回 rewrite 模式下是否在主题前加上环境与原始收件人
+func (t *SStaging) SubjectPrefix() bool {
+	return viper.GetBool("staging.subject_prefix")
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("storage.path", "./data/notification.db")
+	viper.SetDefault("storage.lock_timeout", 5*time.Second)
+}
+
+type SStorage struct {
+}
+
+var storage *SStorage
+
+// Storage 返回内嵌数据库相关配置，抑制列表等功能的数据都保存在该数据库中
+func Storage() *SStorage {
+	if storage == nil {
+		storage = &SStorage{}
+	}
+	return storage
+}
+
+func (t *SStorage) Path() string {
+	return viper.GetString("storage.path")
+}
+
+// LockTimeout 返回等待数据库文件锁的最长时间。worker 与 CLI 只在事务期间持有文件锁，需等待对方当前的事务结束
+func (t *SStorage) LockTimeout() time.Duration {
+	return viper.GetDuration("storage.lock_timeout")
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("suppression.enabled", true)
+	viper.SetDefault("suppression.ttl.hard_bounce", 0)
+	viper.SetDefault("suppression.ttl.soft_bounce", 72*time.Hour)
+	viper.SetDefault("suppression.ttl.complaint", 0)
+	viper.SetDefault("suppression.ttl.manual", 0)
+}
+
+type SSuppression struct {
+}
+
+var suppression *SSuppression
+
+// Suppression 返回抑制列表相关配置
+func Suppression() *SSuppression {
+	if suppression == nil {
+		suppression = &SSuppression{}
+	}
+	return suppression
+}
+
+// Enabled 返回发送前是否检查抑制列表
+func (t *SSuppression) Enabled() bool {
+	return viper.GetBool("suppression.enabled")
+}
+
+// TTL 返回某类抑制记录的有效期，kind 为 hard_bounce、soft_bounce、complaint 或 manual，0 表示永久有效
+func (t *SSuppression) TTL(kind string) time.Duration {
+	return viper.GetDuration("suppression.ttl." + kind)
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("tencentcloud.region", "ap-hongkong")
+	viper.SetDefault("tencentcloud.secret_id", "")
+	viper.SetDefault("tencentcloud.secret_key", "")
+	viper.SetDefault("tencentcloud.ses.name", "一言网")
+	viper.SetDefault("tencentcloud.ses.mail", "notification@mail.hitokoto.cn")
+	viper.SetDefault("tencentcloud.ses.endpoint", "ses.tencentcloudapi.com")
+	viper.SetDefault("tencentcloud.ses.timeout", 30*time.Second)
+}
+
+type STencentCloud struct {
+}
+
+var tencentCloud *STencentCloud
+
+func TencentCloud() *STencentCloud {
+	if tencentCloud == nil {
+		tencentCloud = &STencentCloud{}
+	}
+	return tencentCloud
+}
+
+func (t *STencentCloud) Region() string {
+	return viper.GetString("tencentcloud.region")
+}
+
+func (t *STencentCloud) SecretID() string {
+	return viper.GetString("tencentcloud.secret_id")
+}
+
+func (t *STencentCloud) SecretKey() string {
+	return viper.GetString("tencentcloud.secret_key")
+}
+
+var tencentCloudSES *ses
+
+func (t *STencentCloud) SES() *ses {
+	if tencentCloudSES == nil {
+		tencentCloudSES = &ses{}
+	}
+	return tencentCloudSES
+}
+
+type ses struct {
+}
+
+func (t *ses) SecretID() string {
+	if v := viper.GetString("tencentcloud.ses.secret_id"); v != "" {
+		return v
+	} else {
+		return viper.GetString("tencentcloud.secret_id")
+	}
+}
+
+func (t *ses) SecretKey() string {
+	if v := viper.GetString("tencentcloud.ses.secret_key"); v != "" {
+		return v
+	} else {
+		return viper.GetString("tencentcloud.secret_key")
+	}
+}
+
+func (t *ses) Region() string {
+	if v := viper.GetString("tencentcloud.ses.region"); v != "" {
+		return v
+	} else {
+		return viper.GetString("tencentcloud.region")
+	}
+}
+
+func (t *ses) Endpoint() string {
+	return viper.GetString("tencentcloud.ses.endpoint")
+}
+
+func (t *ses) Timeout() time.Duration {
+	return viper.GetDuration("tencentcloud.ses.timeout")
+}
+
+func (t *ses) Name() string {
+	return viper.GetString("tencentcloud.ses.name")
+}
+
+func (t *ses) Mail() string {
+	return viper.GetString("tencentcloud.ses.mail")
+}
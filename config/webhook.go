@@ -0,0 +1,70 @@
+package config
+
+import (
+	"github.com/spf13/viper"
+	"time"
+)
+
+func init() {
+	viper.SetDefault("webhook.enabled", false)
+	viper.SetDefault("webhook.addr", ":8080")
+	viper.SetDefault("webhook.read_timeout", 10*time.Second)
+	viper.SetDefault("webhook.aliyun.verify", true)
+	viper.SetDefault("webhook.aliyun.topic_owner", "")
+	viper.SetDefault("webhook.aliyun.topic_name", "")
+}
+
+type SWebhook struct {
+}
+
+var webhook *SWebhook
+
+// Webhook 返回投递状态回调（服务商事件推送）相关配置
+func Webhook() *SWebhook {
+	if webhook == nil {
+		webhook = &SWebhook{}
+	}
+	return webhook
+}
+
+// Enabled 返回是否启动内嵌的 HTTP 回调服务
+func (t *SWebhook) Enabled() bool {
+	return viper.GetBool("webhook.enabled")
+}
+
+// Addr 返回回调服务的监听地址，回调路径为 /webhook/<服务商>
+func (t *SWebhook) Addr() string {
+	return viper.GetString("webhook.addr")
+}
+
+func (t *SWebhook) ReadTimeout() time.Duration {
+	return viper.GetDuration("webhook.read_timeout")
+}
+
+var webhookAliyun *webhookAliyunConfig
+
+func (t *SWebhook) Aliyun() *webhookAliyunConfig {
+	if webhookAliyun == nil {
+		webhookAliyun = &webhookAliyunConfig{}
+	}
+	return webhookAliyun
+}
+
+type webhookAliyunConfig struct {
+}
+
+// Verify 返回是否校验 MNS 推送签名，仅应在本地调试时关闭
+func (t *webhookAliyunConfig) Verify() bool {
+	return viper.GetBool("webhook.aliyun.verify")
+}
+
+// TopicOwner 返回允许的 MNS 主题所属账号 ID，必填。
+// 任何阿里云账号都能向回调地址推送带有合法签名的消息，未配置时拒绝所有推送。
+func (t *webhookAliyunConfig) TopicOwner() string {
+	return viper.GetString("webhook.aliyun.topic_owner")
+}
+
+// TopicName 返回允许的 MNS 主题名称，为空时不限制
+func (t *webhookAliyunConfig) TopicName() string {
+	return viper.GetString("webhook.aliyun.topic_name")
+}
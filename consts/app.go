@@ -1,8 +1,9 @@
 package consts
 
 const (
-	SiteName  = "一言网"
-	SiteURL   = "https://hitokoto.cn"
-	Copyright = "MoeTeam"
-	Logo      = "https://cdn.a632079.me/assets/images/hitokoto-logo-512x512.png"
+	SiteName   = "一言网"
+	SiteURL    = "https://hitokoto.cn"
+	SiteDomain = "hitokoto.cn"
+	Copyright  = "MoeTeam"
+	Logo       = "https://cdn.a632079.me/assets/images/hitokoto-logo-512x512.png"
 )
@@ -0,0 +1,289 @@
+package deadletter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/cli"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	cli.Register(&cli.Command{
+		Name:  "deadletter",
+		Usage: "管理死信桶：list | inspect <序号> | archive [-o] [-remove] | replay [-from] [-dry-run]，均可使用 -queue -since -until -match 筛选",
+		Run:   run,
+	})
+}
+
+// options 各操作共用的参数
+type options struct {
+	can          *string
+	limit        *int
+	queue        *string
+	since, until *string
+	match        *string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet("deadletter "+name, flag.ContinueOnError)
+	return fs, &options{
+		can:   fs.String("can", Queue, "死信桶"),
+		limit: fs.Int("limit", 0, "最多读取的死信数，0 表示读取全部"),
+		queue: fs.String("queue", "", "只处理来自该队列的死信，例如 hitokoto_reviewed"),
+		since: fs.String("since", "", "最近一次失败的起始时间，例如 2023-09-01、2023-09-01 12:00:00 或 24h（最近 24 小时）"),
+		until: fs.String("until", "", "结束时间，格式同 -since"),
+		match: fs.String("match", "", "只处理消息体包含该内容的死信"),
+	}
+}
+
+func (o *options) filter() (Filter, error) {
+	f := Filter{Queue: *o.queue, Match: *o.match}
+	var err error
+	if f.Since, err = cli.ParseTime(*o.since); err != nil {
+		return f, err
+	}
+	if f.Until, err = cli.ParseTime(*o.until); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// load 读取死信桶并筛选，返回的 can 需要由调用方关闭
+func (o *options) load() (*can, []*Message, error) {
+	f, err := o.filter()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := openCan(*o.can)
+	if err != nil {
+		return nil, nil, err
+	}
+	messages, err := c.fetch(*o.limit)
+	if err != nil {
+		_ = c.Close()
+		return nil, nil, err
+	}
+	return c, filter(messages, f), nil
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少操作，可用操作：list、inspect、archive、replay")
+	}
+	switch args[0] {
+	case "list":
+		fs, o := newFlagSet("list")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		c, messages, err := o.load()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		return printList(messages)
+	case "inspect":
+		fs, o := newFlagSet("inspect")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return errors.New("缺少死信序号，序号见 list 的输出")
+		}
+		c, messages, err := o.load()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for _, v := range fs.Args() {
+			m, err := find(messages, v)
+			if err != nil {
+				return err
+			}
+			if err = printMessage(m); err != nil {
+				return err
+			}
+		}
+	case "archive":
+		fs, o := newFlagSet("archive")
+		output := fs.String("o", "deadletter-"+time.Now().Format("20060102-150405")+".jsonl", "归档文件，已存在时追加写入")
+		remove := fs.Bool("remove", false, "写入归档后从死信桶中移除")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		c, messages, err := o.load()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		if err = archive(*output, messages); err != nil {
+			return err
+		}
+		fmt.Printf("已将 %d 条死信归档到 %s\n", len(messages), *output)
+		if *remove {
+			for _, m := range messages {
+				if err = c.remove(m); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("已从死信桶中移除 %d 条死信\n", len(messages))
+		}
+	case "replay":
+		fs, o := newFlagSet("replay")
+		from := fs.String("from", "", "从归档文件重放，而不是从死信桶读取")
+		dryRun := fs.Bool("dry-run", false, "只列出将要重放的死信，不投递也不移除")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return replay(o, *from, *dryRun)
+	default:
+		return errors.Newf("未知的操作：%s", args[0])
+	}
+	return nil
+}
+
+// find 按序号查找死信
+func find(messages []*Message, index string) (*Message, error) {
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, errors.Newf("无效的死信序号：%s", index)
+	}
+	for _, m := range messages {
+		if m.Index == i {
+			return m, nil
+		}
+	}
+	return nil, errors.Newf("没有符合条件的死信 #%d", i)
+}
+
+// archive 将死信追加写入归档文件，写入并同步到磁盘后才返回
+func archive(path string, messages []*Message) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "无法打开归档文件")
+	}
+	if err = writeArchive(f, messages); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "无法写入归档文件")
+	}
+	return errors.Wrap(f.Close(), "无法写入归档文件")
+}
+
+// replay 将死信重放到原交换机。从死信桶读取时，重放成功的死信会被移除；无法确定来源的死信会被跳过
+func replay(o *options, from string, dryRun bool) error {
+	var (
+		c        *can
+		messages []*Message
+		err      error
+	)
+	if from != "" {
+		f, err := o.filter()
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(from)
+		if err != nil {
+			return errors.Wrap(err, "无法打开归档文件")
+		}
+		messages, err = readArchive(file)
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+		messages = filter(messages, f)
+		if !dryRun {
+			if c, err = openCan(*o.can); err != nil {
+				return err
+			}
+			defer c.Close()
+		}
+	} else {
+		if c, messages, err = o.load(); err != nil {
+			return err
+		}
+		defer c.Close()
+	}
+	var replayed, skipped int
+	for _, m := range messages {
+		if !m.replayable() {
+			skipped++
+			fmt.Printf("跳过 #%d：无法确定原交换机与路由键\n", m.Index)
+			continue
+		}
+		if dryRun {
+			replayed++
+			fmt.Printf("将重放 #%d 到 %s（路由键 %s）：%s\n", m.Index, m.Exchange, m.RoutingKey, truncate(m.Body, 80))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = c.publish(ctx, m)
+		cancel()
+		if err != nil {
+			return errors.WithMessagef(err, "已重放 %d 条", replayed)
+		}
+		if from == "" {
+			if err = c.remove(m); err != nil {
+				return errors.WithMessagef(err, "死信 #%d 已重放但未能从死信桶中移除", m.Index)
+			}
+		}
+		replayed++
+	}
+	if dryRun {
+		fmt.Printf("演练：将重放 %d 条死信，跳过 %d 条\n", replayed, skipped)
+		return nil
+	}
+	fmt.Printf("已重放 %d 条死信，跳过 %d 条\n", replayed, skipped)
+	return nil
+}
+
+func printList(messages []*Message) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tTIME\tQUEUE\tCLASS\tATTEMPTS\tERROR\tBODY")
+	for _, m := range messages {
+		t := ""
+		if !m.Time.IsZero() {
+			t = m.Time.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			m.Index, t, m.Queue, m.ErrorClass, m.Attempts, truncate(m.Error, 60), truncate(m.Body, 60))
+	}
+	return w.Flush()
+}
+
+// printMessage 输出死信详情，JSON 格式的消息体会格式化后输出
+func printMessage(m *Message) error {
+	header, err := json.MarshalIndent(m.Header, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "无法格式化消息头")
+	}
+	body := m.Body
+	var out bytes.Buffer
+	if json.Indent(&out, []byte(body), "", "  ") == nil {
+		body = out.String()
+	}
+	fmt.Printf("#%d\n交换机：%s\n队列：%s\n路由键：%s\n时间：%s\n错误类别：%s\n失败次数：%d\n错误信息：%s\n消息头：\n%s\n消息体：\n%s\n\n",
+		m.Index, m.Exchange, m.Queue, m.RoutingKey, m.Time.Local().Format(time.DateTime),
+		m.ErrorClass, m.Attempts, m.Error, header, body)
+	return nil
+}
+
+// truncate 截断过长的内容并移除换行，用于表格输出
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
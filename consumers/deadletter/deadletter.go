@@ -0,0 +1,174 @@
+// Package deadletter 管理死信桶中的死信：查看、归档为 JSONL 文件以及重放到原队列。
+//
+// 读取死信桶时使用 basic.get 且不确认消息，命令结束时关闭 Channel，未被移除的死信会回到死信桶；
+// 只有归档（-remove）或重放成功的死信才会被确认并从死信桶中移除。
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"io"
+	"strings"
+	"time"
+)
+
+// Queue 默认的死信桶
+const Queue = "notification_failed_can"
+
+// Message 死信桶中的一条死信
+type Message struct {
+	Index      int                    `json:"-"`           // 在死信桶中的序号，从 1 开始
+	Time       time.Time              `json:"time"`        // 最近一次失败的时间
+	Exchange   string                 `json:"exchange"`    // 消息最初所在的交换机
+	Queue      string                 `json:"queue"`       // 消息最初所在的队列
+	RoutingKey string                 `json:"routing_key"` // 消息最初的路由键
+	ErrorClass string                 `json:"error_class,omitempty"`
+	Attempts   int                    `json:"attempts,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	MessageID  string                 `json:"message_id,omitempty"`
+	Header     map[string]interface{} `json:"header"` // 原消息头
+	Body       string                 `json:"body"`   // 原消息体
+
+	tag uint64 // 死信桶中的 delivery tag，来自归档文件的死信为 0
+}
+
+// parse 还原死信的原消息与来源。死信有两种来源：消费者按重试策略投递的死信在消息头中记录了来源与失败信息；
+// 死信收集器投递的死信只有 RabbitMQ 写入的 x-death 与 x-first-death-* 消息头。
+func parse(index int, d amqp.Delivery) *Message {
+	m := &Message{Index: index, MessageID: d.MessageId, Header: d.Headers, Body: string(d.Body), tag: d.DeliveryTag}
+	dl, err := rabbitmq.ParseDeadLetter(d.Body)
+	if err != nil {
+		m.Error = err.Error()
+		return m
+	}
+	h := dl.Header
+	m.Header, m.Body = h, dl.Body
+	m.Exchange = headerString(h, rabbitmq.HeaderOriginalExchange, "x-first-death-exchange")
+	m.Queue = headerString(h, rabbitmq.HeaderOriginalQueue, "x-first-death-queue")
+	m.RoutingKey = headerString(h, rabbitmq.HeaderOriginalRoutingKey)
+	m.ErrorClass = headerString(h, rabbitmq.HeaderErrorClass)
+	m.Error = headerString(h, rabbitmq.HeaderLastError)
+	if v, ok := h[rabbitmq.HeaderAttempts].(float64); ok { // 经 JSON 解码的数字
+		m.Attempts = int(v)
+	}
+	m.Time, _ = time.Parse(time.RFC3339, headerString(h, rabbitmq.HeaderFailedAt))
+	if death := firstDeath(h, m.Queue); death != nil {
+		if m.RoutingKey == "" {
+			if keys, ok := death["routing-keys"].([]interface{}); ok && len(keys) > 0 {
+				m.RoutingKey, _ = keys[0].(string)
+			}
+		}
+		if m.Time.IsZero() {
+			m.Time, _ = time.Parse(time.RFC3339, headerString(death, "time"))
+		}
+		if m.Attempts == 0 {
+			if v, ok := death["count"].(float64); ok {
+				m.Attempts = int(v)
+			}
+		}
+	}
+	if m.RoutingKey == "" && m.Exchange != "" {
+		// 与 rabbitmq.Ctx.GetProducer 的默认路由键一致
+		m.RoutingKey = strings.Trim(m.Exchange+"."+m.Queue, ".")
+	}
+	if m.Time.IsZero() {
+		m.Time = d.Timestamp
+	}
+	return m
+}
+
+// firstDeath 返回 x-death 中原队列的记录
+func firstDeath(h map[string]interface{}, queue string) map[string]interface{} {
+	deaths, _ := h["x-death"].([]interface{})
+	for _, v := range deaths {
+		if death, ok := v.(map[string]interface{}); ok && death["queue"] == queue {
+			return death
+		}
+	}
+	return nil
+}
+
+func headerString(h map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := h[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// replayable 判断死信是否记录了来源，可以重放
+func (m *Message) replayable() bool {
+	return m.Exchange != "" && m.RoutingKey != ""
+}
+
+// publishing 返回重放使用的消息：原消息体与移除了重试计数、死信记录的原消息头
+func (m *Message) publishing() amqp.Publishing {
+	return amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		MessageId:    m.MessageID,
+		Timestamp:    time.Now(),
+		Headers:      rabbitmq.ResetRetryHeaders(m.Header),
+		Body:         []byte(m.Body),
+	}
+}
+
+// Filter 筛选死信，各条件同时生效，零值表示不限制
+type Filter struct {
+	Queue string    // 原队列
+	Since time.Time // 最近一次失败的时间
+	Until time.Time
+	Match string // 消息体包含的内容
+}
+
+func (f *Filter) match(m *Message) bool {
+	return (f.Queue == "" || m.Queue == f.Queue) &&
+		(f.Since.IsZero() || !m.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || m.Time.Before(f.Until)) &&
+		(f.Match == "" || strings.Contains(m.Body, f.Match))
+}
+
+// filter 返回符合条件的死信
+func filter(messages []*Message, f Filter) []*Message {
+	var matched []*Message
+	for _, m := range messages {
+		if f.match(m) {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
+
+// writeArchive 将死信逐行写入 JSONL
+func writeArchive(w io.Writer, messages []*Message) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, m := range messages {
+		if err := enc.Encode(m); err != nil {
+			return errors.Wrap(err, "无法写入归档")
+		}
+	}
+	return nil
+}
+
+// readArchive 读取 writeArchive 写入的 JSONL，序号按行号从 1 开始
+func readArchive(r io.Reader) ([]*Message, error) {
+	var messages []*Message
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		m := &Message{}
+		if err := json.Unmarshal(scanner.Bytes(), m); err != nil {
+			return nil, errors.Wrapf(err, "无法解析归档第 %d 行", line)
+		}
+		m.Index = line
+		messages = append(messages, m)
+	}
+	return messages, errors.Wrap(scanner.Err(), "无法读取归档")
+}
@@ -0,0 +1,126 @@
+package deadletter
+
+import (
+	"bytes"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func deadLetter(t *testing.T, headers amqp.Table, body string) amqp.Delivery {
+	data, err := rabbitmq.DeadLetterBody(headers, []byte(body))
+	require.NoError(t, err)
+	return amqp.Delivery{Body: data, DeliveryTag: 7}
+}
+
+func TestParseConsumerDeadLetter(t *testing.T) {
+	failedAt := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	m := parse(1, deadLetter(t, amqp.Table{
+		rabbitmq.HeaderOriginalExchange:   "notification",
+		rabbitmq.HeaderOriginalQueue:      "hitokoto_reviewed",
+		rabbitmq.HeaderOriginalRoutingKey: "notification.hitokoto_reviewed",
+		rabbitmq.HeaderErrorClass:         "permanent",
+		rabbitmq.HeaderLastError:          "无法解析消息体",
+		rabbitmq.HeaderAttempts:           int64(1),
+		rabbitmq.HeaderFailedAt:           failedAt,
+	}, `{"uuid":"1"}`))
+	assert.Equal(t, "notification", m.Exchange)
+	assert.Equal(t, "hitokoto_reviewed", m.Queue)
+	assert.Equal(t, "notification.hitokoto_reviewed", m.RoutingKey)
+	assert.Equal(t, "permanent", m.ErrorClass)
+	assert.Equal(t, 1, m.Attempts)
+	assert.True(t, failedAt.Equal(m.Time))
+	assert.Equal(t, `{"uuid":"1"}`, m.Body)
+	assert.Equal(t, uint64(7), m.tag)
+	assert.True(t, m.replayable())
+}
+
+func TestParseCollectorDeadLetter(t *testing.T) {
+	deathAt := time.Date(2023, 9, 1, 8, 0, 0, 0, time.UTC)
+	m := parse(2, deadLetter(t, amqp.Table{
+		"x-first-death-exchange": "notification",
+		"x-first-death-queue":    "hitokoto_appended",
+		"x-death": []interface{}{
+			amqp.Table{"queue": "notification_failed_collector", "count": int64(1)},
+			amqp.Table{
+				"queue":        "hitokoto_appended",
+				"count":        int64(6),
+				"time":         deathAt,
+				"routing-keys": []interface{}{"notification.hitokoto_appended"},
+			},
+		},
+	}, "{}"))
+	assert.Equal(t, "hitokoto_appended", m.Queue)
+	assert.Equal(t, "notification.hitokoto_appended", m.RoutingKey)
+	assert.Equal(t, 6, m.Attempts)
+	assert.True(t, deathAt.Equal(m.Time))
+}
+
+func TestParseInvalidDeadLetter(t *testing.T) {
+	m := parse(3, amqp.Delivery{Body: []byte("not json")})
+	assert.NotEmpty(t, m.Error)
+	assert.Equal(t, "not json", m.Body)
+	assert.False(t, m.replayable())
+}
+
+func TestFilter(t *testing.T) {
+	now := time.Now()
+	messages := []*Message{
+		{Index: 1, Queue: "hitokoto_appended", Time: now.Add(-2 * time.Hour), Body: `{"to":"a@example.com"}`},
+		{Index: 2, Queue: "hitokoto_reviewed", Time: now.Add(-time.Hour), Body: `{"to":"b@example.com"}`},
+		{Index: 3, Queue: "hitokoto_reviewed", Time: now, Body: `{"to":"a@example.com"}`},
+	}
+	indexes := func(f Filter) (r []int) {
+		for _, m := range filter(messages, f) {
+			r = append(r, m.Index)
+		}
+		return
+	}
+	assert.Equal(t, []int{1, 2, 3}, indexes(Filter{}))
+	assert.Equal(t, []int{2, 3}, indexes(Filter{Queue: "hitokoto_reviewed"}))
+	assert.Equal(t, []int{1, 3}, indexes(Filter{Match: "a@example.com"}))
+	assert.Equal(t, []int{2}, indexes(Filter{Since: now.Add(-90 * time.Minute), Until: now}))
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	messages := []*Message{
+		{Exchange: "notification", Queue: "hitokoto_moved", RoutingKey: "notification.hitokoto_moved", Body: `{"uuid":"<1>"}`},
+		{Exchange: "notification", Queue: "hitokoto_reviewed", RoutingKey: "notification.hitokoto_reviewed", Body: "{}"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeArchive(&buf, messages))
+	assert.Contains(t, buf.String(), `<1>`, "归档中不应转义 HTML 字符")
+
+	restored, err := readArchive(&buf)
+	require.NoError(t, err)
+	require.Len(t, restored, 2)
+	assert.Equal(t, 2, restored[1].Index)
+	assert.Equal(t, messages[0].Body, restored[0].Body)
+	assert.Equal(t, uint64(0), restored[0].tag)
+
+	_, err = readArchive(bytes.NewBufferString("{}\nnot json\n"))
+	assert.Error(t, err)
+}
+
+func TestPublishingResetsRetryHeaders(t *testing.T) {
+	m := &Message{
+		MessageID: "id",
+		Header: map[string]interface{}{
+			"x-death":                []interface{}{},
+			rabbitmq.HeaderAttempts:  float64(6),
+			rabbitmq.HeaderLastError: "boom",
+			rabbitmq.HeaderRoute:     "dead_letter",
+			"x-first-death-queue":    "hitokoto_appended",
+			"x-custom":               "keep",
+		},
+		Body: "{}",
+	}
+	p := m.publishing()
+	assert.Equal(t, amqp.Table{"x-custom": "keep"}, p.Headers)
+	assert.Equal(t, "id", p.MessageId)
+	assert.Equal(t, []byte("{}"), p.Body)
+	assert.Equal(t, uint8(amqp.Persistent), p.DeliveryMode)
+}
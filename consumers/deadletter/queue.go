@@ -0,0 +1,92 @@
+package deadletter
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// can 读取死信桶的连接。取出的死信在 Close 前保持未确认状态，Close 时未确认的死信会回到死信桶
+type can struct {
+	queue   string
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	returns chan amqp.Return // 重放时无法路由的消息
+}
+
+func openCan(queue string) (*can, error) {
+	c := config.RabbitMQ{}
+	conn, err := amqp.Dial((&rabbitmq.Config{
+		Host:     c.Host(),
+		Port:     c.Port(),
+		Username: c.User(),
+		Password: c.Pass(),
+		Vhost:    c.VHost(),
+	}).URI())
+	if err != nil {
+		return nil, errors.Wrap(err, "无法连接 RabbitMQ")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "无法创建 Channel")
+	}
+	if err = ch.Confirm(false); err != nil {
+		_ = conn.Close()
+		return nil, errors.Wrap(err, "无法开启发布确认")
+	}
+	return &can{queue: queue, conn: conn, channel: ch, returns: ch.NotifyReturn(make(chan amqp.Return, 1))}, nil
+}
+
+// fetch 依次取出死信桶中的死信，limit 为 0 时取出全部
+func (c *can) fetch(limit int) ([]*Message, error) {
+	var messages []*Message
+	for limit <= 0 || len(messages) < limit {
+		d, ok, err := c.channel.Get(c.queue, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "无法读取死信桶 %s", c.queue)
+		}
+		if !ok {
+			break
+		}
+		messages = append(messages, parse(len(messages)+1, d))
+	}
+	return messages, nil
+}
+
+// remove 确认死信，将其从死信桶中移除
+func (c *can) remove(m *Message) error {
+	if m.tag == 0 {
+		return nil
+	}
+	return errors.Wrapf(c.channel.Ack(m.tag, false), "无法移除死信 #%d", m.Index)
+}
+
+// publish 将死信重放到原交换机，等待 Broker 确认
+func (c *can) publish(ctx context.Context, m *Message) error {
+	confirm, err := c.channel.PublishWithDeferredConfirmWithContext(ctx, m.Exchange, m.RoutingKey, true, false, m.publishing())
+	if err != nil {
+		return errors.Wrapf(err, "无法重放死信 #%d", m.Index)
+	}
+	ok, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "无法重放死信 #%d", m.Index)
+	}
+	if !ok {
+		return errors.Newf("RabbitMQ 拒绝了重放的死信 #%d", m.Index)
+	}
+	// 无法路由的消息会先于确认返回
+	select {
+	case r := <-c.returns:
+		return errors.Newf("死信 #%d 无法路由：%s（交换机 %s，路由键 %s）", m.Index, r.ReplyText, r.Exchange, r.RoutingKey)
+	default:
+		return nil
+	}
+}
+
+// Close 关闭连接，未确认的死信回到死信桶
+func (c *can) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,233 @@
+// Package idempotency 跳过已经成功处理过的重复消息，避免用户重复收到同一封邮件。
+//
+// 进程在发送邮件后、确认消息前退出，或者死信收集器重新投递时，同一条消息会被再次处理。
+// 每条消息以 MessageId（没有时为路由键与消息体的哈希）为键，在内嵌数据库中记录处理状态：
+// 开始处理前写入「处理中」记录，成功后改为「已处理」并保留 idempotency.window，失败时删除记录以便重试。
+// 记录的读写在同一事务中完成，因此同一条消息的并发投递只会有一个被处理，其余的稍后重新投递。
+//
+// 去重只能保证「至少一次」：进程在发送邮件后、写入「已处理」记录前退出时，处理中记录会在 idempotency.lease 后失效，
+// 重新投递的消息会再次发送。
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	amqp "github.com/rabbitmq/amqp091-go"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+var bucket = []byte("idempotency")
+
+// ErrInProgress 相同的消息正在被处理
+var ErrInProgress = errors.New("相同的消息正在处理中")
+
+// inProgressDelay 相同的消息正在处理时，重新投递前等待的时间
+const inProgressDelay = 30 * time.Second
+
+// maxInProgressWait 处理中记录存在超过该时间后，重复的消息不再原样放回队列，而是按暂时性错误交给消费者的重试策略，
+// 计入重试次数，重试次数耗尽时投递死信桶；避免 lease 较长时消息每 30 秒放回队列一次、无限循环
+const maxInProgressWait = 5 * time.Minute
+
+type state string
+
+const (
+	stateProcessing state = "processing"
+	stateDelivered  state = "delivered"
+)
+
+type record struct {
+	State     state     `json:"state"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (r *record) expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Key 返回消息的去重键：消费者标签加上 MessageId，没有 MessageId 时使用路由键与消息体的哈希
+func Key(consumerTag string, delivery amqp.Delivery) string {
+	id := delivery.MessageId
+	if id == "" {
+		h := sha256.New()
+		h.Write([]byte(delivery.RoutingKey))
+		h.Write([]byte{0})
+		h.Write(delivery.Body)
+		id = "sha256:" + hex.EncodeToString(h.Sum(nil))
+	}
+	return consumerTag + "/" + id
+}
+
+// claim 尝试开始处理 key，返回 false 表示已处理过；正在处理时返回 ErrInProgress 与处理开始的时间
+func claim(key string, lease time.Duration) (bool, time.Time, error) {
+	claimed := false
+	var since time.Time
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if v := b.Get([]byte(key)); v != nil {
+			var r record
+			if json.Unmarshal(v, &r) == nil && !r.expired(now) {
+				if r.State == stateDelivered {
+					return nil
+				}
+				since = r.UpdatedAt
+				return ErrInProgress
+			}
+		}
+		claimed = true
+		return put(b, key, &record{State: stateProcessing, UpdatedAt: now, ExpiresAt: now.Add(lease)})
+	})
+	if errors.Is(err, ErrInProgress) {
+		return false, since, err
+	}
+	if err != nil {
+		return false, since, errors.Wrap(err, "无法写入消息处理记录")
+	}
+	return claimed, since, nil
+}
+
+// done 将 key 标记为已处理，在 window 内重复投递的消息会被跳过
+func done(key string, window time.Duration) error {
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		return put(b, key, &record{State: stateDelivered, UpdatedAt: now, ExpiresAt: now.Add(window)})
+	})
+	return errors.Wrap(err, "无法写入消息处理记录")
+}
+
+// release 删除处理中的记录，使消息可以重新处理
+func release(key string) error {
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+	return errors.Wrap(err, "无法删除消息处理记录")
+}
+
+func put(b *bolt.Bucket, key string, r *record) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(key), v)
+}
+
+// Wrap 为消费者的处理函数加上去重：已处理过的消息直接确认，正在处理的消息稍后重新投递，
+// 处理中记录存在超过 maxInProgressWait 时按暂时性错误返回。
+// 未启用去重或处于演练模式时直接调用 handler。
+func Wrap(handler func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error) func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+	return func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		c := config.Idempotency()
+		if !c.Enabled() || config.DryRun().Enabled() {
+			return handler(ctx, delivery)
+		}
+		logger := logging.WithContext(ctx)
+		defer logger.Sync()
+		key := Key(rabbitmq.ConsumerTag(ctx), delivery)
+		claimed, since, err := claim(key, c.Lease())
+		if errors.Is(err, ErrInProgress) {
+			if wait := time.Since(since); wait >= maxInProgressWait {
+				logger.Warn("[idempotency] 相同的消息处理时间过长，交由重试策略处理", zap.String("key", key), zap.Duration("wait", wait))
+				return errors.Wrapf(err, "处理中记录已存在 %s", wait.Round(time.Second))
+			}
+			logger.Info("[idempotency] 相同的消息正在处理中，稍后重新投递", zap.String("key", key))
+			return rabbitmq.RequeueAfter(err, inProgressDelay)
+		}
+		if err != nil {
+			// 无法读写记录时照常处理，重复发送好过不发送
+			logger.Error("[idempotency] 无法检查消息是否已处理", zap.String("key", key), zap.Error(err))
+			return handler(ctx, delivery)
+		}
+		if !claimed {
+			logger.Info("[idempotency] 消息已处理过，跳过", zap.String("key", key))
+			return nil
+		}
+		if err = handler(ctx, delivery); err != nil {
+			if e := release(key); e != nil {
+				logger.Error("[idempotency] 无法删除消息处理记录", zap.String("key", key), zap.Error(e))
+			}
+			return err
+		}
+		if err = done(key, c.Window()); err != nil {
+			logger.Error("[idempotency] 无法记录消息已处理", zap.String("key", key), zap.Error(err))
+		}
+		autoPrune()
+		return nil
+	}
+}
+
+// Prune 删除过期的记录，返回删除的记录数
+func Prune(now time.Time) (int, error) {
+	var n int
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		var expired [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var r record
+			if json.Unmarshal(v, &r) != nil || r.expired(now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err = b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, errors.Wrap(err, "无法清理消息处理记录")
+}
+
+// pruneInterval 自动清理的最小间隔
+const pruneInterval = time.Hour
+
+var (
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+)
+
+// autoPrune 清理过期记录，每个进程每小时至多执行一次
+func autoPrune() {
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+	if time.Since(lastPrune) < pruneInterval {
+		return
+	}
+	lastPrune = time.Now()
+	n, err := Prune(time.Now())
+	if err != nil {
+		zap.L().Error("[idempotency] 无法清理消息处理记录", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Info("[idempotency] 已清理过期的消息处理记录", zap.Int("count", n))
+	}
+}
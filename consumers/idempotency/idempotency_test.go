@@ -0,0 +1,145 @@
+package idempotency
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setup(t *testing.T) rabbitmq.Ctx {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() {
+		storage.SetPath("")
+		viper.Set("idempotency.window", nil)
+	})
+	ctx := rabbitmq.NewCtxFromContext(context.Background(), nil)
+	ctx.Set("consumer_tag", "HitokotoAppendedNotificationWorker")
+	return ctx
+}
+
+func TestKey(t *testing.T) {
+	d := amqp.Delivery{RoutingKey: "notification.hitokoto_appended", Body: []byte(`{"uuid":"1"}`)}
+	assert.Equal(t, Key("a", d), Key("a", d))
+	assert.NotEqual(t, Key("a", d), Key("b", d), "不同消费者的记录应相互独立")
+
+	other := d
+	other.RoutingKey = "notification.hitokoto_moved"
+	assert.NotEqual(t, Key("a", d), Key("a", other))
+
+	d.MessageId = "message-1"
+	assert.Equal(t, "a/message-1", Key("a", d))
+}
+
+func TestWrapSkipsDuplicates(t *testing.T) {
+	ctx := setup(t)
+	var calls int
+	handler := Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		calls++
+		return nil
+	})
+	d := amqp.Delivery{MessageId: "message-1"}
+	require.NoError(t, handler(ctx, d))
+	require.NoError(t, handler(ctx, d))
+	assert.Equal(t, 1, calls)
+
+	require.NoError(t, handler(ctx, amqp.Delivery{MessageId: "message-2"}))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrapReleasesOnError(t *testing.T) {
+	ctx := setup(t)
+	var calls int
+	failed := errors.New("发送失败")
+	handler := Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		calls++
+		if calls == 1 {
+			return failed
+		}
+		return nil
+	})
+	d := amqp.Delivery{MessageId: "message-1"}
+	assert.ErrorIs(t, handler(ctx, d), failed)
+	require.NoError(t, handler(ctx, d), "失败后重试的消息应再次处理")
+	require.NoError(t, handler(ctx, d))
+	assert.Equal(t, 2, calls)
+}
+
+func TestWrapConcurrentDeliveries(t *testing.T) {
+	ctx := setup(t)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		calls.Add(1)
+		close(started)
+		<-release
+		return nil
+	})
+	d := amqp.Delivery{MessageId: "message-1"}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, handler(ctx, d))
+	}()
+	<-started
+
+	err := handler(ctx, d)
+	assert.ErrorIs(t, err, ErrInProgress)
+	assert.Equal(t, rabbitmq.ClassRateLimited, rabbitmq.Classify(err), "处理中的消息应稍后重新投递，不计入重试次数")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestWrapInProgressCap(t *testing.T) {
+	ctx := setup(t)
+	d := amqp.Delivery{MessageId: "message-1"}
+	key := Key(rabbitmq.ConsumerTag(ctx), d)
+	started := time.Now().Add(-maxInProgressWait)
+	require.NoError(t, storage.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		return put(b, key, &record{State: stateProcessing, UpdatedAt: started, ExpiresAt: time.Now().Add(time.Hour)})
+	}))
+	handler := Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		t.Fatal("处理中的消息不应再次处理")
+		return nil
+	})
+	err := handler(ctx, d)
+	assert.ErrorIs(t, err, ErrInProgress)
+	assert.Equal(t, rabbitmq.ClassTransient, rabbitmq.Classify(err), "处理时间过长时应交由重试策略，计入重试次数")
+}
+
+func TestWrapWindow(t *testing.T) {
+	ctx := setup(t)
+	viper.Set("idempotency.window", time.Millisecond)
+	var calls int
+	handler := Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		calls++
+		return nil
+	})
+	d := amqp.Delivery{MessageId: "message-1"}
+	require.NoError(t, handler(ctx, d))
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, handler(ctx, d))
+	assert.Equal(t, 2, calls, "超过保留时间的消息应再次处理")
+
+	n, err := Prune(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
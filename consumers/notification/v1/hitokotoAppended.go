@@ -2,11 +2,11 @@ package v1
 
 import (
 	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/consumers/idempotency"
 	"github.com/hitokoto-osc/notification-worker/consumers/notification/v1/internal/model"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/django"
 	"github.com/hitokoto-osc/notification-worker/logging"
-	"github.com/hitokoto-osc/notification-worker/mail"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	"github.com/hitokoto-osc/notification-worker/utils/formatter"
@@ -42,15 +42,16 @@ func HitokotoAppendedEvent() *rabbitmq.ConsumerRegisterOptions {
 			Tag:        "HitokotoAppendedNotificationWorker",
 			AckByError: true,
 		},
-		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		Retry: notificationRetry("hitokoto_appended"),
+		CallFunc: idempotency.Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Debug("[hitokoto_appended] 收到消息: %v  \n", zap.ByteString("body", delivery.Body))
 			message, err := validator.UnmarshalV[model.HitokotoAppendedMessage](ctx, delivery.Body)
 			if err != nil {
-				return errors.Wrap(err, "解析消息失败")
+				return rabbitmq.Permanent(errors.Wrap(err, "解析消息失败"))
 			}
-			html, err := django.RenderTemplate("email/hitokoto_appended", django.Context{
+			html, text, err := django.RenderMail("email/hitokoto_appended", django.Context{
 				"username":   message.Creator,
 				"created_at": message.CreatedAt.Format("Y-m-d H:i:s"),
 				"hitokoto":   message.Hitokoto,
@@ -61,15 +62,18 @@ func HitokotoAppendedEvent() *rabbitmq.ConsumerRegisterOptions {
 			if err != nil {
 				return errors.Wrap(err, "渲染模板失败")
 			}
-			err = mail.SendSingle(ctx, &mailer.Mailer{
+			m := &mailer.Mailer{
 				Type: mailer.TypeNormal,
 				Mail: mailer.Mail{
 					To:      []string{message.To},
 					Subject: "喵！已经成功收到您提交的句子了！",
 					Body:    html,
+					Text:    text,
 				},
-			})
-			return err
-		},
+				Meta: mailer.Meta{Kind: "hitokoto_appended", Template: "email/hitokoto_appended", Ref: message.UUID},
+			}
+			m.Mail.Thread(sentenceThread(message.UUID, "appended"))
+			return sendMail(ctx, m)
+		}),
 	}
 }
@@ -1,57 +1,108 @@
 package v1
 
 import (
+	"github.com/hitokoto-osc/notification-worker/alert"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/logging"
 	"go.uber.org/zap"
+	"time"
 
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 func init() {
+	provider.RegisterQueue(HitokotoFailedMessageCan())
 	provider.Register(HitokotoFailedMessageCanEvent())
 }
 
-// HitokotoFailedMessageCanEvent 处理不可恢复通知死信 —— 发给管理员
-func HitokotoFailedMessageCanEvent() *rabbitmq.ConsumerRegisterOptions {
-	return &rabbitmq.ConsumerRegisterOptions{
+// HitokotoFailedMessageCan 返回死信桶的配置。死信桶没有消费者，死信会保留在其中，
+// 可用 `notification-worker deadletter` 命令查看、归档与重放。
+// 死信桶不设长度上限：修改声明参数会使已有部署重新声明队列时失败（PRECONDITION_FAILED），
+// 丢弃哪些死信也应由运维决定，需要限制时通过 Policy 设置 max-length 或 message-ttl。
+// 超出上限或过期的死信按队列参数转发到收集器，收集器只记录日志，不会再投递回死信桶。
+func HitokotoFailedMessageCan() *rabbitmq.QueueRegisterOptions {
+	return &rabbitmq.QueueRegisterOptions{
 		Exchange: rabbitmq.Exchange{
-			Name:    "notification_failed",
+			Name:    deadLetterCan.Exchange,
 			Type:    "direct",
 			Durable: true,
 		},
 		Queue: rabbitmq.Queue{
-			Name:    "notification_failed_can",
+			Name:    deadLetterCan.Queue,
 			Durable: true,
 			Args: amqp.Table{
 				"x-dead-letter-exchange":    "notification_failed",
-				"x-dead-letter-routing-key": "notification_failed.notification_failed_collector", // 万一发送失败了还是丢死信收集器咯
+				"x-dead-letter-routing-key": "notification_failed.notification_failed_collector",
 			},
 		},
 		BindingOptions: rabbitmq.BindingOptions{
-			RoutingKey: "notification_failed.notification_failed_can",
+			RoutingKey: deadLetterCan.RoutingKey,
+		},
+	}
+}
+
+// alertRetryDelay 告警发送失败后，死信放回告警队列前等待的时间
+const alertRetryDelay = time.Minute
+
+// HitokotoFailedMessageCanEvent 处理不可恢复通知死信 —— 发给管理员。
+// 告警队列与死信桶以相同的路由键绑定，因此会收到每条死信的副本，死信桶中的死信不受影响。
+func HitokotoFailedMessageCanEvent() *rabbitmq.ConsumerRegisterOptions {
+	return &rabbitmq.ConsumerRegisterOptions{
+		Exchange: rabbitmq.Exchange{
+			Name:    "notification_failed",
+			Type:    "direct",
+			Durable: true,
+		},
+		Queue: rabbitmq.Queue{
+			Name:    "notification_failed_alert",
+			Durable: true,
+		},
+		BindingOptions: rabbitmq.BindingOptions{
+			RoutingKey: deadLetterCan.RoutingKey,
 		},
 		ConsumerOptions: rabbitmq.ConsumerOptions{
-			Tag:        "HitokotoFailedMessageCollectWorker",
+			Tag:        "HitokotoFailedMessageAlertWorker",
 			AckByError: true,
 		},
 		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Error("[RabbitMQ.Producer.FailedMessageCan] 收到死信：", zap.ByteString("body", delivery.Body))
-			// TODO: 修复死信循环的问题
-			//			html := fmt.Sprintf(`<h1>您好，a632079。</h1>
-			//<p>系统遇到了一封无法处理的死信，以下为详细信息：</p>
-			//<pre>
-			//	<code>
-			//%v
-			//	</code>
-			//</pre>
-			//`, string(delivery.Body))
-
-			// err := directmail.SingleSendMail(ctx, "a632079@qq.com", "[一言告警] 出现不可恢复的死信！", html, true)
+			// 等待所在窗口的告警发送后才确认消息，进程在此之前退出时死信会重新投递；
+			// 发送失败时稍后放回告警队列重新告警，不会进入死信收集器
+			if err := alert.Notify(ctx, deadLetterItem(delivery)); err != nil {
+				return rabbitmq.RequeueAfter(err, alertRetryDelay)
+			}
 			return nil
 		},
 	}
 }
+
+// deadLetterItem 解析死信桶中的消息，还原原消息头与消息体；无法解析时展示死信本身
+func deadLetterItem(delivery amqp.Delivery) *alert.Item {
+	item := &alert.Item{Time: time.Now(), Header: delivery.Headers, Body: string(delivery.Body)}
+	d, err := rabbitmq.ParseDeadLetter(delivery.Body)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.Header, item.Body = d.Header, d.Body
+	item.Queue = headerString(d.Header, rabbitmq.HeaderOriginalQueue, "x-first-death-queue")
+	item.ErrorClass = headerString(d.Header, rabbitmq.HeaderErrorClass)
+	item.Error = headerString(d.Header, rabbitmq.HeaderLastError)
+	if v, ok := d.Header[rabbitmq.HeaderAttempts].(float64); ok { // 经 JSON 解码的数字
+		item.Attempts = int(v)
+	}
+	return item
+}
+
+// headerString 返回第一个存在的字符串消息头
+func headerString(header map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := header[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -2,13 +2,13 @@ package v1
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/cockroachdb/errors"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/logging"
 	"go.uber.org/zap"
 	"math"
+	"strings"
 	"time"
 
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
@@ -19,12 +19,18 @@ func init() {
 	provider.Register(HitokotoFailedMessageCollectEvent())
 }
 
+// publishRetryDelay 重试或死信消息未被 Broker 确认时，放回原消息前等待的时间
+const publishRetryDelay = 5 * time.Second
+
 func checkXDeathCount(ctx context.Context, xDeath []interface{}) int64 {
 	logger := logging.WithContext(ctx)
 	defer logger.Sync()
 	count := int64(0)
 	for _, v := range xDeath {
 		table := v.(amqp.Table)
+		if table["reason"] == "expired" { // 在延迟重试队列中等待过期产生的记录，不是处理失败
+			continue
+		}
 		c, o := table["count"]
 		logger.Debug("c, v", zap.Any("c", c), zap.Any("v", v))
 		if !o {
@@ -38,11 +44,10 @@ func checkXDeathCount(ctx context.Context, xDeath []interface{}) int64 {
 	return count
 }
 
-func wrapperHeader(header amqp.Table, body []byte) ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
-		"header": header,
-		"body":   string(body),
-	})
+// evictedFromCan 判断死信是否因超出死信桶的长度上限或过期而被移除。
+// 死信桶的队列参数将这类死信转发到收集器，它们已经无法恢复，不应再投递回死信桶
+func evictedFromCan(headers amqp.Table) bool {
+	return headers["x-last-death-queue"] == deadLetterCan.Queue
 }
 
 // HitokotoFailedMessageCollectEvent 处理通知死信
@@ -91,6 +96,13 @@ func HitokotoFailedMessageCollectEvent() *rabbitmq.ConsumerRegisterOptions {
 				zap.String("headers", fmt.Sprintf("%+v", delivery.Headers)),
 				zap.ByteString("body", delivery.Body),
 			)
+			if evictedFromCan(delivery.Headers) {
+				logger.Warn("[RabbitMQ.Producer.FailedMessageCollector] 死信因超出死信桶的长度上限或过期被移除",
+					zap.Any("reason", delivery.Headers["x-last-death-reason"]),
+					zap.ByteString("body", delivery.Body),
+				)
+				return nil
+			}
 			XDeath, ok := delivery.Headers["x-death"]
 			if !ok {
 				return errors.New("x-death is missing")
@@ -103,49 +115,38 @@ func HitokotoFailedMessageCollectEvent() *rabbitmq.ConsumerRegisterOptions {
 			if !ok {
 				return errors.New("x-first-death-queue is missing")
 			}
-			var producer *rabbitmq.Producer
-			producer, err = ctx.GetProducer(
-				OriginalExchangeName.(string),
-				OriginalQueueName.(string),
-				"",
-			)
-			if err != nil {
-				return err
-			}
 			if count := checkXDeathCount(ctx, XDeath.([]interface{})); count <= 5 {
+				// 由 Broker 计时后投递回原队列，处理函数立即返回并确认消息
 				duration := time.Second * time.Duration(math.Pow(4, float64(count)))
-				logger.Sugar().Debugf("[RabbitMQ.Producer.FailedMessageCollector] 当前错误计数：%v，等待 %d 秒后，尝试重新投递... ", count, duration/time.Second)
-				time.Sleep(duration)
-				if err = producer.Publish(ctx, amqp.Publishing{
+				target := rabbitmq.DelayTarget{
+					Exchange:   OriginalExchangeName.(string),
+					Queue:      OriginalQueueName.(string),
+					RoutingKey: strings.Trim(OriginalExchangeName.(string)+"."+OriginalQueueName.(string), "."),
+				}
+				logger.Sugar().Debugf("[RabbitMQ.Producer.FailedMessageCollector] 当前错误计数：%v，将在 %d 秒后重新投递... ", count, duration/time.Second)
+				if err = ctx.Instance().PublishDelayed(ctx, target, duration, amqp.Publishing{
 					DeliveryMode: amqp.Persistent,
 					Headers:      delivery.Headers,
 					Body:         delivery.Body,
 				}); err != nil {
-					return errors.WithMessagef(err, "[RabbitMQ.Producer.FailedMessageCollector] publish original queue (%v) failed.", fmt.Sprintf("%v.%v", OriginalExchangeName, OriginalQueueName))
+					// Broker 未确认时放回原消息，避免确认后丢失
+					return rabbitmq.RequeueAfter(errors.WithMessagef(err, "[RabbitMQ.Producer.FailedMessageCollector] publish retry queue (%v) failed.", target.RoutingKey), publishRetryDelay)
 				}
-				logger.Debug("[RabbitMQ.Producer.FailedMessageCollector] 重新投递成功")
+				logger.Debug("[RabbitMQ.Producer.FailedMessageCollector] 已投递到延迟重试队列")
 			} else {
 				logger.Debug("[RabbitMQ.Producer.FailedMessageCollector] 重试次数过多，投递死信桶。")
 				// 丢到死信桶队列（无法恢复）
-				producer, err = ctx.GetProducer(
-					"notification_failed",
-					"notification_failed_can",
-					"notification_failed.notification_failed_can",
-				)
-				if err != nil {
-					return err
-				}
 				var body []byte
-				body, err = wrapperHeader(delivery.Headers, delivery.Body)
+				body, err = rabbitmq.DeadLetterBody(delivery.Headers, delivery.Body)
 				if err != nil {
 					return err
 				}
-				if err = producer.Publish(ctx, amqp.Publishing{
+				if err = ctx.Instance().PublishConfirmed(ctx, deadLetterCan.Exchange, deadLetterCan.RoutingKey, amqp.Publishing{
 					DeliveryMode: amqp.Persistent,
 					Headers:      delivery.Headers,
 					Body:         body,
 				}); err != nil {
-					return errors.WithMessage(err, "[RabbitMQ.Producer.FailedMessageCollector] publish can queue failed.")
+					return rabbitmq.RequeueAfter(errors.WithMessage(err, "[RabbitMQ.Producer.FailedMessageCollector] publish can queue failed."), publishRetryDelay)
 				}
 				logger.Debug("[RabbitMQ.Producer.FailedMessageCollector] 投递成功.")
 			}
@@ -0,0 +1,22 @@
+package v1
+
+import (
+	"context"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCheckXDeathCount(t *testing.T) {
+	xDeath := []interface{}{
+		amqp.Table{"reason": "rejected", "queue": "notification_hitokoto_appended", "count": int64(2)},
+		amqp.Table{"reason": "expired", "queue": "notification.retry.16s", "count": int64(2)},
+		amqp.Table{"reason": "rejected", "queue": "notification_failed_collector", "count": int64(1)},
+	}
+	assert.Equal(t, int64(3), checkXDeathCount(context.Background(), xDeath))
+}
+
+func TestEvictedFromCan(t *testing.T) {
+	assert.True(t, evictedFromCan(amqp.Table{"x-last-death-queue": "notification_failed_can", "x-last-death-reason": "maxlen"}))
+	assert.False(t, evictedFromCan(amqp.Table{"x-last-death-queue": "notification_hitokoto_appended", "x-last-death-reason": "rejected"}))
+}
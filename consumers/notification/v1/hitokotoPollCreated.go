@@ -2,17 +2,18 @@ package v1
 
 import (
 	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/consumers/idempotency"
 	"github.com/hitokoto-osc/notification-worker/consumers/notification/v1/internal/model"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/django"
 	"github.com/hitokoto-osc/notification-worker/logging"
-	"github.com/hitokoto-osc/notification-worker/mail"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	"github.com/hitokoto-osc/notification-worker/utils/formatter"
 	"github.com/hitokoto-osc/notification-worker/utils/validator"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.uber.org/zap"
+	"strconv"
 )
 
 func init() {
@@ -42,15 +43,16 @@ func HitokotoPollCreatedEvent() *rabbitmq.ConsumerRegisterOptions {
 			Tag:        "HitokotoPollCreatedNotificationWorker",
 			AckByError: true,
 		},
-		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		Retry: notificationRetry("hitokoto_poll_created"),
+		CallFunc: idempotency.Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Debug("[hitokoto_poll_created]收到消息：", zap.ByteString("body", delivery.Body))
 			message, err := validator.UnmarshalV[model.PollCreatedMessage](ctx, delivery.Body)
 			if err != nil {
-				return errors.Wrap(err, "解析消息失败")
+				return rabbitmq.Permanent(errors.Wrap(err, "解析消息失败"))
 			}
-			html, err := django.RenderTemplate("email/poll_created", django.Context{
+			html, text, err := django.RenderMail("email/poll_created", django.Context{
 				"username":   message.Username,
 				"created_at": message.CreatedAt.Format("Y-m-d H:i:s"),
 				"poll_id":    message.ID,
@@ -63,15 +65,18 @@ func HitokotoPollCreatedEvent() *rabbitmq.ConsumerRegisterOptions {
 			if err != nil {
 				return errors.Wrap(err, "无法渲染模板")
 			}
-			err = mail.SendSingle(ctx, &mailer.Mailer{
+			m := &mailer.Mailer{
 				Type: mailer.TypeNormal,
 				Mail: mailer.Mail{
 					To:      []string{message.To},
 					Subject: "喵！新的野生投票菌出现了！",
 					Body:    html,
+					Text:    text,
 				},
-			})
-			return err
-		},
+				Meta: mailer.Meta{Kind: "hitokoto_poll_created", Template: "email/poll_created", Ref: message.UUID},
+			}
+			m.Mail.Thread(sentenceThread(message.UUID, "poll_created", strconv.FormatUint(uint64(message.ID), 10)))
+			return sendMail(ctx, m)
+		}),
 	}
 }
@@ -2,11 +2,11 @@ package v1
 
 import (
 	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/consumers/idempotency"
 	"github.com/hitokoto-osc/notification-worker/consumers/notification/v1/internal/model"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/django"
 	"github.com/hitokoto-osc/notification-worker/logging"
-	"github.com/hitokoto-osc/notification-worker/mail"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	"github.com/hitokoto-osc/notification-worker/utils/validator"
@@ -41,16 +41,17 @@ func HitokotoPollDailyReportEvent() *rabbitmq.ConsumerRegisterOptions {
 			Tag:        "HitokotoPollDailyReportNotificationWorker",
 			AckByError: true,
 		},
-		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		Retry: notificationRetry("hitokoto_poll_daily_report"),
+		CallFunc: idempotency.Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Debug("[hitokoto_poll_daily_report]收到消息: ", zap.ByteString("body", delivery.Body))
 			message, err := validator.UnmarshalV[model.PollDailyReportMessage](ctx, delivery.Body)
 			if err != nil {
-				return errors.Wrap(err, "解析消息失败")
+				return rabbitmq.Permanent(errors.Wrap(err, "解析消息失败"))
 			}
 
-			html, err := django.RenderTemplate("email/poll_daily_report", django.Context{
+			html, text, err := django.RenderMail("email/poll_daily_report", django.Context{
 				"username":   message.Username,
 				"created_at": message.CreatedAt.Format("Y-m-d H:i:s"),
 				"system": django.Context{
@@ -77,15 +78,16 @@ func HitokotoPollDailyReportEvent() *rabbitmq.ConsumerRegisterOptions {
 			if err != nil {
 				return errors.Wrap(err, "无法渲染模板")
 			}
-			err = mail.SendSingle(ctx, &mailer.Mailer{
+			return sendMail(ctx, &mailer.Mailer{
 				Type: mailer.TypeNormal,
 				Mail: mailer.Mail{
 					To:      []string{message.To},
 					Subject: "喵！今日份的投票报告来了！",
 					Body:    html,
+					Text:    text,
 				},
+				Meta: mailer.Meta{Kind: "hitokoto_poll_daily_report", Template: "email/poll_daily_report"},
 			})
-			return err
-		},
+		}),
 	}
 }
@@ -2,11 +2,11 @@ package v1
 
 import (
 	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/consumers/idempotency"
 	"github.com/hitokoto-osc/notification-worker/consumers/notification/v1/internal/model"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/django"
 	"github.com/hitokoto-osc/notification-worker/logging"
-	"github.com/hitokoto-osc/notification-worker/mail"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	"github.com/hitokoto-osc/notification-worker/utils/formatter"
@@ -43,17 +43,18 @@ func HitokotoPollFinishedEvent() *rabbitmq.ConsumerRegisterOptions {
 			Tag:        "HitokotoPollFinishedNotificationWorker",
 			AckByError: true,
 		},
-		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		Retry: notificationRetry("hitokoto_poll_finished"),
+		CallFunc: idempotency.Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Debug("[hitokoto_poll_finished]收到消息:", zap.ByteString("body", delivery.Body))
 			// 解析消息
 			message, err := validator.UnmarshalV[model.PollFinishedMessage](ctx, delivery.Body)
 			if err != nil {
-				return errors.Wrap(err, "解析消息失败")
+				return rabbitmq.Permanent(errors.Wrap(err, "解析消息失败"))
 			}
 			// 渲染模板
-			html, err := django.RenderTemplate("email/poll_finished", django.Context{
+			html, text, err := django.RenderMail("email/poll_finished", django.Context{
 				"username":    message.Username,
 				"poll_id":     message.PollID,
 				"operated_at": message.UpdatedAt.Format("Y-m-d H:i:s"),
@@ -69,15 +70,18 @@ func HitokotoPollFinishedEvent() *rabbitmq.ConsumerRegisterOptions {
 			if err != nil {
 				return errors.Wrap(err, "无法渲染模板")
 			}
-			err = mail.SendSingle(ctx, &mailer.Mailer{
+			m := &mailer.Mailer{
 				Type: mailer.TypeNormal,
 				Mail: mailer.Mail{
 					To:      []string{message.To},
 					Subject: "喵！投票结果出炉了！",
 					Body:    html,
+					Text:    text,
 				},
-			})
-			return err
-		},
+				Meta: mailer.Meta{Kind: "hitokoto_poll_finished", Template: "email/poll_finished", Ref: message.UUID},
+			}
+			m.Mail.Thread(sentenceThread(message.UUID, "poll_finished", strconv.Itoa(message.PollID)))
+			return sendMail(ctx, m)
+		}),
 	}
 }
@@ -2,11 +2,11 @@ package v1
 
 import (
 	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/consumers/idempotency"
 	"github.com/hitokoto-osc/notification-worker/consumers/notification/v1/internal/model"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
 	"github.com/hitokoto-osc/notification-worker/django"
 	"github.com/hitokoto-osc/notification-worker/logging"
-	"github.com/hitokoto-osc/notification-worker/mail"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
 	"github.com/hitokoto-osc/notification-worker/utils/formatter"
@@ -42,15 +42,16 @@ func HitokotoReviewedEvent() *rabbitmq.ConsumerRegisterOptions {
 			Tag:        "HitokotoReviewedNotificationWorker",
 			AckByError: true,
 		},
-		CallFunc: func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
+		Retry: notificationRetry("hitokoto_reviewed"),
+		CallFunc: idempotency.Wrap(func(ctx rabbitmq.Ctx, delivery amqp.Delivery) error {
 			logger := logging.WithContext(ctx)
 			defer logger.Sync()
 			logger.Debug("[hitokoto_reviewed] 收到消息:", zap.ByteString("body", delivery.Body))
 			message, err := validator.UnmarshalV[model.HitokotoReviewedMessage](ctx, delivery.Body)
 			if err != nil {
-				return errors.Wrap(err, "无法解析消息体")
+				return rabbitmq.Permanent(errors.Wrap(err, "无法解析消息体"))
 			}
-			html, err := django.RenderTemplate("email/hitokoto_reviewed", django.Context{
+			html, text, err := django.RenderMail("email/hitokoto_reviewed", django.Context{
 				"username":      message.Creator,
 				"created_at":    message.CreatedAt.Format("Y-m-d H:i:s"),
 				"hitokoto":      message.Hitokoto,
@@ -65,15 +66,18 @@ func HitokotoReviewedEvent() *rabbitmq.ConsumerRegisterOptions {
 			if err != nil {
 				return errors.Wrap(err, "渲染模板失败")
 			}
-			err = mail.SendSingle(ctx, &mailer.Mailer{
+			m := &mailer.Mailer{
 				Type: mailer.TypeNormal,
 				Mail: mailer.Mail{
 					To:      []string{message.To},
 					Subject: "喵！您的句子审核结果出来了！",
 					Body:    html,
+					Text:    text,
 				},
-			})
-			return err
-		},
+				Meta: mailer.Meta{Kind: "hitokoto_reviewed", Template: "email/hitokoto_reviewed", Ref: message.UUID},
+			}
+			m.Mail.Thread(sentenceThread(message.UUID, "reviewed", message.OperatedAt.Format("YmdHis")))
+			return sendMail(ctx, m)
+		}),
 	}
 }
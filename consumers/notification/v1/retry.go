@@ -0,0 +1,28 @@
+package v1
+
+import (
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+)
+
+// deadLetterCan 不可恢复的通知死信桶，由 HitokotoFailedMessageCanEvent 处理
+var deadLetterCan = rabbitmq.DelayTarget{
+	Exchange:   "notification_failed",
+	Queue:      "notification_failed_can",
+	RoutingKey: "notification_failed.notification_failed_can",
+}
+
+// notificationRetry 返回队列 queue 对应消费者的重试策略，各项读取 retry.<queue>，未配置时使用 retry.default。
+// 消费者在 init 中注册，早于配置解析，因此策略在配置解析后才填充
+func notificationRetry(queue string) *rabbitmq.RetryPolicy {
+	p := &rabbitmq.RetryPolicy{DeadLetter: deadLetterCan}
+	config.RegisterCallback(func() {
+		c := config.Retry(queue)
+		p.MaxAttempts = c.MaxAttempts()
+		p.Backoff = c.Backoff()
+		p.Multiplier = c.Multiplier()
+		p.MaxBackoff = c.MaxBackoff()
+		p.Jitter = c.Jitter()
+	})
+	return p
+}
@@ -0,0 +1,45 @@
+package v1
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"go.uber.org/zap"
+)
+
+// sendMail 发送邮件，并将服务商返回的邮件 ID 与 trace_id 记录在同一条日志中，便于对照服务商控制台排查。
+// 驱动返回的永久错误（例如收件人地址无效）会标记为永久错误，消息不再重试。
+func sendMail(ctx context.Context, m *mailer.Mailer) error {
+	result, err := mail.SendSingle(ctx, m)
+	if err != nil {
+		if mailer.IsPermanent(err) {
+			return rabbitmq.Permanent(err)
+		}
+		return err
+	}
+	if result == nil { // result 为空表示收件人均被抑制，已由 mail 包记录
+		return nil
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	logger.Info("邮件已发送",
+		zap.String("kind", m.Meta.Kind),
+		zap.String("template", m.Meta.Template),
+		zap.String("provider", result.Provider),
+		zap.String("message_id", result.MessageID),
+		zap.String("request_id", result.RequestID),
+		zap.Strings("accepted", result.Accepted),
+		zap.Duration("latency", result.Latency),
+	)
+	// 按收件人域名拆分发送时部分驱动失败，已发送的部分不能重发，失败的收件人不再重试
+	for _, v := range result.Failed {
+		logger.Warn("部分收件人发送失败，不再重试",
+			zap.String("kind", m.Meta.Kind),
+			zap.String("recipient", v.To),
+			zap.Error(v.Err),
+		)
+	}
+	return nil
+}
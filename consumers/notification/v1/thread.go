@@ -0,0 +1,15 @@
+package v1
+
+import (
+	"github.com/hitokoto-osc/notification-worker/consts"
+	"strings"
+)
+
+// sentenceThread 返回句子通知所属会话的根 Message-ID 与本通知的 Message-ID（均不含尖括号）。
+// 根是以句子 UUID 生成的虚拟 Message-ID，同一句子的投稿、审核、移动与投票通知都引用它，
+// 从而在收件箱中归为同一会话；parts 用于区分同一句子的不同通知，保证重试时 Message-ID 不变。
+func sentenceThread(uuid string, parts ...string) (root, id string) {
+	root = uuid + "@" + consts.SiteDomain
+	id = strings.Join(append([]string{uuid}, parts...), ".") + "@" + consts.SiteDomain
+	return root, id
+}
@@ -11,3 +11,14 @@ func Register(config *rabbitmq.ConsumerRegisterOptions) {
 func Get() []*rabbitmq.ConsumerRegisterOptions {
 	return instances
 }
+
+var queues []*rabbitmq.QueueRegisterOptions
+
+// RegisterQueue 注册没有消费者的队列，例如死信桶，启动时会声明并绑定
+func RegisterQueue(config *rabbitmq.QueueRegisterOptions) {
+	queues = append(queues, config)
+}
+
+func Queues() []*rabbitmq.QueueRegisterOptions {
+	return queues
+}
@@ -1,14 +1,20 @@
 package consumers
 
 import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/alert"
 	"github.com/hitokoto-osc/notification-worker/config"
+	_ "github.com/hitokoto-osc/notification-worker/consumers/deadletter"
 	_ "github.com/hitokoto-osc/notification-worker/consumers/notification/v1"
 	"github.com/hitokoto-osc/notification-worker/consumers/provider"
+	"github.com/hitokoto-osc/notification-worker/mail/webhook"
 	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"github.com/hitokoto-osc/notification-worker/storage"
 	"go.uber.org/zap"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func Run() {
@@ -29,11 +35,22 @@ func Run() {
 		Username: c.User(),
 		Password: c.Pass(),
 		Vhost:    c.VHost(),
+
+		DelayedExchange: c.DelayedExchange(),
 	}, logger.Sugar())
+	// 启动时检查内嵌数据库能否打开，之后只在事务期间打开，CLI 可以在 worker 运行期间使用
+	if err := storage.Open(); err != nil {
+		logger.Fatal("无法打开内嵌数据库", zap.Error(err))
+	}
 	if err := instance.Init(); err != nil {
 		logger.Fatal("无法启动实例", zap.Error(err))
 	}
 
+	for _, v := range provider.Queues() {
+		if err := instance.DeclareQueue(*v); err != nil {
+			logger.Fatal("无法声明队列", zap.String("queue", v.Queue.Name), zap.Error(err))
+		}
+	}
 	// 注册接收器
 	options := provider.Get()
 	logger.Info("开始注册消息接收器...")
@@ -42,6 +59,11 @@ func Run() {
 	}
 	handleErr(instance.ConsumerSubscribe())
 	logger.Info("已注册消息接收器，开始处理消息。")
+	if config.Webhook().Enabled() {
+		if err := webhook.Serve(); err != nil {
+			logger.Fatal("无法启动投递状态回调服务", zap.Error(err))
+		}
+	}
 	signalIntHandler(instance)
 	instance.RegisterCloseHandler(func(err error) {
 		defer logger.Sync()
@@ -65,10 +87,19 @@ func signalIntHandler(instance *rabbitmq.Instance) {
 	go func() {
 		<-c
 		zap.L().Info("接收到中断信号，开始关闭服务。")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := webhook.Shutdown(ctx); err != nil {
+			zap.L().Error("关闭投递状态回调服务失败。", zap.Error(err))
+		}
+		alert.Flush(ctx) // 发送当前窗口内尚未发送的死信告警
+		cancel()
 		err := instance.Shutdown()
 		if err != nil {
 			zap.L().Fatal("关闭服务失败。", zap.Error(err))
 		}
+		if err = storage.Close(); err != nil {
+			zap.L().Error("关闭内嵌数据库失败。", zap.Error(err))
+		}
 		zap.L().Info("优雅退出已完成。")
 	}()
 }
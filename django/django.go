@@ -7,9 +7,11 @@ import (
 	"github.com/hitokoto-osc/notification-worker/consts"
 	"github.com/samber/lo"
 	"go.uber.org/zap"
+	"io/fs"
 	"net/http"
 	"os"
 	"path"
+	"strings"
 )
 
 type Context = pongo2.Context
@@ -17,6 +19,8 @@ type Context = pongo2.Context
 var (
 	// instance is the pongo2 template set instance.
 	instance *pongo2.TemplateSet
+	// templateFS is the filesystem which templates are loaded from.
+	templateFS fs.FS
 )
 
 // init initializes pongo2 template loader.
@@ -26,10 +30,11 @@ func init() {
 	defer zap.L().Sync()
 	var err error
 	tplPublicDir := path.Join(must[string](executablePath), "resources/")
-	loader, err := pongo2.NewHttpFileSystemLoader(http.FS(priorityFS{
+	templateFS = priorityFS{
 		embeddedFS,
 		os.DirFS(tplPublicDir),
-	}), "template")
+	}
+	loader, err := pongo2.NewHttpFileSystemLoader(http.FS(templateFS), "template")
 	if err != nil {
 		zap.L().Fatal("failed to init pongo2 template loader", zap.Error(err))
 	}
@@ -86,3 +91,37 @@ func RenderTemplate(name string, ctx Context) (string, error) {
 	}
 	return tpl.Execute(MergeContext(instance.Globals, runtimeGlobals(), ctx))
 }
+
+// Exists reports whether the template exists, name has the same form as in RenderTemplate.
+func Exists(name string) bool {
+	_, err := fs.Stat(templateFS, path.Join("template", name+".django"))
+	return err == nil
+}
+
+// RenderMail renders an email template and its optional plain-text sibling.
+// For "email/foo", the HTML part is rendered from "email/foo.django" and the text part from "email/foo.txt.django".
+// If the sibling does not exist, text is empty and the mail package derives it from the HTML.
+func RenderMail(name string, ctx Context) (html, text string, err error) {
+	if html, err = RenderTemplate(name, ctx); err != nil {
+		return "", "", err
+	}
+	if _, err = fs.Stat(templateFS, path.Join("template", name+".txt.django")); err != nil {
+		return html, "", nil
+	}
+	if text, err = RenderTemplate(name+".txt", ctx); err != nil {
+		return "", "", err
+	}
+	return html, text, nil
+}
+
+// RenderSubject renders the optional subject sibling of an email template, e.g. "email/foo.subject.django" for "email/foo".
+// Surrounding whitespace is trimmed; if the sibling does not exist, subject is empty.
+func RenderSubject(name string, ctx Context) (subject string, err error) {
+	if !Exists(name + ".subject") {
+		return "", nil
+	}
+	if subject, err = RenderTemplate(name+".subject", ctx); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(subject), nil
+}
@@ -0,0 +1,27 @@
+package django
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRenderMail(t *testing.T) {
+	ctx := Context{
+		"username":      "a632079",
+		"hitokoto":      "人生若只如初见",
+		"from":          "木兰词",
+		"review_result": "驳回",
+	}
+	html, text, err := RenderMail("email/hitokoto_reviewed", ctx)
+	require.NoError(t, err)
+	assert.Contains(t, html, "<b>人生若只如初见</b>")
+	assert.Contains(t, text, "    人生若只如初见\n")
+	assert.Contains(t, text, "查看审核意见")
+	assert.NotContains(t, text, "<")
+
+	html, text, err = RenderMail("email/hitokoto_appended", ctx)
+	require.NoError(t, err)
+	assert.Contains(t, html, "人生若只如初见")
+	assert.Empty(t, text, "没有 .txt.django 模板时应返回空的纯文本正文")
+}
@@ -3,6 +3,7 @@ package flags
 import (
 	"flag"
 	"fmt"
+	"github.com/hitokoto-osc/notification-worker/cli"
 	"github.com/hitokoto-osc/notification-worker/config"
 	"os"
 )
@@ -25,4 +26,8 @@ func Do() {
 		)
 		os.Exit(0)
 	}
+	// 带有位置参数时作为管理子命令执行，例如 notification-worker suppression list
+	if flag.NArg() > 0 {
+		os.Exit(cli.Run(flag.Args()))
+	}
 }
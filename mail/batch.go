@@ -0,0 +1,180 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"go.uber.org/zap"
+)
+
+// SendBatch 批量发送模板邮件。驱动实现了 mailer.BatchSender 时按其上限分批请求，否则逐个调用 SendSingle。
+// 返回的结果与 b.Recipients 一一对应；存在发送失败的收件人时，同时返回合并后的错误。
+// 非生产环境的 rewrite 模式下改为逐个发送，以便在每封邮件中保留原始收件人。
+// 与 SendSingle 相同，按通知类型填充发件人身份，并为每个收件人写入发送日志。
+func SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	applyBatchIdentity(b)
+	results, err := sendFiltered(ctx, b)
+	recordBatch(ctx, b, results, err)
+	return results, err
+}
+
+// sendFiltered 跳过抑制列表中的收件人与非生产环境中白名单以外的收件人后发送
+func sendFiltered(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	skipped := make(map[string]string) // 被跳过的收件人及原因
+	for address, e := range checkSuppressed(ctx, batchAddresses(b)) {
+		skipped[address] = skipReason(e)
+	}
+	if stagingMode() == stagingAllowlist {
+		for _, address := range batchAddresses(b) {
+			if _, ok := skipped[address]; !ok && !allowed(address) {
+				logging.WithContext(ctx).Info("[mail.staging] 非生产环境，丢弃白名单以外的收件人", zap.String("address", address))
+				skipped[address] = stagingSkipReason
+			}
+		}
+	}
+	send := func(b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+		if config.DryRun().Enabled() {
+			return dryRunBatch(ctx, b)
+		}
+		if stagingMode() == stagingRewrite {
+			return sendRewritten(ctx, instance, b)
+		}
+		return sendBatch(ctx, instance, b)
+	}
+	if len(skipped) == 0 {
+		return send(b)
+	}
+	filtered := *b
+	filtered.Recipients = make([]*mailer.Recipient, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		if _, ok := skipped[r.To]; !ok {
+			filtered.Recipients = append(filtered.Recipients, r)
+		}
+	}
+	sent, err := send(&filtered)
+	if len(sent) != len(filtered.Recipients) {
+		return nil, err
+	}
+	// 按原始顺序合并被跳过的收件人
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		if reason, ok := skipped[r.To]; ok {
+			results = append(results, &mailer.RecipientResult{To: r.To, Skipped: reason})
+			continue
+		}
+		results = append(results, sent[0])
+		sent = sent[1:]
+	}
+	return results, err
+}
+
+// sendRewritten 逐个发送批量邮件，每封邮件的收件人都改写为 staging.catch_all
+func sendRewritten(ctx context.Context, sender mailer.Sender, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	if b.Template == nil || b.Template.ID == "" {
+		return nil, errors.New("批量邮件缺少模板 ID")
+	}
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		err := ctx.Err()
+		if err == nil {
+			m := b.Mailer(r)
+			rewriteRecipients(ctx, m)
+			_, err = sendLocal(ctx, sender, m)
+		}
+		results = append(results, &mailer.RecipientResult{To: r.To, Err: err})
+	}
+	return results, combineErrors(results)
+}
+
+func batchAddresses(b *mailer.Batch) []string {
+	addresses := make([]string, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		addresses = append(addresses, r.To)
+	}
+	return addresses
+}
+
+func sendBatch(ctx context.Context, sender mailer.Sender, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	if b.Template == nil || b.Template.ID == "" {
+		return nil, errors.New("批量邮件缺少模板 ID")
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	batchSender, ok := sender.(mailer.BatchSender)
+	size := 1
+	if ok {
+		size = max(batchSender.MaxBatchSize(), 1)
+	}
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for start := 0; start < len(b.Recipients); start += size {
+		chunk := *b
+		chunk.Recipients = b.Recipients[start:min(start+size, len(b.Recipients))]
+		if err := ctx.Err(); err != nil {
+			results = append(results, failAll(&chunk, err)...)
+			continue
+		}
+		if !ok {
+			results = append(results, sendEach(ctx, sender, &chunk)...)
+			continue
+		}
+		r, err := batchSender.SendBatch(ctx, &chunk)
+		switch {
+		case errors.Is(err, mailer.ErrBatchUnsupported):
+			logger.Debug("[mail.batch] 驱动无法批量发送，改为逐个发送", zap.Error(err))
+			r = sendEach(ctx, sender, &chunk)
+		case err != nil:
+			r = failAll(&chunk, err)
+		}
+		results = append(results, r...)
+	}
+	return results, combineErrors(results)
+}
+
+// combineErrors 合并发送失败的收件人的错误
+func combineErrors(results []*mailer.RecipientResult) error {
+	var errs error
+	for _, v := range results {
+		if v.Err != nil {
+			errs = errors.CombineErrors(errs, errors.Wrapf(v.Err, "收件人 %s 发送失败", v.To))
+		}
+	}
+	return errs
+}
+
+// sendEach 逐个发送批量邮件。Template.ID 在逐个发送时表示本地模板，驱动不支持模板邮件且本地不存在该模板时，
+// 整批直接失败，而不是将同名模板交给驱动
+func sendEach(ctx context.Context, sender mailer.Sender, b *mailer.Batch) []*mailer.RecipientResult {
+	if !mailer.CapabilitiesOf(sender).Templates {
+		if _, err := localTemplate(b.Template.ID); err != nil {
+			return failAll(b, err)
+		}
+	}
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		err := ctx.Err()
+		if err == nil {
+			_, err = sendLocal(ctx, sender, b.Mailer(r))
+		}
+		results = append(results, &mailer.RecipientResult{To: r.To, Err: err})
+	}
+	return results
+}
+
+// sendLocal 逐个发送时，驱动不支持模板邮件则先在本地渲染
+func sendLocal(ctx context.Context, sender mailer.Sender, m *mailer.Mailer) (*mailer.Result, error) {
+	if err := renderTemplate(sender, m); err != nil {
+		return nil, err
+	}
+	fillText(m)
+	return sender.SendSingle(ctx, m)
+}
+
+func failAll(b *mailer.Batch, err error) []*mailer.RecipientResult {
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		results = append(results, &mailer.RecipientResult{To: r.To, Err: err})
+	}
+	return results
+}
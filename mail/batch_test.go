@@ -0,0 +1,153 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/mail/suppression"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+type fakeBatchSender struct {
+	fakeSender
+	size    int
+	err     error
+	batches [][]string
+	from    []string
+}
+
+func (f *fakeBatchSender) MaxBatchSize() int {
+	return f.size
+}
+
+func (f *fakeBatchSender) SendBatch(_ context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var to []string
+	var results []*mailer.RecipientResult
+	for _, r := range b.Recipients {
+		to = append(to, r.To)
+		results = append(results, &mailer.RecipientResult{To: r.To})
+	}
+	f.batches = append(f.batches, to)
+	f.from = append(f.from, b.From)
+	return results, nil
+}
+
+func testBatch(n int) *mailer.Batch {
+	b := &mailer.Batch{Template: &mailer.Template{ID: "poll_daily_report"}}
+	for i := 0; i < n; i++ {
+		b.Recipients = append(b.Recipients, &mailer.Recipient{To: string(rune('a'+i)) + "@example.com"})
+	}
+	return b
+}
+
+func TestSendBatchChunks(t *testing.T) {
+	s := &fakeBatchSender{size: 2}
+	results, err := sendBatch(context.Background(), s, testBatch(5))
+	require.NoError(t, err)
+	assert.Len(t, results, 5)
+	assert.Equal(t, [][]string{
+		{"a@example.com", "b@example.com"},
+		{"c@example.com", "d@example.com"},
+		{"e@example.com"},
+	}, s.batches)
+	assert.Equal(t, 0, s.calls)
+}
+
+func TestSendBatchFallsBackToSendSingle(t *testing.T) {
+	s := &fakeBatchSender{size: 10, err: errors.Wrap(mailer.ErrBatchUnsupported, "unsupported variable")}
+	results, err := sendBatch(context.Background(), s, testBatch(3))
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, 3, s.calls)
+
+	plain := &fakeSender{err: errors.New("invalid address")}
+	results, err = sendBatch(context.Background(), plain, testBatch(2))
+	assert.Error(t, err)
+	assert.Equal(t, 2, plain.calls)
+	for _, v := range results {
+		assert.Error(t, v.Err)
+	}
+}
+
+func TestSendBatchRejectsUnknownLocalTemplate(t *testing.T) {
+	s := &fakeBatchSender{size: 10, err: mailer.ErrBatchUnsupported}
+	b := testBatch(2)
+	b.Template.ID = "provider_only_template"
+	results, err := sendBatch(context.Background(), s, b)
+	assert.Error(t, err)
+	assert.Equal(t, 0, s.calls, "本地不存在的模板不应交给 SendSingle")
+	for _, v := range results {
+		assert.True(t, mailer.IsPermanent(v.Err))
+	}
+}
+
+func TestBatchData(t *testing.T) {
+	b := &mailer.Batch{Template: &mailer.Template{ID: "x", Data: map[string]interface{}{"site": "hitokoto", "name": "?"}}}
+	m := b.Mailer(&mailer.Recipient{To: "a@example.com", Data: map[string]interface{}{"name": "a632079"}})
+	assert.Equal(t, mailer.TypeTemplate, m.Type)
+	assert.Equal(t, []string{"a@example.com"}, m.Mail.To)
+	assert.Equal(t, map[string]interface{}{"site": "hitokoto", "name": "a632079"}, m.Template.Data)
+}
+
+func TestFilterSuppressed(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { storage.SetPath("") })
+	_, err := suppression.Add("bounced@example.com", suppression.KindHardBounce, "550", "test")
+	require.NoError(t, err)
+
+	m := &mailer.Mailer{Mail: mailer.Mail{
+		To:  []string{"bounced@example.com", "ok@example.com"},
+		BCC: []string{"Bounced <bounced@example.com>"},
+	}}
+	assert.True(t, filterSuppressed(context.Background(), m))
+	assert.Equal(t, []string{"ok@example.com"}, m.Mail.To)
+	assert.Empty(t, m.Mail.BCC)
+
+	m = &mailer.Mailer{Mail: mailer.Mail{To: []string{"bounced@example.com"}}}
+	assert.False(t, filterSuppressed(context.Background(), m), "所有收件人被抑制时应跳过发送")
+
+	s := &fakeBatchSender{size: 10}
+	instance = s
+	t.Cleanup(func() { instance = nil })
+	b := testBatch(2)
+	b.Recipients = append(b.Recipients, &mailer.Recipient{To: "bounced@example.com"})
+	results, err := SendBatch(context.Background(), b)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Empty(t, results[0].Skipped)
+	assert.NotEmpty(t, results[2].Skipped)
+	assert.Equal(t, [][]string{{"a@example.com", "b@example.com"}}, s.batches)
+}
+
+func TestSendBatchIdentityAndSendLog(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { storage.SetPath("") })
+	viper.Set("mail.identities.hitokoto_poll_daily_report.from", "poll@mail.hitokoto.cn")
+	t.Cleanup(func() { viper.Set("mail.identities.hitokoto_poll_daily_report", nil) })
+	s := &fakeBatchSender{size: 10}
+	instance = s
+	t.Cleanup(func() { instance = nil })
+
+	b := testBatch(2)
+	b.Meta = mailer.Meta{Kind: "hitokoto_poll_daily_report", Ref: "poll-1"}
+	_, err := SendBatch(context.Background(), b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"<poll@mail.hitokoto.cn>"}, s.from, "批量邮件应使用通知类型对应的发件人")
+
+	records, err := sendlog.Search(sendlog.Query{Ref: "poll-1"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	for _, r := range records {
+		assert.Equal(t, sendlog.OutcomeSent, r.Outcome)
+		assert.Equal(t, "poll_daily_report", r.Template)
+	}
+}
@@ -0,0 +1,212 @@
+package alicloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	dm "github.com/alibabacloud-go/dm-20151123/v2/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"go.uber.org/zap"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+const (
+	// receiverPrefix 临时收件人列表的名称前缀
+	receiverPrefix = "notification-"
+	// receiverRetention 临时收件人列表在发送后保留的时间，需长于阿里云执行批量发送任务的时间
+	receiverRetention = 24 * time.Hour
+	// cleanupInterval 清理过期收件人列表的最小间隔
+	cleanupInterval = time.Hour
+)
+
+// receiverFields 阿里云收件人列表支持的变量及其在 SaveReceiverDetail 中的字段名
+var receiverFields = map[string]string{
+	"username": "u",
+	"nickname": "n",
+	"gender":   "g",
+	"birthday": "b",
+	"mobile":   "m",
+}
+
+// MaxBatchSize SaveReceiverDetail 单次最多保存 500 个收件人
+func (t *DM) MaxBatchSize() int {
+	return 500
+}
+
+// SendBatch 创建临时收件人列表并调用 BatchSendMail 发送，Template.ID 为控制台中的模板名称，
+// 逐个发送时会以同名的本地模板渲染，因此两处的模板需保持一致。
+// 阿里云只支持收件人列表中的固定变量（见 receiverFields），且邮件主题由控制台模板决定；
+// 存在其他变量或指定了 Subject 时返回 mailer.ErrBatchUnsupported。
+// BatchSendMail 只创建异步任务，任务执行时才读取收件人列表，因此列表在发送后保留 receiverRetention，
+// 由之后的批量发送清理（见 cleanupReceivers）。
+func (t *DM) SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	if b.Subject != "" {
+		return nil, errors.Wrap(mailer.ErrBatchUnsupported, "阿里云批量发送不支持指定邮件主题")
+	}
+	details := make([]map[string]string, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		detail := map[string]string{"e": r.To}
+		for k, v := range b.Data(r) {
+			field, ok := receiverFields[k]
+			if !ok {
+				return nil, errors.Wrapf(mailer.ErrBatchUnsupported, "阿里云收件人列表不支持变量：%s", k)
+			}
+			detail[field] = fmt.Sprint(v)
+		}
+		details = append(details, detail)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	account, _, err := sender(b.From)
+	if err != nil {
+		return nil, err
+	}
+	var replyTo *mail.Address
+	if b.ReplyTo != "" {
+		if replyTo, err = mail.ParseAddress(b.ReplyTo); err != nil {
+			return nil, errors.Wrap(err, "无法解析回复地址")
+		}
+	}
+	t.cleanupReceivers(ctx)
+	name := receiverPrefix + uuid.NewString()[:8]
+	domain := account[strings.LastIndex(account, "@")+1:]
+	var created *dm.CreateReceiverResponse
+	err = t.call(ctx, func(options *util.RuntimeOptions) (err error) {
+		created, err = t.client.CreateReceiverWithOptions(new(dm.CreateReceiverRequest).
+			SetReceiversName(name).
+			SetReceiversAlias(name+"@"+domain).
+			SetDesc("notification-worker 批量邮件"), options)
+		return classify(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "无法创建阿里云收件人列表")
+	}
+	receiverId := tea.StringValue(created.Body.ReceiverId)
+	detail, err := json.Marshal(details)
+	if err != nil {
+		t.deleteReceiver(ctx, receiverId)
+		return nil, errors.Wrap(err, "无法编码收件人列表")
+	}
+	var saved *dm.SaveReceiverDetailResponse
+	err = t.call(ctx, func(options *util.RuntimeOptions) (err error) {
+		saved, err = t.client.SaveReceiverDetailWithOptions(new(dm.SaveReceiverDetailRequest).
+			SetReceiverId(receiverId).
+			SetDetail(string(detail)), options)
+		return classify(err)
+	})
+	if err != nil {
+		// 列表尚未被发送任务使用，可以立即删除
+		t.deleteReceiver(ctx, receiverId)
+		return nil, errors.Wrap(err, "无法保存阿里云收件人列表")
+	}
+	// 保存失败的收件人不会收到邮件
+	rejected := make(map[string]bool)
+	if saved.Body.Data != nil {
+		for _, v := range saved.Body.Data.Detail {
+			rejected[tea.StringValue(v.Email)] = true
+		}
+	}
+	req := new(dm.BatchSendMailRequest).
+		SetAccountName(account).
+		SetAddressType(1).
+		SetTemplateName(b.Template.ID).
+		SetReceiversName(name)
+	if b.Tag != "" {
+		req.SetTagName(b.Tag)
+	}
+	if replyTo != nil {
+		req.SetReplyAddress(replyTo.Address).SetReplyAddressAlias(replyTo.Name)
+	}
+	err = t.call(ctx, func(options *util.RuntimeOptions) error {
+		_, err := t.client.BatchSendMailWithOptions(req, options)
+		return classify(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "阿里云批量发送请求失败")
+	}
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		result := &mailer.RecipientResult{To: r.To}
+		if rejected[r.To] {
+			result.Err = errors.Newf("阿里云拒绝了收件人：%s", r.To)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// deleteReceiver 删除临时收件人列表。ctx 已结束时仍会尝试删除，失败时只记录日志，
+// 残留的列表会由 cleanupReceivers 清理
+func (t *DM) deleteReceiver(ctx context.Context, id string) {
+	if id == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	err := t.call(ctx, func(options *util.RuntimeOptions) error {
+		_, err := t.client.DeleteReceiverWithOptions(new(dm.DeleteReceiverRequest).SetReceiverId(id), options)
+		return classify(err)
+	})
+	if err != nil {
+		logger := logging.WithContext(ctx)
+		defer logger.Sync()
+		logger.Warn("[aliyun] 无法删除临时收件人列表", zap.String("receiver_id", id), zap.Error(err))
+	}
+}
+
+// cleanupReceivers 删除创建时间超过 receiverRetention 的临时收件人列表，每个进程每小时至多执行一次。
+// 每次只处理一页查询结果，残留较多时会在之后的批量发送中逐步清理；失败只记录日志，不影响本次发送
+func (t *DM) cleanupReceivers(ctx context.Context) {
+	t.cleanupMu.Lock()
+	if time.Since(t.lastCleanup) < cleanupInterval {
+		t.cleanupMu.Unlock()
+		return
+	}
+	t.lastCleanup = time.Now()
+	t.cleanupMu.Unlock()
+
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	var resp *dm.QueryReceiverByParamResponse
+	err := t.call(ctx, func(options *util.RuntimeOptions) (err error) {
+		resp, err = t.client.QueryReceiverByParamWithOptions(new(dm.QueryReceiverByParamRequest).
+			SetKeyWord(receiverPrefix).
+			SetPageSize(50), options)
+		return classify(err)
+	})
+	if err != nil {
+		logger.Warn("[aliyun] 无法查询临时收件人列表", zap.Error(err))
+		return
+	}
+	if resp.Body == nil || resp.Body.Data == nil {
+		return
+	}
+	for _, v := range resp.Body.Data.Receiver {
+		if !strings.HasPrefix(tea.StringValue(v.ReceiversName), receiverPrefix) {
+			continue
+		}
+		if created, ok := receiverCreated(v); ok && time.Since(created) > receiverRetention {
+			t.deleteReceiver(ctx, tea.StringValue(v.ReceiverId))
+		}
+	}
+}
+
+// receiverCreated 返回收件人列表的创建时间
+func receiverCreated(v *dm.QueryReceiverByParamResponseBodyDataReceiver) (time.Time, bool) {
+	if ts, err := time.Parse(time.RFC3339, tea.StringValue(v.CreateTime)); err == nil {
+		return ts, true
+	}
+	if v.UtcCreateTime != nil {
+		return time.Unix(tea.Int64Value(v.UtcCreateTime), 0), true
+	}
+	return time.Time{}, false
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/hitokoto-osc/notification-worker/config"
 	"github.com/hitokoto-osc/notification-worker/mail/driver"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"sync"
+	"time"
 )
 
 var Instance *DM
@@ -25,6 +27,11 @@ type DM struct {
 	// Runtime variables
 	client  *dm.Client
 	options *util.RuntimeOptions
+	timeout time.Duration // 单次请求的超时时间
+	retry   retryPolicy
+
+	cleanupMu   sync.Mutex
+	lastCleanup time.Time // 上次清理临时收件人列表的时间
 }
 
 func NewAliCloudDM() *DM {
@@ -47,9 +54,14 @@ func (t *DM) Register() (mailer.Sender, error) {
 		return nil, err
 	}
 	t.client = client
-	t.options = new(util.RuntimeOptions).SetAutoretry(true).
-		SetMaxAttempts(5).
-		SetMaxIdleConns(3)
+	// 不使用 SDK 的自动重试，由 call 按上下文与重试策略重试
+	t.options = new(util.RuntimeOptions).SetAutoretry(false).SetMaxIdleConns(3)
+	t.timeout = config.Aliyun().DM().Timeout()
+	t.retry = retryPolicy{
+		maxAttempts: config.Aliyun().DM().RetryMaxAttempts(),
+		backoff:     config.Aliyun().DM().RetryBackoff(),
+		maxBackoff:  config.Aliyun().DM().RetryMaxBackoff(),
+	}
 
 	return t, nil
 }
@@ -0,0 +1,25 @@
+package alicloud
+
+import (
+	"github.com/alibabacloud-go/tea/tea"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"strings"
+)
+
+// classify 将限流与服务端 5xx 错误标记为暂时性错误，其余 4xx 错误（如收件人地址无效、发信地址不存在）标记为永久性错误。
+// 网络错误由 mailer.IsTemporary 识别为暂时性错误，无需标记。
+func classify(err error) error {
+	var e *tea.SDKError
+	if !errors.As(err, &e) {
+		return err
+	}
+	status := tea.IntValue(e.StatusCode)
+	switch {
+	case status >= 500 || strings.HasPrefix(tea.StringValue(e.Code), "Throttling"):
+		return mailer.Temporary(err)
+	case status >= 400:
+		return mailer.Permanent(err)
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package alicloud
+
+import (
+	"context"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"time"
+)
+
+// retryPolicy 暂时性错误的重试策略，取代 SDK 不感知上下文的自动重试
+type retryPolicy struct {
+	maxAttempts int           // 最大尝试次数，包括第一次请求
+	backoff     time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	maxBackoff  time.Duration
+}
+
+func (p *retryPolicy) wait(attempt int) time.Duration {
+	d := p.backoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if p.maxBackoff > 0 {
+		d = min(d, p.maxBackoff)
+	}
+	return d
+}
+
+// call 调用接口，fn 应返回经过 classify 的错误。
+// 每次尝试的超时时间取 t.timeout 与 ctx 剩余时间中的较小值；遇到暂时性错误时按 t.retry 重试，
+// ctx 被取消或超时后立即停止，不再等待正在进行的请求。
+func (t *DM) call(ctx context.Context, fn func(options *util.RuntimeOptions) error) error {
+	attempts := max(t.retry.maxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := t.attempt(ctx, fn)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !mailer.IsTemporary(err) || attempt >= attempts {
+			return err
+		}
+		timer := time.NewTimer(t.retry.wait(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.WithSecondaryError(errors.Wrap(ctx.Err(), "等待重试时上下文已结束"), err)
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *DM) attempt(ctx context.Context, fn func(options *util.RuntimeOptions) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	timeout := t.timeout
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline); timeout <= 0 || remaining < timeout {
+			timeout = remaining
+		}
+	}
+	options := *t.options
+	options.SetAutoretry(false)
+	if timeout > 0 {
+		ms := int(max(timeout.Milliseconds(), 1))
+		options.SetReadTimeout(ms).SetConnectTimeout(ms)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(&options)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
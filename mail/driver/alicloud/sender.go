@@ -3,45 +3,99 @@ package alicloud
 import (
 	"context"
 	dm "github.com/alibabacloud-go/dm-20151123/v2/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/alibabacloud-go/tea/tea"
 	"github.com/cockroachdb/errors"
 	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/mail"
 	"strings"
+	"time"
 )
 
-func (t *DM) SendSingle(ctx context.Context, m *mailer.Mailer) error {
+func (t *DM) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
 	switch m.Type {
 	case mailer.TypeNormal:
 		return t.SendNormalMail(ctx, m)
 	case mailer.TypeTemplate:
-		return errors.New("阿里云邮件推送服务不支持模板邮件")
+		return nil, errors.New("阿里云邮件推送服务不支持模板邮件")
 	default:
-		return errors.New("未知的邮件类型")
+		return nil, errors.New("未知的邮件类型")
 	}
 }
 
-func (t *DM) SendNormalMail(ctx context.Context, m *mailer.Mailer) error {
-	to := m.Mail.To
-	if len(to) == 0 {
-		return errors.New("收件人不能为空")
+// SendNormalMail 调用单一发信接口，发送结果中的 MessageID 为 EnvId，RequestID 为 RequestId
+func (t *DM) SendNormalMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if len(m.Mail.To) == 0 {
+		return nil, errors.New("收件人不能为空")
 	}
-	if len(m.Mail.CC) > 0 { // 阿里云不支持抄送
-		to = append(to, m.Mail.CC...)
+	if err := mailer.CheckAttachments(mailer.Capabilities{}, &m.Mail); err != nil { // 单一发信接口不支持附件
+		return nil, err
 	}
-	if len(m.Mail.BCC) > 0 { // 阿里云不支持密送
-		to = append(to, m.Mail.BCC...)
+	to := m.Mail.Recipients() // 阿里云不支持抄送与密送，均作为收件人
+	account, alias, err := sender(m.Mail.From)
+	if err != nil {
+		return nil, err
 	}
 	req := new(dm.SingleSendMailRequest)
-	req.SetAccountName(config.Aliyun().DM().Mail()).
+	req.SetAccountName(account).
 		SetAddressType(1).
-		SetFromAlias(config.Aliyun().DM().Name()).
+		SetFromAlias(alias).
 		SetReplyToAddress(true).
 		SetToAddress(strings.Join(to, ",")).
 		SetSubject(m.Mail.Subject).
 		SetHtmlBody(m.Mail.Body)
-	_, err := t.client.SingleSendMailWithOptions(req, t.options)
+	if m.Mail.Text != "" {
+		req.SetTextBody(m.Mail.Text)
+	}
+	if m.Mail.Tag != "" {
+		req.SetTagName(m.Mail.Tag)
+	}
+	// 单一发信接口不支持自定义邮件头，会话头部被忽略；指定回复地址时覆盖控制台中的回信地址
+	if m.Mail.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(m.Mail.ReplyTo)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析回复地址")
+		}
+		req.SetReplyToAddress(false).
+			SetReplyAddress(replyTo.Address).
+			SetReplyAddressAlias(replyTo.Name)
+	}
+	start := time.Now()
+	var resp *dm.SingleSendMailResponse
+	err = t.call(ctx, func(options *util.RuntimeOptions) (err error) {
+		resp, err = t.client.SingleSendMailWithOptions(req, options)
+		return classify(err)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "阿里云邮件推送服务请求失败")
+	}
+	result := &mailer.Result{
+		Provider: driver.TypeAliyun.String(),
+		Accepted: to,
+		Latency:  time.Since(start),
+	}
+	if resp != nil && resp.Body != nil {
+		result.MessageID = tea.StringValue(resp.Body.EnvId)
+		result.RequestID = tea.StringValue(resp.Body.RequestId)
+	}
+	return result, nil
+}
+
+// sender 返回发信地址与发信人昵称。指定发件人时使用其地址作为发信地址（需在控制台中创建），
+// 未指定名称时沿用默认的发信人昵称
+func sender(from string) (account, alias string, err error) {
+	account, alias = config.Aliyun().DM().Mail(), config.Aliyun().DM().Name()
+	if from == "" {
+		return account, alias, nil
+	}
+	address, err := mail.ParseAddress(from)
 	if err != nil {
-		return errors.Wrap(err, "阿里云邮件推送服务请求失败")
+		return "", "", errors.Wrap(err, "无法解析发件人")
+	}
+	if address.Name != "" {
+		alias = address.Name
 	}
-	return nil
+	return address.Address, alias, nil
 }
@@ -0,0 +1,227 @@
+package alicloud
+
+import (
+	"context"
+	"fmt"
+	rpc "github.com/alibabacloud-go/darabonba-openapi/v2/client"
+	dm "github.com/alibabacloud-go/dm-20151123/v2/client"
+	util "github.com/alibabacloud-go/tea-utils/v2/service"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDM 创建连接到 httptest 模拟接口的驱动，handler 收到的请求参数已解析到 r.Form
+func newTestDM(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *DM {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	c := new(rpc.Config)
+	c.SetAccessKeyId("id").
+		SetAccessKeySecret("secret").
+		SetEndpoint(strings.TrimPrefix(s.URL, "http://")).
+		SetRegionId("cn-hangzhou").
+		SetProtocol("http")
+	client, err := dm.NewClient(c)
+	require.NoError(t, err)
+	return &DM{client: client, options: new(util.RuntimeOptions)}
+}
+
+func TestSendNormalMailResult(t *testing.T) {
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "SingleSendMail", r.Header.Get("x-acs-action"))
+		assert.Equal(t, "a@example.com,bcc@example.com", r.Form.Get("ToAddress"))
+		_, _ = w.Write([]byte(`{"EnvId":"600000123456","RequestId":"2D086F6-3C0E-4A3B-9F0F-6E7A5C9B1D21"}`))
+	})
+	result, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      []string{"a@example.com"},
+			BCC:     []string{"bcc@example.com"},
+			Subject: "喵！您的句子审核结果出来了！",
+			Body:    "<p>hello</p>",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "aliyun", result.Provider)
+	assert.Equal(t, "600000123456", result.MessageID)
+	assert.Equal(t, "2D086F6-3C0E-4A3B-9F0F-6E7A5C9B1D21", result.RequestID)
+	assert.Equal(t, []string{"a@example.com", "bcc@example.com"}, result.Accepted)
+	assert.Positive(t, result.Latency)
+}
+
+func TestSendNormalMailIdentity(t *testing.T) {
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "poll@mail.hitokoto.cn", r.Form.Get("AccountName"))
+		assert.Equal(t, "一言投票", r.Form.Get("FromAlias"))
+		assert.Equal(t, "poll", r.Form.Get("TagName"))
+		_, _ = w.Write([]byte(`{"EnvId":"1","RequestId":"r-1"}`))
+	})
+	_, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			From:    `"一言投票" <poll@mail.hitokoto.cn>`,
+			To:      []string{"a@example.com"},
+			Subject: "s",
+			Body:    "b",
+			Tag:     "poll",
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestSendNormalMailThrottled(t *testing.T) {
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"Code":"Throttling.User","Message":"Request was denied due to user flow control.","RequestId":"r-1"}`))
+	})
+	result, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{To: []string{"a@example.com"}, Subject: "s", Body: "b"},
+	})
+	assert.Nil(t, result)
+	assert.True(t, mailer.IsTemporary(err))
+}
+
+func TestSendNormalMailRetry(t *testing.T) {
+	var calls atomic.Int32
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"Code":"ServiceUnavailable","Message":"busy","RequestId":"r-1"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"EnvId":"1","RequestId":"r-3"}`))
+	})
+	d.retry = retryPolicy{maxAttempts: 3, backoff: time.Millisecond}
+	result, err := d.SendSingle(context.Background(), testMail())
+	require.NoError(t, err)
+	assert.Equal(t, "r-3", result.RequestID)
+	assert.EqualValues(t, 3, calls.Load())
+}
+
+func TestSendNormalMailPermanent(t *testing.T) {
+	var calls atomic.Int32
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"Code":"InvalidToAddress","Message":"The specified toAddress is invalid.","RequestId":"r-1"}`))
+	})
+	d.retry = retryPolicy{maxAttempts: 3, backoff: time.Millisecond}
+	_, err := d.SendSingle(context.Background(), testMail())
+	assert.True(t, mailer.IsPermanent(err))
+	assert.False(t, mailer.IsTemporary(err))
+	assert.EqualValues(t, 1, calls.Load(), "永久性错误不应重试")
+}
+
+func TestSendNormalMailContext(t *testing.T) {
+	release := make(chan struct{})
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	t.Cleanup(func() { close(release) }) // 在关闭模拟接口之前释放阻塞的请求
+	d.retry = retryPolicy{maxAttempts: 5, backoff: time.Millisecond}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := d.SendSingle(ctx, testMail())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second, "上下文超时后应立即返回")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = d.SendSingle(ctx, testMail())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, mailer.IsTemporary(err))
+}
+
+func testMail() *mailer.Mailer {
+	return &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{To: []string{"a@example.com"}, Subject: "s", Body: "b"},
+	}
+}
+
+func TestRetryPolicyWait(t *testing.T) {
+	p := retryPolicy{backoff: time.Second, maxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.wait(1))
+	assert.Equal(t, 2*time.Second, p.wait(2))
+	assert.Equal(t, 4*time.Second, p.wait(3))
+	assert.Equal(t, 5*time.Second, p.wait(4))
+}
+
+func TestSendBatch(t *testing.T) {
+	var actions []string
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		action := r.Header.Get("x-acs-action")
+		actions = append(actions, action)
+		switch action {
+		case "QueryReceiverByParam":
+			assert.Equal(t, receiverPrefix, r.Form.Get("KeyWord"))
+			_, _ = w.Write([]byte(`{"data":{"receiver":[
+				{"ReceiverId":"stale","ReceiversName":"notification-stale","CreateTime":"2020-01-01T00:00:00Z"},
+				{"ReceiverId":"recent","ReceiversName":"notification-recent","UtcCreateTime":` + fmt.Sprint(time.Now().Unix()) + `},
+				{"ReceiverId":"other","ReceiversName":"newsletter","CreateTime":"2020-01-01T00:00:00Z"}
+			]},"RequestId":"r-0"}`))
+		case "CreateReceiver":
+			assert.True(t, strings.HasSuffix(r.Form.Get("ReceiversAlias"), "@mail.hitokoto.cn"))
+			_, _ = w.Write([]byte(`{"ReceiverId":"receiver-1","RequestId":"r-1"}`))
+		case "SaveReceiverDetail":
+			assert.Equal(t, "receiver-1", r.Form.Get("ReceiverId"))
+			_, _ = w.Write([]byte(`{"Data":{"Detail":[{"Email":"b@example.com"}]},"RequestId":"r-2"}`))
+		case "BatchSendMail":
+			assert.Equal(t, "poll@mail.hitokoto.cn", r.Form.Get("AccountName"))
+			assert.Equal(t, "poll_daily_report", r.Form.Get("TemplateName"))
+			_, _ = w.Write([]byte(`{"RequestId":"r-3"}`))
+		case "DeleteReceiver":
+			assert.Equal(t, "stale", r.Form.Get("ReceiverId"), "只应删除过期的临时收件人列表")
+			_, _ = w.Write([]byte(`{"RequestId":"r-4"}`))
+		}
+	})
+	results, err := d.SendBatch(context.Background(), &mailer.Batch{
+		From:     `"一言投票" <poll@mail.hitokoto.cn>`,
+		Template: &mailer.Template{ID: "poll_daily_report"},
+		Recipients: []*mailer.Recipient{
+			{To: "a@example.com", Data: map[string]interface{}{"username": "a"}},
+			{To: "b@example.com"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.NoError(t, results[0].Err)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, []string{"QueryReceiverByParam", "DeleteReceiver", "CreateReceiver", "SaveReceiverDetail", "BatchSendMail"}, actions,
+		"发送后应保留临时收件人列表，供异步执行的发送任务读取")
+
+	actions = nil
+	_, err = d.SendBatch(context.Background(), &mailer.Batch{
+		From:       "poll@mail.hitokoto.cn",
+		Template:   &mailer.Template{ID: "poll_daily_report"},
+		Recipients: []*mailer.Recipient{{To: "a@example.com"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CreateReceiver", "SaveReceiverDetail", "BatchSendMail"}, actions, "一小时内不应重复清理")
+}
+
+func TestSendBatchUnsupported(t *testing.T) {
+	d := newTestDM(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("不应调用接口：%s", r.Header.Get("x-acs-action"))
+	})
+	recipients := []*mailer.Recipient{{To: "a@example.com"}}
+	_, err := d.SendBatch(context.Background(), &mailer.Batch{Subject: "s", Template: &mailer.Template{ID: "x"}, Recipients: recipients})
+	assert.ErrorIs(t, err, mailer.ErrBatchUnsupported)
+	_, err = d.SendBatch(context.Background(), &mailer.Batch{
+		Template:   &mailer.Template{ID: "x"},
+		Recipients: []*mailer.Recipient{{To: "a@example.com", Data: map[string]interface{}{"hitokoto": "?"}}},
+	})
+	assert.ErrorIs(t, err, mailer.ErrBatchUnsupported)
+}
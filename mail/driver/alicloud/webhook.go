@@ -0,0 +1,296 @@
+package alicloud
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/webhook"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	webhook.Register("aliyun", &eventPush{})
+}
+
+// eventPush 解析邮件推送经由 MNS 主题推送到 HTTP 订阅地址的事件。
+// 订阅的推送格式（NotifyContentFormat）必须是 XML 或 JSON：必须配置 webhook.aliyun.topic_owner，
+// 而 SIMPLIFIED 格式不包含主题信息，无法校验。
+type eventPush struct{}
+
+// notification MNS 推送的消息信封
+type notification struct {
+	TopicOwner  string `json:"TopicOwner" xml:"TopicOwner"`
+	TopicName   string `json:"TopicName" xml:"TopicName"`
+	MessageID   string `json:"MessageId" xml:"MessageId"`
+	Message     string `json:"Message" xml:"Message"`
+	PublishTime int64  `json:"PublishTime" xml:"PublishTime"`
+	simplified  bool
+}
+
+func decodeNotification(body []byte) *notification {
+	n := &notification{}
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		if xml.Unmarshal(trimmed, n) == nil && n.TopicOwner != "" {
+			return n
+		}
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if json.Unmarshal(trimmed, n) == nil && n.TopicOwner != "" {
+			return n
+		}
+	}
+	return &notification{Message: string(body), simplified: true}
+}
+
+// certHost MNS 签名证书所在的域名。证书地址来自请求头，只接受该域名，
+// 避免任意 OSS Bucket 提供攻击者自己的证书
+const certHost = "mnstest.oss-cn-hangzhou.aliyuncs.com"
+
+// maxClockSkew 请求头 Date 与本地时间允许的最大偏差，超过时视为重放的旧请求
+const maxClockSkew = 15 * time.Minute
+
+// maxCachedCerts 缓存的证书数量上限，超过时清空缓存
+const maxCachedCerts = 8
+
+var certClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchCert 下载 MNS 签名证书，测试时可替换
+var fetchCert = func(u string) (*x509.Certificate, error) {
+	resp, err := certClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Newf("下载证书失败：%s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("证书不是 PEM 格式")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+var (
+	certsMu sync.Mutex
+	certs   = map[string]*x509.Certificate{} // 证书地址 -> 证书
+)
+
+// signingCert 返回签名证书。证书地址必须位于 certHost，且始终通过 HTTPS 下载
+func signingCert(u string) (*x509.Certificate, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return nil, errors.Wrap(err, "无效的证书地址")
+	}
+	if parsed.Hostname() != certHost || parsed.Port() != "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, errors.Newf("不受信任的证书地址：%s", u)
+	}
+	parsed.Scheme = "https"
+	u = parsed.String()
+	certsMu.Lock()
+	cert, ok := certs[u]
+	certsMu.Unlock()
+	if ok {
+		return cert, nil
+	}
+	cert, err = fetchCert(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "无法获取签名证书：%s", u)
+	}
+	certsMu.Lock()
+	if len(certs) >= maxCachedCerts {
+		certs = map[string]*x509.Certificate{}
+	}
+	certs[u] = cert
+	certsMu.Unlock()
+	return cert, nil
+}
+
+// stringToSign 按 MNS HTTP 推送的签名规则拼接待签名字符串
+func stringToSign(r *http.Request) string {
+	var keys []string
+	for k := range r.Header {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-mns-") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(r.Method + "\n")
+	b.WriteString(r.Header.Get("Content-MD5") + "\n")
+	b.WriteString(r.Header.Get("Content-Type") + "\n")
+	b.WriteString(r.Header.Get("Date") + "\n")
+	for _, k := range keys {
+		b.WriteString(k + ":" + r.Header.Get(k) + "\n")
+	}
+	b.WriteString(r.URL.RequestURI())
+	return b.String()
+}
+
+// checkMD5 校验请求体与 Content-MD5 一致，兼容十六进制与 Base64 两种编码
+func checkMD5(header string, body []byte) bool {
+	sum := md5.Sum(body)
+	hexSum := hex.EncodeToString(sum[:])
+	return header == base64.StdEncoding.EncodeToString(sum[:]) ||
+		strings.EqualFold(header, hexSum) ||
+		header == base64.StdEncoding.EncodeToString([]byte(hexSum)) ||
+		header == base64.StdEncoding.EncodeToString([]byte(strings.ToUpper(hexSum)))
+}
+
+func (t *eventPush) Verify(r *http.Request, body []byte) error {
+	c := config.Webhook().Aliyun()
+	if c.TopicOwner() == "" {
+		return errors.New("未配置 webhook.aliyun.topic_owner，拒绝所有推送")
+	}
+	if c.Verify() {
+		if err := verifySignature(r, body, time.Now()); err != nil {
+			return err
+		}
+	}
+	// 签名覆盖 Content-MD5，因此校验签名后消息信封中的主题信息才是可信的
+	n := decodeNotification(body)
+	if n.simplified {
+		return errors.New("无法校验主题，请将 MNS 订阅的推送格式设置为 JSON 或 XML")
+	}
+	if n.TopicOwner != c.TopicOwner() {
+		return errors.Newf("主题所属账号不匹配：%s", n.TopicOwner)
+	}
+	if c.TopicName() != "" && n.TopicName != c.TopicName() {
+		return errors.Newf("主题名称不匹配：%s", n.TopicName)
+	}
+	return nil
+}
+
+// verifySignature 校验 MNS 签名。签名不直接覆盖请求体，因此要求 Content-MD5 与请求体一致；
+// Date 与 now 相差超过 maxClockSkew 的请求视为重放
+func verifySignature(r *http.Request, body []byte, now time.Time) error {
+	if v := r.Header.Get("Content-MD5"); v == "" || !checkMD5(v, body) {
+		return errors.New("缺少 Content-MD5 或与请求体不一致")
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return errors.New("缺少或无效的 Date 请求头")
+	}
+	if d := now.Sub(date); d > maxClockSkew || d < -maxClockSkew {
+		return errors.Newf("请求已过期：%s", r.Header.Get("Date"))
+	}
+	certURL, err := base64.StdEncoding.DecodeString(r.Header.Get("x-mns-signing-cert-url"))
+	if err != nil || len(certURL) == 0 {
+		return errors.New("缺少签名证书地址")
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("Authorization"))
+	if err != nil || len(signature) == 0 {
+		return errors.New("缺少签名")
+	}
+	cert, err := signingCert(string(certURL))
+	if err != nil {
+		return err
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("签名证书不是 RSA 证书")
+	}
+	digest := sha1.Sum([]byte(stringToSign(r)))
+	if err = rsa.VerifyPKCS1v15(key, crypto.SHA1, digest[:], signature); err != nil {
+		return errors.Wrap(err, "签名无效")
+	}
+	return nil
+}
+
+// dmEvent 邮件推送的事件内容，即 MNS 消息正文，可以是单个事件或事件数组
+type dmEvent struct {
+	EventType string          `json:"event_type"`
+	EventTime string          `json:"event_time"`
+	EnvID     json.RawMessage `json:"env_id"`
+	ToAddress string          `json:"to_address"`
+	ErrCode   json.RawMessage `json:"err_code"`
+	ErrMsg    string          `json:"err_msg"`
+}
+
+// eventTypes 邮件推送的事件类型，未列出的类型（例如点击、退订）会被忽略
+var eventTypes = map[string]webhook.EventType{
+	"deliver":   webhook.EventDelivered,
+	"delivered": webhook.EventDelivered,
+	"bounce":    webhook.EventBounced,
+	"bounced":   webhook.EventBounced,
+	"fail":      webhook.EventBounced,
+	"failed":    webhook.EventBounced,
+	"spam":      webhook.EventComplained,
+	"complaint": webhook.EventComplained,
+	"report":    webhook.EventComplained,
+	"open":      webhook.EventOpened,
+	"opened":    webhook.EventOpened,
+}
+
+// rawString 兼容以字符串或数字形式出现的字段
+func rawString(v json.RawMessage) string {
+	var s string
+	if json.Unmarshal(v, &s) == nil {
+		return s
+	}
+	return strings.TrimSpace(string(v))
+}
+
+func (t *eventPush) Parse(body []byte) ([]*webhook.Event, error) {
+	message := strings.TrimSpace(decodeNotification(body).Message)
+	var raw []dmEvent
+	if strings.HasPrefix(message, "[") {
+		if err := json.Unmarshal([]byte(message), &raw); err != nil {
+			return nil, errors.Wrap(err, "无法解析邮件推送事件")
+		}
+	} else {
+		var e dmEvent
+		if err := json.Unmarshal([]byte(message), &e); err != nil {
+			return nil, errors.Wrap(err, "无法解析邮件推送事件")
+		}
+		raw = append(raw, e)
+	}
+	events := make([]*webhook.Event, 0, len(raw))
+	for _, v := range raw {
+		typ, ok := eventTypes[strings.ToLower(v.EventType)]
+		if !ok {
+			continue
+		}
+		code := rawString(v.ErrCode)
+		e := &webhook.Event{
+			Type:      typ,
+			Recipient: v.ToAddress,
+			MessageID: rawString(v.EnvID),
+			// 4xx 为暂时性退信，其余按永久性退信处理
+			Hard:   typ == webhook.EventBounced && !strings.HasPrefix(code, "4"),
+			Reason: strings.TrimSpace(code + " " + v.ErrMsg),
+			Time:   time.Now(),
+		}
+		if ts, err := time.ParseInLocation(time.DateTime, v.EventTime, eventLocation); err == nil {
+			e.Time = ts
+		} else if ts, err = time.Parse(time.RFC3339, v.EventTime); err == nil {
+			e.Time = ts
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// eventLocation 事件时间不带时区时按北京时间解析
+var eventLocation = time.FixedZone("CST", 8*60*60)
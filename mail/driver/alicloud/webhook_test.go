@@ -0,0 +1,183 @@
+package alicloud
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/hitokoto-osc/notification-worker/mail/suppression"
+	"github.com/hitokoto-osc/notification-worker/mail/webhook"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCertURL = "https://mnstest.oss-cn-hangzhou.aliyuncs.com/x509_public_certificate.pem"
+
+// 录制的 MNS JSON 格式推送，Message 为邮件推送的退信事件
+const bouncePayload = `{
+  "TopicOwner": "1234567890",
+  "TopicName": "dm-events",
+  "Subscriber": "1234567890",
+  "SubscriptionName": "notification-worker",
+  "MessageId": "5F1B0E2A3C4D5E6F-1-17F3A0B1C2D-200000001",
+  "MessageMD5": "D41D8CD98F00B204E9800998ECF8427E",
+  "Message": "{\"event_type\":\"bounce\",\"event_time\":\"2023-09-01 12:00:00\",\"env_id\":600000123456,\"to_address\":\"Nobody@Example.com\",\"err_code\":550,\"err_msg\":\"Mailbox not found\"}",
+  "PublishTime": 1693540800000
+}`
+
+const deliverPayload = `<?xml version="1.0" encoding="utf-8"?>
+<Notification xmlns="http://mns.aliyuncs.com/doc/v1/">
+  <TopicOwner>1234567890</TopicOwner>
+  <TopicName>dm-events</TopicName>
+  <MessageId>5F1B0E2A3C4D5E6F-1-17F3A0B1C2D-200000002</MessageId>
+  <Message>[{"event_type":"deliver","event_time":"2023-09-01 12:00:00","env_id":"600000123457","to_address":"ok@example.com"},{"event_type":"click","to_address":"ok@example.com"}]</Message>
+  <PublishTime>1693540800000</PublishTime>
+</Notification>`
+
+func setupSigner(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mns"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	fetch := fetchCert
+	fetchCert = func(u string) (*x509.Certificate, error) {
+		assert.Equal(t, testCertURL, u)
+		return cert, nil
+	}
+	certs = map[string]*x509.Certificate{}
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	viper.Set("webhook.aliyun.topic_owner", "1234567890")
+	t.Cleanup(func() {
+		fetchCert = fetch
+		certs = map[string]*x509.Certificate{}
+		storage.SetPath("")
+		viper.Set("webhook.aliyun.topic_owner", "")
+	})
+	return key
+}
+
+func signedRequest(t *testing.T, key *rsa.PrivateKey, contentType, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/webhook/aliyun", strings.NewReader(body))
+	sum := md5.Sum([]byte(body))
+	r.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	r.Header.Set("x-mns-request-id", "5F1B0E2A3C4D5E6F")
+	r.Header.Set("x-mns-signing-cert-url", base64.StdEncoding.EncodeToString([]byte(testCertURL)))
+	digest := sha1.Sum([]byte(stringToSign(r)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	require.NoError(t, err)
+	r.Header.Set("Authorization", base64.StdEncoding.EncodeToString(signature))
+	return r
+}
+
+func serve(r *http.Request) int {
+	w := httptest.NewRecorder()
+	webhook.Handler().ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestWebhookBounce(t *testing.T) {
+	key := setupSigner(t)
+
+	assert.Equal(t, http.StatusNoContent, serve(signedRequest(t, key, "application/json", bouncePayload)))
+	found, err := suppression.Check("nobody@example.com")
+	require.NoError(t, err)
+	require.Contains(t, found, "nobody@example.com")
+	e := found["nobody@example.com"]
+	assert.Equal(t, suppression.KindHardBounce, e.Kind)
+	assert.Equal(t, "550 Mailbox not found", e.Reason)
+	assert.Equal(t, "aliyun", e.Source)
+}
+
+func TestWebhookRejected(t *testing.T) {
+	key := setupSigner(t)
+
+	r := signedRequest(t, key, "application/json", bouncePayload)
+	r.Header.Set("x-mns-request-id", "tampered")
+	assert.Equal(t, http.StatusForbidden, serve(r), "签名覆盖的请求头被修改")
+
+	r = signedRequest(t, key, "application/json", bouncePayload)
+	r.Header.Set("x-mns-signing-cert-url", base64.StdEncoding.EncodeToString([]byte("https://evil.example.com/cert.pem")))
+	assert.Equal(t, http.StatusForbidden, serve(r), "证书地址不在白名单中")
+
+	r = signedRequest(t, key, "application/json", bouncePayload)
+	r.Header.Set("x-mns-signing-cert-url", base64.StdEncoding.EncodeToString([]byte("https://evil.oss-cn-hangzhou.aliyuncs.com/cert.pem")))
+	assert.Equal(t, http.StatusForbidden, serve(r), "其他 OSS Bucket 上的证书不可信")
+
+	r = signedRequest(t, key, "application/json", bouncePayload)
+	r.Body = io.NopCloser(strings.NewReader(strings.Replace(bouncePayload, "Nobody@Example.com", "victim@example.com", 1)))
+	assert.Equal(t, http.StatusForbidden, serve(r), "请求体与 Content-MD5 不一致")
+
+	r = signedRequest(t, key, "application/json", bouncePayload)
+	r.Header.Del("Content-MD5")
+	assert.Equal(t, http.StatusForbidden, serve(r), "缺少 Content-MD5")
+
+	viper.Set("webhook.aliyun.topic_owner", "")
+	assert.Equal(t, http.StatusForbidden, serve(signedRequest(t, key, "application/json", bouncePayload)), "未配置 topic_owner")
+
+	viper.Set("webhook.aliyun.topic_owner", "987654321")
+	assert.Equal(t, http.StatusForbidden, serve(signedRequest(t, key, "application/json", bouncePayload)), "主题所属账号不匹配")
+
+	found, err := suppression.Check("nobody@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestVerifySignatureDate(t *testing.T) {
+	key := setupSigner(t)
+	r := signedRequest(t, key, "application/json", bouncePayload)
+	body := []byte(bouncePayload)
+	require.NoError(t, verifySignature(r, body, time.Now()))
+	assert.Error(t, verifySignature(r, body, time.Now().Add(time.Hour)), "过期的请求应被拒绝")
+	assert.Error(t, verifySignature(r, body, time.Now().Add(-time.Hour)))
+}
+
+func TestSigningCertURL(t *testing.T) {
+	setupSigner(t)
+	cert, err := signingCert("http://mnstest.oss-cn-hangzhou.aliyuncs.com/x509_public_certificate.pem")
+	require.NoError(t, err, "证书应改为通过 HTTPS 下载")
+	assert.NotNil(t, cert)
+	_, err = signingCert("https://mnstest.oss-cn-hangzhou.aliyuncs.com.evil.com/x509_public_certificate.pem")
+	assert.Error(t, err)
+	_, err = signingCert("https://mnstest.oss-cn-hangzhou.aliyuncs.com:8443/x509_public_certificate.pem")
+	assert.Error(t, err)
+}
+
+func TestParseEvents(t *testing.T) {
+	events, err := (&eventPush{}).Parse([]byte(deliverPayload))
+	require.NoError(t, err)
+	require.Len(t, events, 1, "未知的事件类型应被忽略")
+	assert.Equal(t, webhook.EventDelivered, events[0].Type)
+	assert.Equal(t, "600000123457", events[0].MessageID)
+	assert.Equal(t, time.Date(2023, 9, 1, 4, 0, 0, 0, time.UTC), events[0].Time.UTC())
+
+	events, err = (&eventPush{}).Parse([]byte(`{"event_type":"bounce","to_address":"a@example.com","err_code":"452","err_msg":"mailbox full"}`))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.False(t, events[0].Hard, "4xx 退信为暂时性退信")
+	assert.Equal(t, "600000123456", rawString([]byte("600000123456")))
+}
@@ -1,6 +1,11 @@
 package driver
 
-import "github.com/hitokoto-osc/notification-worker/mail/mailer"
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"strconv"
+	"strings"
+)
 
 type Type int
 
@@ -9,8 +14,40 @@ const (
 	TypeSendCloud
 	TypeAliyun
 	TypeTencentCloud
+	TypeOutbox // 写入本地目录，用于开发与预发环境
 )
 
+var typeNames = map[Type]string{
+	TypeSMTP:         "smtp",
+	TypeSendCloud:    "sendcloud",
+	TypeAliyun:       "aliyun",
+	TypeTencentCloud: "tencentcloud",
+	TypeOutbox:       "outbox",
+}
+
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "unknown(" + strconv.Itoa(int(t)) + ")"
+}
+
+// ParseType 将配置中的驱动名称（如 smtp、aliyun）或数字解析为驱动类型
+func ParseType(s string) (Type, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for t, name := range typeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	if i, err := strconv.Atoi(s); err == nil {
+		if _, ok := typeNames[Type(i)]; ok {
+			return Type(i), nil
+		}
+	}
+	return 0, errors.Newf("未知的邮件驱动：%s", s)
+}
+
 type Driver interface {
 	Register() (mailer.Sender, error)
 }
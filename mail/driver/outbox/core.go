@@ -0,0 +1,60 @@
+package outbox
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/mail"
+	"os"
+	"path/filepath"
+)
+
+var Instance *Outbox
+
+func init() {
+	Instance = NewOutbox()
+	driver.Register(driver.TypeOutbox, Instance)
+}
+
+// Format 写入格式
+type Format string
+
+const (
+	FormatEML     Format = "eml"
+	FormatMaildir Format = "maildir"
+)
+
+// Outbox 将邮件写入本地目录而不是真正发送，方便在开发与预发环境中用任意邮件客户端查看
+type Outbox struct {
+	dir    string
+	format Format
+	from   *mail.Address
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+func (t *Outbox) Register() (mailer.Sender, error) {
+	c := config.Outbox()
+	t.dir = c.Dir()
+	t.format = Format(c.Format())
+	t.from = &mail.Address{Name: c.Name(), Address: c.Mail()}
+
+	var dirs []string
+	switch t.format {
+	case FormatEML:
+		dirs = []string{t.dir}
+	case FormatMaildir:
+		dirs = []string{filepath.Join(t.dir, "tmp"), filepath.Join(t.dir, "new"), filepath.Join(t.dir, "cur")}
+	default:
+		return nil, errors.Newf("未知的 outbox 格式：%s", t.format)
+	}
+	for _, v := range dirs {
+		if err := os.MkdirAll(v, 0o755); err != nil {
+			return nil, errors.Wrapf(err, "无法创建 outbox 目录：%s", v)
+		}
+	}
+	return t, nil
+}
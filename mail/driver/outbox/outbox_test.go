@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// valueCtx 模拟消费者上下文中的 trace_id 与 consumer_tag
+type valueCtx struct {
+	context.Context
+	m map[string]any
+}
+
+func (c *valueCtx) Get(key string) any {
+	return c.m[key]
+}
+
+func testCtx() context.Context {
+	return &valueCtx{
+		Context: context.Background(),
+		m: map[string]any{
+			"trace_id":     "701fd013-65eb-4813-85e3-0f74bc53a95f",
+			"consumer_tag": "HitokotoAppendedNotificationWorker",
+		},
+	}
+}
+
+func testMailer() *mailer.Mailer {
+	return &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      []string{"a@example.com"},
+			Subject: "喵！",
+			Body:    "<p>hello</p>",
+		},
+	}
+}
+
+func readMessage(t *testing.T, name string) *mail.Message {
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	msg, err := mail.ReadMessage(f)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestSendNormalMailEML(t *testing.T) {
+	dir := t.TempDir()
+	d := &Outbox{dir: dir, format: FormatEML, from: &mail.Address{Address: "notification@mail.hitokoto.cn"}}
+	_, err := d.SendSingle(testCtx(), testMailer())
+	require.NoError(t, err)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	msg := readMessage(t, files[0])
+	assert.Equal(t, "HitokotoAppendedNotificationWorker", msg.Header.Get(HeaderConsumerTag))
+	assert.Equal(t, "701fd013-65eb-4813-85e3-0f74bc53a95f", msg.Header.Get(HeaderTraceID))
+}
+
+func TestSendNormalMailMaildir(t *testing.T) {
+	dir := t.TempDir()
+	d := NewOutbox()
+	d.dir, d.format, d.from = dir, FormatMaildir, &mail.Address{Address: "notification@mail.hitokoto.cn"}
+	for _, v := range []string{"tmp", "new", "cur"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, v), 0o755))
+	}
+	_, err := d.SendSingle(context.Background(), testMailer())
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	tmp, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmp)
+	msg := readMessage(t, filepath.Join(dir, "new", files[0].Name()))
+	assert.Equal(t, "<a@example.com>", msg.Header.Get("To"))
+	assert.Empty(t, msg.Header.Get(HeaderTraceID))
+}
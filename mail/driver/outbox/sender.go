@@ -0,0 +1,120 @@
+package outbox
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/internal/message"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderConsumerTag = "X-Notification-Consumer-Tag"
+	HeaderTag         = "X-Notification-Tag"
+	HeaderTraceID     = "X-Notification-Trace-Id"
+)
+
+func (t *Outbox) Capabilities() mailer.Capabilities {
+	return mailer.Capabilities{Attachments: true, InlineAttachments: true, CustomHeaders: true}
+}
+
+func (t *Outbox) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	switch m.Type {
+	case mailer.TypeNormal:
+		return t.SendNormalMail(ctx, m)
+	case mailer.TypeTemplate:
+		return nil, errors.New("outbox 不支持模板邮件")
+	default:
+		return nil, errors.New("未知的邮件类型")
+	}
+}
+
+// SendNormalMail 将邮件写入本地目录，发送结果中的 MessageID 为邮件的 Message-ID
+func (t *Outbox) SendNormalMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if len(m.Mail.To) == 0 {
+		return nil, errors.New("收件人不能为空")
+	}
+	from := t.from
+	if m.Mail.From != "" {
+		var err error
+		if from, err = mail.ParseAddress(m.Mail.From); err != nil {
+			return nil, errors.Wrap(err, "无法解析发件人")
+		}
+	}
+	traceID := rabbitmq.TraceID(ctx)
+	header := textproto.MIMEHeader{}
+	if tag := rabbitmq.ConsumerTag(ctx); tag != "" {
+		header.Set(HeaderConsumerTag, tag)
+	}
+	if traceID != "" {
+		header.Set(HeaderTraceID, traceID)
+	}
+	if m.Mail.Tag != "" { // 服务商标签，便于检查按通知类型配置的发件人身份
+		header.Set(HeaderTag, m.Mail.Tag)
+	}
+	if len(m.Mail.BCC) > 0 { // 没有真实投递，保留密送人便于检查
+		addresses, err := message.ParseAddressList(m.Mail.BCC)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析密送人")
+		}
+		for _, v := range addresses {
+			header.Add("Bcc", v.String())
+		}
+	}
+	builder := &message.Builder{From: from, Mail: &m.Mail, Header: header}
+	msg, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	if traceID == "" {
+		traceID = uuid.NewString()
+	}
+	now := time.Now()
+	switch t.format {
+	case FormatMaildir:
+		err = t.writeMaildir(now, traceID, msg)
+	default:
+		name := now.Format("20060102T150405.000000000") + "_" + traceID + ".eml"
+		err = writeFile(filepath.Join(t.dir, name), msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mailer.Result{
+		Provider:  driver.TypeOutbox.String(),
+		MessageID: builder.MessageID(),
+		Accepted:  m.Mail.Recipients(),
+	}, nil
+}
+
+// writeMaildir 按 Maildir 约定先写入 tmp，再原子地移动到 new
+func (t *Outbox) writeMaildir(now time.Time, traceID string, msg []byte) error {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	name := strconv.FormatInt(now.Unix(), 10) + ".M" + strconv.Itoa(now.Nanosecond()) + "_" + traceID + "." + host
+	tmp := filepath.Join(t.dir, "tmp", name)
+	if err = writeFile(tmp, msg); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(t.dir, "new", name)); err != nil {
+		return errors.Wrap(err, "无法将邮件移动到 Maildir new 目录")
+	}
+	return nil
+}
+
+func writeFile(name string, b []byte) error {
+	if err := os.WriteFile(name, b, 0o644); err != nil {
+		return errors.Wrapf(err, "无法写入邮件文件：%s", name)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package sendcloud
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/http"
+	"strings"
+)
+
+var Instance *SendCloud
+
+func init() {
+	Instance = NewSendCloud()
+	driver.Register(driver.TypeSendCloud, Instance)
+}
+
+type SendCloud struct {
+	apiUser  string
+	apiKey   string
+	endpoint string
+	fromName string
+	fromMail string
+
+	// Runtime variables
+	client *http.Client
+}
+
+func NewSendCloud() *SendCloud {
+	return &SendCloud{}
+}
+
+func (t *SendCloud) Register() (mailer.Sender, error) {
+	c := config.SendCloud()
+	t.apiUser = c.APIUser()
+	t.apiKey = c.APIKey()
+	t.endpoint = strings.TrimRight(c.Endpoint(), "/")
+	t.fromName = c.Name()
+	t.fromMail = c.Mail()
+	if t.apiUser == "" || t.apiKey == "" {
+		return nil, errors.New("SendCloud 的 api_user 与 api_key 不能为空")
+	}
+	t.client = &http.Client{Timeout: c.Timeout()}
+	return t, nil
+}
@@ -0,0 +1,138 @@
+package sendcloud
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// 本测试文件使用 httptest 模拟 SendCloud API，验证请求参数的映射。
+
+func newTestSendCloud(t *testing.T, handler func(path string, form url.Values) string) *SendCloud {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(handler(r.URL.Path, r.PostForm)))
+	}))
+	t.Cleanup(s.Close)
+	return &SendCloud{
+		apiUser:  "user",
+		apiKey:   "key",
+		endpoint: s.URL + "/apiv2",
+		fromName: "一言网",
+		fromMail: "notification@mail.hitokoto.cn",
+		client:   s.Client(),
+	}
+}
+
+const okResponse = `{"result":true,"statusCode":200,"message":"请求成功","info":{"emailIdList":["1@sendcloud"]}}`
+
+func TestSendNormalMail(t *testing.T) {
+	var form url.Values
+	d := newTestSendCloud(t, func(path string, f url.Values) string {
+		assert.Equal(t, "/apiv2/mail/send", path)
+		form = f
+		return okResponse
+	})
+	result, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      []string{"a@example.com", "b@example.com"},
+			CC:      []string{"cc@example.com"},
+			BCC:     []string{"bcc@example.com"},
+			Subject: "喵！投票结果出炉了！",
+			Body:    "<p>hello</p>",
+			ReplyTo: "i@loli.online",
+			Headers: map[string]string{"X-Entity-Ref-ID": "uuid"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "user", form.Get("apiUser"))
+	assert.Equal(t, "key", form.Get("apiKey"))
+	assert.Equal(t, "notification@mail.hitokoto.cn", form.Get("from"))
+	assert.Equal(t, "一言网", form.Get("fromName"))
+	assert.Equal(t, "a@example.com;b@example.com", form.Get("to"))
+	assert.Equal(t, "cc@example.com", form.Get("cc"))
+	assert.Equal(t, "bcc@example.com", form.Get("bcc"))
+	assert.Equal(t, "喵！投票结果出炉了！", form.Get("subject"))
+	assert.Equal(t, "<p>hello</p>", form.Get("html"))
+	assert.Equal(t, "i@loli.online", form.Get("replyTo"))
+	assert.JSONEq(t, `{"X-Entity-Ref-ID":"uuid"}`, form.Get("headers"))
+	assert.Equal(t, "sendcloud", result.Provider)
+	assert.Equal(t, "1@sendcloud", result.MessageID)
+	assert.Len(t, result.Accepted, 4)
+}
+
+func TestSendTemplateMail(t *testing.T) {
+	var form url.Values
+	d := newTestSendCloud(t, func(path string, f url.Values) string {
+		assert.Equal(t, "/apiv2/mail/sendtemplate", path)
+		form = f
+		return okResponse
+	})
+	_, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeTemplate,
+		Mail: mailer.Mail{
+			From: "审核通知 <review@mail.hitokoto.cn>",
+			To:   []string{"a@example.com"},
+			BCC:  []string{"bcc@example.com"},
+		},
+		Template: &mailer.Template{
+			ID:   "hitokoto_reviewed",
+			Data: map[string]interface{}{"username": "a632079"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "hitokoto_reviewed", form.Get("templateInvokeName"))
+	assert.Equal(t, "review@mail.hitokoto.cn", form.Get("from"))
+	assert.Equal(t, "审核通知", form.Get("fromName"))
+	var api xsmtpapi
+	require.NoError(t, json.Unmarshal([]byte(form.Get("xsmtpapi")), &api))
+	assert.Equal(t, []string{"a@example.com", "bcc@example.com"}, api.To)
+	assert.Equal(t, []interface{}{"a632079", "a632079"}, api.Sub["%username%"])
+}
+
+func TestSendMailError(t *testing.T) {
+	d := newTestSendCloud(t, func(string, url.Values) string {
+		return `{"result":false,"statusCode":40005,"message":"认证失败","info":{}}`
+	})
+	_, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{To: []string{"a@example.com"}},
+	})
+	var e *Error
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, 40005, e.StatusCode)
+}
+
+func TestSendBatch(t *testing.T) {
+	var form url.Values
+	d := newTestSendCloud(t, func(path string, f url.Values) string {
+		assert.Equal(t, "/apiv2/mail/sendtemplate", path)
+		form = f
+		return okResponse
+	})
+	results, err := d.SendBatch(context.Background(), &mailer.Batch{
+		Template: &mailer.Template{ID: "poll_daily_report", Data: map[string]interface{}{"today": "2023-10-01"}},
+		Recipients: []*mailer.Recipient{
+			{To: "a@example.com", Data: map[string]interface{}{"username": "a"}},
+			{To: "b@example.com", Data: map[string]interface{}{"username": "b", "total": 3}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.NoError(t, results[1].Err)
+	assert.Equal(t, "poll_daily_report", form.Get("templateInvokeName"))
+	var api xsmtpapi
+	require.NoError(t, json.Unmarshal([]byte(form.Get("xsmtpapi")), &api))
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, api.To)
+	assert.Equal(t, []interface{}{"a", "b"}, api.Sub["%username%"])
+	assert.Equal(t, []interface{}{"2023-10-01", "2023-10-01"}, api.Sub["%today%"])
+	assert.Equal(t, []interface{}{"", float64(3)}, api.Sub["%total%"])
+}
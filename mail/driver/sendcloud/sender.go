@@ -0,0 +1,293 @@
+package sendcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// response 为 SendCloud API v2 的通用响应
+type response struct {
+	Result     bool   `json:"result"`
+	StatusCode int    `json:"statusCode"`
+	Message    string `json:"message"`
+	Info       struct {
+		EmailIDList []string `json:"emailIdList"`
+	} `json:"info"`
+}
+
+// result 将响应转换为发送结果，MessageID 为各收件人的 emailId，以逗号分隔
+func (r *response) result(accepted []string) *mailer.Result {
+	return &mailer.Result{
+		Provider:  driver.TypeSendCloud.String(),
+		MessageID: strings.Join(r.Info.EmailIDList, ","),
+		Accepted:  accepted,
+	}
+}
+
+// xsmtpapi 用于模板邮件的收件人与变量替换，每个收件人单独收到一封邮件
+type xsmtpapi struct {
+	To  []string                 `json:"to"`
+	Sub map[string][]interface{} `json:"sub,omitempty"`
+}
+
+// Error SendCloud 返回的业务错误
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("SendCloud 返回错误（%d）：%s", e.StatusCode, e.Message)
+}
+
+// Temporary 报告该错误是否为暂时性错误，SendCloud 以 5xx 与 5xxxx 状态码表示服务端异常
+func (e *Error) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500 && e.StatusCode < 600 ||
+		e.StatusCode >= 50000 && e.StatusCode < 60000
+}
+
+// Capabilities SendCloud 支持普通附件与自定义邮件头，但不支持内联资源
+func (t *SendCloud) Capabilities() mailer.Capabilities {
+	return mailer.Capabilities{Attachments: true, CustomHeaders: true, Templates: true}
+}
+
+func (t *SendCloud) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if err := mailer.CheckAttachments(t.Capabilities(), &m.Mail); err != nil {
+		return nil, err
+	}
+	switch m.Type {
+	case mailer.TypeNormal:
+		return t.SendNormalMail(ctx, m)
+	case mailer.TypeTemplate:
+		return t.SendTemplateMail(ctx, m)
+	default:
+		return nil, errors.New("未知的邮件类型")
+	}
+}
+
+func (t *SendCloud) SendNormalMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if len(m.Mail.To) == 0 {
+		return nil, errors.New("收件人不能为空")
+	}
+	form, err := t.mailForm(&m.Mail)
+	if err != nil {
+		return nil, err
+	}
+	form.Set("to", strings.Join(m.Mail.To, ";"))
+	if len(m.Mail.CC) > 0 {
+		form.Set("cc", strings.Join(m.Mail.CC, ";"))
+	}
+	if len(m.Mail.BCC) > 0 {
+		form.Set("bcc", strings.Join(m.Mail.BCC, ";"))
+	}
+	form.Set("subject", m.Mail.Subject)
+	form.Set("html", m.Mail.Body)
+	if m.Mail.Text != "" {
+		form.Set("plain", m.Mail.Text)
+	}
+	r, err := t.post(ctx, "/mail/send", form, m.Mail.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	return r.result(m.Mail.Recipients()), nil
+}
+
+// SendTemplateMail 调用 SendCloud 模板接口，Template.ID 对应模板调用名称，
+// Template.Data 中的每个键会被替换为模板中的 %键%。
+func (t *SendCloud) SendTemplateMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if m.Template == nil || m.Template.ID == "" {
+		return nil, errors.New("模板邮件缺少模板 ID")
+	}
+	// 模板接口不支持抄送与密送，这里将其作为独立的收件人
+	to := m.Mail.Recipients()
+	if len(to) == 0 {
+		return nil, errors.New("收件人不能为空")
+	}
+	api := xsmtpapi{To: to}
+	if len(m.Template.Data) > 0 {
+		api.Sub = make(map[string][]interface{}, len(m.Template.Data))
+		for k, v := range m.Template.Data {
+			values := make([]interface{}, len(to))
+			for i := range values {
+				values[i] = v
+			}
+			api.Sub["%"+k+"%"] = values
+		}
+	}
+	form, err := t.mailForm(&m.Mail)
+	if err != nil {
+		return nil, err
+	}
+	r, err := t.sendTemplate(ctx, form, m.Template.ID, m.Mail.Subject, api, m.Mail.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	return r.result(to), nil
+}
+
+// MaxBatchSize 模板接口单次最多 100 个收件人
+func (t *SendCloud) MaxBatchSize() int {
+	return 100
+}
+
+// SendBatch 通过模板接口的 xsmtpapi 一次提交多个收件人，每个收件人的变量按顺序写入 sub
+func (t *SendCloud) SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	if len(b.Recipients) == 0 {
+		return nil, nil
+	}
+	api := xsmtpapi{To: make([]string, 0, len(b.Recipients)), Sub: map[string][]interface{}{}}
+	for i, r := range b.Recipients {
+		api.To = append(api.To, r.To)
+		for k, v := range b.Data(r) {
+			key := "%" + k + "%"
+			if _, ok := api.Sub[key]; !ok {
+				// 其他收件人缺少该变量时替换为空字符串
+				api.Sub[key] = make([]interface{}, len(b.Recipients))
+				for j := range api.Sub[key] {
+					api.Sub[key][j] = ""
+				}
+			}
+			api.Sub[key][i] = v
+		}
+	}
+	form, err := t.mailForm(&mailer.Mail{From: b.From, ReplyTo: b.ReplyTo})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = t.sendTemplate(ctx, form, b.Template.ID, b.Subject, api, nil); err != nil {
+		return nil, err
+	}
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		results = append(results, &mailer.RecipientResult{To: r.To})
+	}
+	return results, nil
+}
+
+func (t *SendCloud) sendTemplate(ctx context.Context, form url.Values, id, subject string, api xsmtpapi, attachments []*mailer.Attachment) (*response, error) {
+	b, err := json.Marshal(api)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法编码 xsmtpapi")
+	}
+	form.Set("templateInvokeName", id)
+	form.Set("xsmtpapi", string(b))
+	if subject != "" {
+		form.Set("subject", subject)
+	}
+	return t.post(ctx, "/mail/sendtemplate", form, attachments)
+}
+
+func (t *SendCloud) baseForm(from string) (url.Values, error) {
+	form := url.Values{}
+	form.Set("apiUser", t.apiUser)
+	form.Set("apiKey", t.apiKey)
+	form.Set("from", t.fromMail)
+	form.Set("fromName", t.fromName)
+	if from != "" {
+		address, err := mail.ParseAddress(from)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析发件人")
+		}
+		form.Set("from", address.Address)
+		if address.Name != "" {
+			form.Set("fromName", address.Name)
+		}
+	}
+	return form, nil
+}
+
+// mailForm 在 baseForm 的基础上写入回复地址与自定义邮件头
+func (t *SendCloud) mailForm(m *mailer.Mail) (url.Values, error) {
+	form, err := t.baseForm(m.From)
+	if err != nil {
+		return nil, err
+	}
+	if m.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(m.ReplyTo)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析回复地址")
+		}
+		form.Set("replyTo", replyTo.Address)
+	}
+	if headers := m.RawHeaders(); len(headers) > 0 {
+		b, err := json.Marshal(headers)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法编码自定义邮件头")
+		}
+		form.Set("headers", string(b))
+	}
+	return form, nil
+}
+
+// post 提交表单，存在附件时使用 multipart/form-data 编码
+func (t *SendCloud) post(ctx context.Context, path string, form url.Values, attachments []*mailer.Attachment) (*response, error) {
+	body, contentType, err := encodeForm(form, attachments)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint+path, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法创建 SendCloud 请求")
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "SendCloud 请求失败")
+	}
+	defer resp.Body.Close()
+	var r response
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+		}
+		return nil, errors.Wrapf(err, "无法解析 SendCloud 响应（HTTP %d）", resp.StatusCode)
+	}
+	if !r.Result || r.StatusCode != http.StatusOK {
+		return nil, &Error{StatusCode: r.StatusCode, Message: r.Message}
+	}
+	return &r, nil
+}
+
+func encodeForm(form url.Values, attachments []*mailer.Attachment) (io.Reader, string, error) {
+	if len(attachments) == 0 {
+		return strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	for k, values := range form {
+		for _, v := range values {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, "", errors.Wrap(err, "无法编码 SendCloud 请求")
+			}
+		}
+	}
+	for _, v := range attachments {
+		content, err := v.Content()
+		if err != nil {
+			return nil, "", err
+		}
+		fw, err := w.CreateFormFile("attachments", v.Filename)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "无法编码附件")
+		}
+		if _, err = fw.Write(content); err != nil {
+			return nil, "", errors.Wrap(err, "无法编码附件")
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", errors.Wrap(err, "无法编码 SendCloud 请求")
+	}
+	return buf, w.FormDataContentType(), nil
+}
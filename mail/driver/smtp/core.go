@@ -0,0 +1,84 @@
+package smtp
+
+import (
+	"crypto/tls"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/mail"
+	"time"
+)
+
+var Instance *SMTP
+
+func init() {
+	Instance = NewSMTP()
+	driver.Register(driver.TypeSMTP, Instance)
+}
+
+// Encryption 连接加密方式
+type Encryption string
+
+const (
+	EncryptionNone     Encryption = "none"
+	EncryptionSTARTTLS Encryption = "starttls"
+	EncryptionTLS      Encryption = "tls" // 隐式 TLS
+)
+
+// AuthMechanism 认证方式
+type AuthMechanism string
+
+const (
+	AuthNone  AuthMechanism = "none"
+	AuthPlain AuthMechanism = "plain"
+	AuthLogin AuthMechanism = "login"
+)
+
+type SMTP struct {
+	host       string
+	port       int
+	username   string
+	password   string
+	encryption Encryption
+	auth       AuthMechanism
+	helo       string
+	timeout    time.Duration
+	from       *mail.Address
+
+	// Runtime variables
+	tlsConfig *tls.Config
+}
+
+func NewSMTP() *SMTP {
+	return &SMTP{}
+}
+
+func (t *SMTP) Register() (mailer.Sender, error) {
+	c := config.SMTP()
+	t.host = c.Host()
+	t.port = c.Port()
+	t.username = c.Username()
+	t.password = c.Password()
+	t.encryption = Encryption(c.Encryption())
+	t.auth = AuthMechanism(c.Auth())
+	t.helo = c.Helo()
+	t.timeout = c.Timeout()
+	t.from = &mail.Address{Name: c.Name(), Address: c.Mail()}
+
+	switch t.encryption {
+	case EncryptionNone, EncryptionSTARTTLS, EncryptionTLS:
+	default:
+		return nil, errors.Newf("未知的 SMTP 加密方式：%s", t.encryption)
+	}
+	switch t.auth {
+	case AuthNone, AuthPlain, AuthLogin:
+	default:
+		return nil, errors.Newf("未知的 SMTP 认证方式：%s", t.auth)
+	}
+	t.tlsConfig = &tls.Config{
+		ServerName:         t.host,
+		InsecureSkipVerify: c.InsecureSkipVerify(),
+	}
+	return t, nil
+}
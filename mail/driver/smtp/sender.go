@@ -0,0 +1,174 @@
+package smtp
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/internal/message"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net"
+	"net/mail"
+	gosmtp "net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+func (t *SMTP) Capabilities() mailer.Capabilities {
+	return mailer.Capabilities{Attachments: true, InlineAttachments: true, CustomHeaders: true}
+}
+
+func (t *SMTP) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	switch m.Type {
+	case mailer.TypeNormal:
+		result, err := t.SendNormalMail(ctx, m)
+		return result, classify(err)
+	case mailer.TypeTemplate:
+		return nil, errors.New("SMTP 不支持模板邮件")
+	default:
+		return nil, errors.New("未知的邮件类型")
+	}
+}
+
+// SendNormalMail 投递邮件，发送结果中的 MessageID 为邮件的 Message-ID
+func (t *SMTP) SendNormalMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if len(m.Mail.To) == 0 {
+		return nil, errors.New("收件人不能为空")
+	}
+	from := t.from
+	if m.Mail.From != "" {
+		var err error
+		if from, err = mail.ParseAddress(m.Mail.From); err != nil {
+			return nil, errors.Wrap(err, "无法解析发件人")
+		}
+	}
+	builder := &message.Builder{From: from, Mail: &m.Mail}
+	msg, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	// 抄送与密送都作为信封收件人投递，密送只是不出现在邮件头中
+	rcpt := make([]string, 0, len(m.Mail.To)+len(m.Mail.CC)+len(m.Mail.BCC))
+	for _, list := range [][]string{m.Mail.To, m.Mail.CC, m.Mail.BCC} {
+		addresses, err := message.ParseAddressList(list)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range addresses {
+			rcpt = append(rcpt, v.Address)
+		}
+	}
+
+	c, closeFn, err := t.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFn()
+	if err = c.Mail(from.Address); err != nil {
+		return nil, errors.Wrap(err, "SMTP MAIL FROM 失败")
+	}
+	for _, v := range rcpt {
+		if err = c.Rcpt(v); err != nil {
+			return nil, errors.Wrapf(err, "SMTP RCPT TO 失败：%s", v)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return nil, errors.Wrap(err, "SMTP DATA 失败")
+	}
+	if _, err = w.Write(msg); err != nil {
+		return nil, errors.Wrap(err, "写入邮件内容失败")
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Wrap(err, "SMTP 服务器拒收邮件")
+	}
+	_ = c.Quit() // 邮件已被接收，QUIT 失败无关紧要
+	return &mailer.Result{
+		Provider:  driver.TypeSMTP.String(),
+		MessageID: builder.MessageID(),
+		Accepted:  rcpt,
+	}, nil
+}
+
+// classify 将 SMTP 4xx 响应标记为暂时性错误
+func classify(err error) error {
+	var e *textproto.Error
+	if errors.As(err, &e) && e.Code >= 400 && e.Code < 500 {
+		return mailer.Temporary(err)
+	}
+	return err
+}
+
+// dial 建立到 SMTP 服务器的连接，并完成 TLS 握手与认证。
+// 连接会在 ctx 取消时被关闭，调用方用完后需调用返回的 closeFn。
+func (t *SMTP) dial(ctx context.Context) (c *gosmtp.Client, closeFn func(), err error) {
+	addr := net.JoinHostPort(t.host, strconv.Itoa(t.port))
+	dialer := &net.Dialer{Timeout: t.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "无法连接 SMTP 服务器：%s", addr)
+	}
+	deadline := time.Now().Add(t.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+	raw := conn
+	stop := context.AfterFunc(ctx, func() {
+		_ = raw.Close()
+	})
+	closeFn = func() {
+		stop()
+		_ = raw.Close()
+	}
+
+	if t.encryption == EncryptionTLS {
+		tlsConn := tls.Client(conn, t.tlsConfig)
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			closeFn()
+			return nil, nil, errors.Wrap(err, "SMTP TLS 握手失败")
+		}
+		conn = tlsConn
+	}
+	if c, err = gosmtp.NewClient(conn, t.host); err != nil {
+		closeFn()
+		return nil, nil, errors.Wrap(err, "无法建立 SMTP 会话")
+	}
+	if err = t.handshake(c); err != nil {
+		closeFn()
+		return nil, nil, err
+	}
+	return c, closeFn, nil
+}
+
+func (t *SMTP) handshake(c *gosmtp.Client) error {
+	if err := c.Hello(t.helo); err != nil {
+		return errors.Wrap(err, "SMTP EHLO 失败")
+	}
+	if t.encryption == EncryptionSTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+		if err := c.StartTLS(t.tlsConfig); err != nil {
+			return errors.Wrap(err, "SMTP STARTTLS 失败")
+		}
+	}
+	if t.auth == AuthNone {
+		return nil
+	}
+	if ok, _ := c.Extension("AUTH"); !ok {
+		return errors.New("SMTP 服务器不支持认证")
+	}
+	var auth gosmtp.Auth
+	switch t.auth {
+	case AuthLogin:
+		auth = LoginAuth(t.username, t.password, t.host)
+	default:
+		auth = gosmtp.PlainAuth("", t.username, t.password, t.host)
+	}
+	if err := c.Auth(auth); err != nil {
+		return errors.Wrap(err, "SMTP 认证失败")
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 本测试文件在进程内启动一个最小化的 SMTP 服务器，用于验证驱动的会话流程与 MIME 报文。
+
+type received struct {
+	auth string
+	from string
+	rcpt []string
+	data []byte
+}
+
+type testServer struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+	implicit  bool // 隐式 TLS
+	received  chan received
+}
+
+func newTestServer(t *testing.T, implicit bool) (*testServer, *x509.CertPool) {
+	cert, pool := selfSignedCert(t)
+	s := &testServer{
+		tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		implicit:  implicit,
+		received:  make(chan received, 1),
+	}
+	var err error
+	if implicit {
+		s.listener, err = tls.Listen("tcp", "127.0.0.1:0", s.tlsConfig)
+	} else {
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.listener.Close() })
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s, pool
+}
+
+func (s *testServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	isTLS := s.implicit
+	var r received
+	_ = tp.PrintfLine("220 localhost ESMTP test")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			if !isTLS {
+				_ = tp.PrintfLine("250-localhost\r\n250-STARTTLS\r\n250 AUTH PLAIN LOGIN")
+			} else {
+				_ = tp.PrintfLine("250-localhost\r\n250 AUTH PLAIN LOGIN")
+			}
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err = tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			switch strings.ToUpper(mechanism) {
+			case "PLAIN":
+				b, _ := base64.StdEncoding.DecodeString(initial)
+				r.auth = "PLAIN:" + strings.ReplaceAll(string(b), "\x00", ":")
+			case "LOGIN":
+				_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user, _ := tp.ReadLine()
+				_ = tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+				pass, _ := tp.ReadLine()
+				u, _ := base64.StdEncoding.DecodeString(user)
+				p, _ := base64.StdEncoding.DecodeString(pass)
+				r.auth = "LOGIN:" + string(u) + ":" + string(p)
+			}
+			_ = tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			r.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			r.rcpt = append(r.rcpt, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			r.data, _ = io.ReadAll(tp.DotReader())
+			_ = tp.PrintfLine("250 queued")
+			s.received <- r
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func newTestSMTP(port int, encryption Encryption, auth AuthMechanism, pool *x509.CertPool) *SMTP {
+	return &SMTP{
+		host:       "127.0.0.1",
+		port:       port,
+		username:   "user",
+		password:   "pass",
+		encryption: encryption,
+		auth:       auth,
+		helo:       "localhost",
+		timeout:    5 * time.Second,
+		from:       &mail.Address{Name: "一言网", Address: "notification@mail.hitokoto.cn"},
+		tlsConfig:  &tls.Config{ServerName: "127.0.0.1", RootCAs: pool},
+	}
+}
+
+func testMailer() *mailer.Mailer {
+	return &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      []string{"to@example.com"},
+			CC:      []string{"Carbon <cc@example.com>"},
+			BCC:     []string{"bcc@example.com"},
+			Subject: "喵！已经成功收到您提交的句子了！",
+			Body:    "<p>你好，一言。</p>",
+		},
+	}
+}
+
+func waitReceived(t *testing.T, s *testServer) received {
+	select {
+	case r := <-s.received:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP 服务器没有收到邮件")
+	}
+	return received{}
+}
+
+func assertMessage(t *testing.T, r received) {
+	assert.Equal(t, "notification@mail.hitokoto.cn", r.from)
+	assert.Equal(t, []string{"to@example.com", "cc@example.com", "bcc@example.com"}, r.rcpt)
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(r.data))))
+	require.NoError(t, err)
+	assert.Equal(t, "<to@example.com>", msg.Header.Get("To"))
+	assert.Equal(t, `"Carbon" <cc@example.com>`, msg.Header.Get("Cc"))
+	assert.Empty(t, msg.Header.Get("Bcc"), "密送人不应出现在邮件头中")
+	assert.NotEmpty(t, msg.Header.Get("Message-ID"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "喵！已经成功收到您提交的句子了！", subject)
+	assert.True(t, strings.HasPrefix(msg.Header.Get("Content-Type"), "text/html"))
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "<p>你好，一言。</p>", strings.TrimSpace(string(body)))
+}
+
+func TestSendNormalMailPlainAuth(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionNone, AuthPlain, pool)
+	result, err := d.SendSingle(context.Background(), testMailer())
+	require.NoError(t, err)
+	r := waitReceived(t, s)
+	assert.Equal(t, "PLAIN::user:pass", r.auth)
+	assertMessage(t, r)
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(r.data))))
+	require.NoError(t, err)
+	assert.Equal(t, "smtp", result.Provider)
+	assert.Equal(t, msg.Header.Get("Message-ID"), result.MessageID, "发送结果应包含生成的 Message-ID")
+	assert.Equal(t, r.rcpt, result.Accepted)
+}
+
+func TestSendNormalMailSTARTTLSLoginAuth(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionSTARTTLS, AuthLogin, pool)
+	_, err := d.SendSingle(context.Background(), testMailer())
+	require.NoError(t, err)
+	r := waitReceived(t, s)
+	assert.Equal(t, "LOGIN:user:pass", r.auth)
+	assertMessage(t, r)
+}
+
+func TestSendNormalMailImplicitTLS(t *testing.T) {
+	s, pool := newTestServer(t, true)
+	d := newTestSMTP(s.port(), EncryptionTLS, AuthPlain, pool)
+	_, err := d.SendSingle(context.Background(), testMailer())
+	require.NoError(t, err)
+	assertMessage(t, waitReceived(t, s))
+}
+
+func TestSendNormalMailCancelled(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionNone, AuthNone, pool)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := d.SendSingle(ctx, testMailer())
+	assert.Error(t, err)
+}
+
+func TestSendNormalMailAttachments(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionNone, AuthNone, pool)
+	m := testMailer()
+	m.Mail.Body = `<img src="cid:logo"><p>你好，一言。</p>`
+	m.Mail.Attachments = []*mailer.Attachment{
+		{Filename: "logo.png", ContentID: "logo", Data: []byte("\x89PNG")},
+		{Filename: "报告.txt", Data: []byte("hello")},
+	}
+	_, err := d.SendSingle(context.Background(), m)
+	require.NoError(t, err)
+	r := waitReceived(t, s)
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(r.data))))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	mixed := multipart.NewReader(msg.Body, params["boundary"])
+	related, err := mixed.NextPart()
+	require.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(related.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/related", mediaType)
+
+	parts := multipart.NewReader(related, params["boundary"])
+	html, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(html.Header.Get("Content-Type"), "text/html"))
+	logo, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "<logo>", logo.Header.Get("Content-Id"))
+	assert.True(t, strings.HasPrefix(logo.Header.Get("Content-Disposition"), "inline"))
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, logo))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x89PNG"), data)
+
+	attachment, err := mixed.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "报告.txt", attachment.FileName())
+	data, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+}
+
+func TestSendNormalMailTextAlternative(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionNone, AuthNone, pool)
+	m := testMailer()
+	m.Mail.Text = "你好，一言。"
+	_, err := d.SendSingle(context.Background(), m)
+	require.NoError(t, err)
+	r := waitReceived(t, s)
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(r.data))))
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	text, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(text.Header.Get("Content-Type"), "text/plain"))
+	body, err := io.ReadAll(text)
+	require.NoError(t, err)
+	assert.Equal(t, "你好，一言。", string(body))
+	html, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(html.Header.Get("Content-Type"), "text/html"), "HTML 正文应作为最后一个备选部分")
+}
+
+func TestSendNormalMailThreadHeaders(t *testing.T) {
+	s, pool := newTestServer(t, false)
+	d := newTestSMTP(s.port(), EncryptionNone, AuthNone, pool)
+	m := testMailer()
+	m.Mail.ReplyTo = "一言 <i@loli.online>"
+	m.Mail.Thread("uuid@hitokoto.cn", "uuid.reviewed@hitokoto.cn")
+	m.Mail.Headers = map[string]string{"X-Entity-Ref-ID": "uuid", "Subject": "覆盖", "Bad Key": "x"}
+	_, err := d.SendSingle(context.Background(), m)
+	require.NoError(t, err)
+	r := waitReceived(t, s)
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(string(r.data))))
+	require.NoError(t, err)
+	assert.Equal(t, "<uuid.reviewed@hitokoto.cn>", msg.Header.Get("Message-ID"))
+	assert.Len(t, msg.Header["Message-Id"], 1)
+	assert.Equal(t, "<uuid@hitokoto.cn>", msg.Header.Get("In-Reply-To"))
+	assert.Equal(t, "<uuid@hitokoto.cn>", msg.Header.Get("References"))
+	assert.Equal(t, "uuid", msg.Header.Get("X-Entity-Ref-ID"))
+	assert.Contains(t, msg.Header.Get("Reply-To"), "<i@loli.online>")
+	assert.Len(t, msg.Header["Subject"], 1, "自定义邮件头不能覆盖 Subject")
+	assert.NotContains(t, string(r.data), "Bad Key")
+}
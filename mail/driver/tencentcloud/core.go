@@ -0,0 +1,56 @@
+package tencentcloud
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var Instance *SES
+
+func init() {
+	Instance = NewTencentCloudSES()
+	driver.Register(driver.TypeTencentCloud, Instance)
+}
+
+type SES struct {
+	secretID  string
+	secretKey string
+	region    string
+	endpoint  *url.URL
+	fromName  string
+	fromMail  string
+
+	// Runtime variables
+	client *http.Client
+}
+
+func NewTencentCloudSES() *SES {
+	return &SES{}
+}
+
+func (t *SES) Register() (mailer.Sender, error) {
+	c := config.TencentCloud().SES()
+	t.secretID = c.SecretID()
+	t.secretKey = c.SecretKey()
+	t.region = c.Region()
+	t.fromName = c.Name()
+	t.fromMail = c.Mail()
+	if t.secretID == "" || t.secretKey == "" {
+		return nil, errors.New("腾讯云 SES 的 secret_id 与 secret_key 不能为空")
+	}
+	endpoint := c.Endpoint()
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	var err error
+	if t.endpoint, err = url.Parse(endpoint); err != nil {
+		return nil, errors.Wrap(err, "无法解析腾讯云 SES 接入点")
+	}
+	t.client = &http.Client{Timeout: c.Timeout()}
+	return t, nil
+}
@@ -0,0 +1,46 @@
+package tencentcloud
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error 腾讯云 API 返回的错误
+type Error struct {
+	Code      string
+	Message   string
+	RequestID string
+	// HTTPStatus 为非 2xx 响应的状态码，正常的业务错误为 0
+	HTTPStatus int
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("腾讯云 SES 请求失败（HTTP %d）", e.HTTPStatus)
+	}
+	return fmt.Sprintf("腾讯云 SES 返回错误（%s）：%s，RequestId：%s", e.Code, e.Message, e.RequestID)
+}
+
+// temporaryCodes 为可重试的错误码（及其前缀），其余错误码视为重试无意义
+// 参见 https://cloud.tencent.com/document/api/1288/51060
+var temporaryCodes = []string{
+	"InternalError",
+	"RequestLimitExceeded",
+	"ResourceUnavailable",
+	"FailedOperation.FrequencyLimit",
+	"FailedOperation.TemporaryBlocked",
+	"FailedOperation.ServiceNotAvailable",
+}
+
+// Temporary 报告该错误是否为暂时性错误，即稍后重试可能成功
+func (e *Error) Temporary() bool {
+	if e.HTTPStatus >= 500 || e.HTTPStatus == 429 {
+		return true
+	}
+	for _, v := range temporaryCodes {
+		if e.Code == v || strings.HasPrefix(e.Code, v+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package tencentcloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+)
+
+type sendEmailRequest struct {
+	FromEmailAddress string        `json:"FromEmailAddress"`
+	Destination      []string      `json:"Destination"`
+	Cc               []string      `json:"Cc,omitempty"`
+	Bcc              []string      `json:"Bcc,omitempty"`
+	Subject          string        `json:"Subject"`
+	ReplyToAddresses string        `json:"ReplyToAddresses,omitempty"`
+	Template         *template     `json:"Template,omitempty"`
+	Simple           *simple       `json:"Simple,omitempty"`
+	Attachments      []*attachment `json:"Attachments,omitempty"`
+	TriggerType      uint64        `json:"TriggerType"`
+}
+
+type attachment struct {
+	FileName string `json:"FileName"`
+	Content  string `json:"Content"` // base64
+}
+
+type template struct {
+	TemplateID   uint64 `json:"TemplateID"`
+	TemplateData string `json:"TemplateData"`
+}
+
+type simple struct {
+	Html string `json:"Html,omitempty"`
+	Text string `json:"Text,omitempty"`
+}
+
+type sendEmailResponse struct {
+	Response struct {
+		MessageID string `json:"MessageId"`
+		RequestID string `json:"RequestId"`
+		Error     *struct {
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Error"`
+	} `json:"Response"`
+}
+
+// Capabilities 腾讯云 SES 支持普通附件，但不支持内联资源
+func (t *SES) Capabilities() mailer.Capabilities {
+	return mailer.Capabilities{Attachments: true, Templates: true}
+}
+
+func (t *SES) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if err := mailer.CheckAttachments(t.Capabilities(), &m.Mail); err != nil {
+		return nil, err
+	}
+	switch m.Type {
+	case mailer.TypeNormal:
+		return t.SendNormalMail(ctx, m)
+	case mailer.TypeTemplate:
+		return t.SendTemplateMail(ctx, m)
+	default:
+		return nil, errors.New("未知的邮件类型")
+	}
+}
+
+func (t *SES) SendNormalMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	req, err := t.newRequest(m)
+	if err != nil {
+		return nil, err
+	}
+	req.Simple = &simple{
+		Html: base64.StdEncoding.EncodeToString([]byte(m.Mail.Body)),
+		Text: base64.StdEncoding.EncodeToString([]byte(m.Mail.Text)),
+	}
+	return t.send(ctx, req, m)
+}
+
+// SendTemplateMail 使用腾讯云 SES 模板发送，Template.ID 为控制台中的数字模板 ID，
+// Template.Data 会被序列化为 TemplateData。
+func (t *SES) SendTemplateMail(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if m.Template == nil || m.Template.ID == "" {
+		return nil, errors.New("模板邮件缺少模板 ID")
+	}
+	id, err := strconv.ParseUint(m.Template.ID, 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "腾讯云 SES 模板 ID 必须为数字：%s", m.Template.ID)
+	}
+	data, err := json.Marshal(m.Template.Data)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法编码模板变量")
+	}
+	req, err := t.newRequest(m)
+	if err != nil {
+		return nil, err
+	}
+	req.Template = &template{TemplateID: id, TemplateData: string(data)}
+	return t.send(ctx, req, m)
+}
+
+// send 调用 SendEmail，发送结果中的 MessageID 为 SES 返回的 MessageId
+func (t *SES) send(ctx context.Context, req *sendEmailRequest, m *mailer.Mailer) (*mailer.Result, error) {
+	r, err := t.sendEmail(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &mailer.Result{
+		Provider:  driver.TypeTencentCloud.String(),
+		MessageID: r.Response.MessageID,
+		RequestID: r.Response.RequestID,
+		Accepted:  m.Mail.Recipients(),
+	}, nil
+}
+
+func (t *SES) newRequest(m *mailer.Mailer) (*sendEmailRequest, error) {
+	if len(m.Mail.To) == 0 {
+		return nil, errors.New("收件人不能为空")
+	}
+	from := &mail.Address{Name: t.fromName, Address: t.fromMail}
+	if m.Mail.From != "" {
+		var err error
+		if from, err = mail.ParseAddress(m.Mail.From); err != nil {
+			return nil, errors.Wrap(err, "无法解析发件人")
+		}
+	}
+	fromAddress := from.Address
+	if from.Name != "" {
+		fromAddress = from.Name + " <" + from.Address + ">"
+	}
+	attachments := make([]*attachment, 0, len(m.Mail.Attachments))
+	for _, v := range m.Mail.Attachments {
+		content, err := v.Content()
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &attachment{
+			FileName: v.Filename,
+			Content:  base64.StdEncoding.EncodeToString(content),
+		})
+	}
+	return &sendEmailRequest{
+		FromEmailAddress: fromAddress,
+		Attachments:      attachments,
+		Destination:      m.Mail.To,
+		Cc:               m.Mail.CC,
+		Bcc:              m.Mail.BCC,
+		Subject:          m.Mail.Subject,
+		ReplyToAddresses: m.Mail.ReplyTo, // SES 不支持自定义邮件头，会话头部被忽略
+		TriggerType:      1,              // 触发类邮件
+	}, nil
+}
+
+func (t *SES) sendEmail(ctx context.Context, req *sendEmailRequest) (*sendEmailResponse, error) {
+	const action = "SendEmail"
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法编码腾讯云 SES 请求")
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "无法创建腾讯云 SES 请求")
+	}
+	now := time.Now()
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("X-TC-Action", action)
+	httpReq.Header.Set("X-TC-Version", version)
+	httpReq.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	httpReq.Header.Set("X-TC-Region", t.region)
+	httpReq.Header.Set("Authorization", sign(t.secretID, t.secretKey, t.endpoint.Host, action, payload, now))
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "腾讯云 SES 请求失败")
+	}
+	defer resp.Body.Close()
+	var r sendEmailResponse
+	if err = json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		if resp.StatusCode >= 300 {
+			return nil, &Error{HTTPStatus: resp.StatusCode}
+		}
+		return nil, errors.Wrap(err, "无法解析腾讯云 SES 响应")
+	}
+	if e := r.Response.Error; e != nil {
+		return nil, &Error{Code: e.Code, Message: e.Message, RequestID: r.Response.RequestID}
+	}
+	if resp.StatusCode >= 300 {
+		return nil, &Error{HTTPStatus: resp.StatusCode, RequestID: r.Response.RequestID}
+	}
+	return &r, nil
+}
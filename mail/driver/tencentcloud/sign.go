@@ -0,0 +1,61 @@
+package tencentcloud
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	service         = "ses"
+	version         = "2020-10-02"
+	signedHeaders   = "content-type;host;x-tc-action"
+	signatureMethod = "TC3-HMAC-SHA256"
+	contentType     = "application/json; charset=utf-8"
+)
+
+// sign 按 TC3-HMAC-SHA256 计算请求签名，返回 Authorization 头
+// 参见 https://cloud.tencent.com/document/api/1288/51055
+func sign(secretID, secretKey, host, action string, payload []byte, now time.Time) string {
+	canonicalRequest := strings.Join([]string{
+		"POST",
+		"/",
+		"",
+		"content-type:" + contentType + "\nhost:" + host + "\nx-tc-action:" + strings.ToLower(action) + "\n",
+		signedHeaders,
+		sha256Hex(payload),
+	}, "\n")
+
+	date := now.UTC().Format("2006-01-02")
+	credentialScope := date + "/" + service + "/tc3_request"
+	stringToSign := strings.Join([]string{
+		signatureMethod,
+		strconv.FormatInt(now.Unix(), 10),
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	secretDate := hmacSHA256([]byte("TC3"+secretKey), date)
+	secretService := hmacSHA256(secretDate, service)
+	secretSigning := hmacSHA256(secretService, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(secretSigning, stringToSign))
+
+	return signatureMethod +
+		" Credential=" + secretID + "/" + credentialScope +
+		", SignedHeaders=" + signedHeaders +
+		", Signature=" + signature
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
@@ -0,0 +1,121 @@
+package tencentcloud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// 本测试文件使用 httptest 模拟腾讯云 SES API，验证签名、请求映射与错误分类。
+
+func newTestSES(t *testing.T, handler func(w http.ResponseWriter, req *sendEmailRequest)) *SES {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "SendEmail", r.Header.Get("X-TC-Action"))
+		assert.Equal(t, version, r.Header.Get("X-TC-Version"))
+		assert.Equal(t, "ap-hongkong", r.Header.Get("X-TC-Region"))
+		ts, err := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+		require.NoError(t, err)
+		expected := sign("id", "key", r.Host, "SendEmail", payload, time.Unix(ts, 0))
+		assert.Equal(t, expected, r.Header.Get("Authorization"))
+
+		var req sendEmailRequest
+		require.NoError(t, json.Unmarshal(payload, &req))
+		handler(w, &req)
+	}))
+	t.Cleanup(s.Close)
+	endpoint, _ := url.Parse(s.URL)
+	return &SES{
+		secretID:  "id",
+		secretKey: "key",
+		region:    "ap-hongkong",
+		endpoint:  endpoint,
+		fromName:  "一言网",
+		fromMail:  "notification@mail.hitokoto.cn",
+		client:    s.Client(),
+	}
+}
+
+func TestSendNormalMail(t *testing.T) {
+	d := newTestSES(t, func(w http.ResponseWriter, req *sendEmailRequest) {
+		assert.Equal(t, "一言网 <notification@mail.hitokoto.cn>", req.FromEmailAddress)
+		assert.Equal(t, []string{"a@example.com"}, req.Destination)
+		assert.Equal(t, []string{"bcc@example.com"}, req.Bcc)
+		assert.Equal(t, "喵！您的句子已重新审核！", req.Subject)
+		require.NotNil(t, req.Simple)
+		html, _ := base64.StdEncoding.DecodeString(req.Simple.Html)
+		assert.Equal(t, "<p>hello</p>", string(html))
+		_, _ = w.Write([]byte(`{"Response":{"MessageId":"qcloudses-1","RequestId":"r-1"}}`))
+	})
+	result, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{
+			To:      []string{"a@example.com"},
+			BCC:     []string{"bcc@example.com"},
+			Subject: "喵！您的句子已重新审核！",
+			Body:    "<p>hello</p>",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tencentcloud", result.Provider)
+	assert.Equal(t, "qcloudses-1", result.MessageID)
+	assert.Equal(t, "r-1", result.RequestID)
+	assert.Equal(t, []string{"a@example.com", "bcc@example.com"}, result.Accepted)
+}
+
+func TestSendTemplateMail(t *testing.T) {
+	d := newTestSES(t, func(w http.ResponseWriter, req *sendEmailRequest) {
+		require.NotNil(t, req.Template)
+		assert.Nil(t, req.Simple)
+		assert.Equal(t, uint64(23333), req.Template.TemplateID)
+		assert.JSONEq(t, `{"username":"a632079"}`, req.Template.TemplateData)
+		_, _ = w.Write([]byte(`{"Response":{"MessageId":"qcloudses-2","RequestId":"r-2"}}`))
+	})
+	_, err := d.SendSingle(context.Background(), &mailer.Mailer{
+		Type: mailer.TypeTemplate,
+		Mail: mailer.Mail{To: []string{"a@example.com"}, Subject: "喵！"},
+		Template: &mailer.Template{
+			ID:   "23333",
+			Data: map[string]interface{}{"username": "a632079"},
+		},
+	})
+	assert.NoError(t, err)
+}
+
+func TestSendMailErrorClassification(t *testing.T) {
+	cases := []struct {
+		status    int
+		body      string
+		temporary bool
+	}{
+		{200, `{"Response":{"Error":{"Code":"RequestLimitExceeded","Message":"too fast"},"RequestId":"r"}}`, true},
+		{200, `{"Response":{"Error":{"Code":"InternalError.ServiceError","Message":"oops"},"RequestId":"r"}}`, true},
+		{200, `{"Response":{"Error":{"Code":"FailedOperation.EmailAddrInBlacklist","Message":"blocked"},"RequestId":"r"}}`, false},
+		{200, `{"Response":{"Error":{"Code":"AuthFailure.SignatureFailure","Message":"bad sign"},"RequestId":"r"}}`, false},
+		{http.StatusBadGateway, `bad gateway`, true},
+	}
+	for _, c := range cases {
+		d := newTestSES(t, func(w http.ResponseWriter, _ *sendEmailRequest) {
+			w.WriteHeader(c.status)
+			_, _ = w.Write([]byte(c.body))
+		})
+		_, err := d.SendSingle(context.Background(), &mailer.Mailer{
+			Type: mailer.TypeNormal,
+			Mail: mailer.Mail{To: []string{"a@example.com"}},
+		})
+		var e *Error
+		require.ErrorAs(t, err, &e, c.body)
+		assert.Equal(t, c.temporary, e.Temporary(), c.body)
+	}
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+const (
+	dryRunLog    = "log"
+	dryRunOutbox = "outbox"
+)
+
+// ErrDryRun 演练模式下要求将消息放回队列时，由 SendSingle 与 SendBatch 返回
+var ErrDryRun = errors.New("演练模式，消息已放回队列")
+
+// dryRunSender 演练模式下接收渲染结果的驱动，output 为 log 时为空
+var dryRunSender mailer.Sender
+
+func init() {
+	config.RegisterCallback(func() {
+		c := config.DryRun()
+		if !c.Enabled() {
+			return
+		}
+		defer zap.L().Sync()
+		switch c.Output() {
+		case dryRunLog:
+		case dryRunOutbox:
+			sender, err := driver.Get(driver.TypeOutbox).Register()
+			if err != nil {
+				zap.L().Fatal("演练模式无法加载 outbox 驱动", zap.Error(err))
+			}
+			dryRunSender = sender
+		default:
+			zap.L().Fatal("未知的演练模式输出，可用输出：log、outbox", zap.String("output", c.Output()))
+		}
+		if c.Requeue() && c.RequeueDelay() <= 0 {
+			// 没有正式 worker 时，立即放回队列的消息会被同一个演练 worker 反复消费
+			zap.L().Fatal("演练模式放回队列时 dry_run.requeue_delay 必须大于 0", zap.Duration("requeue_delay", c.RequeueDelay()))
+		}
+		zap.L().Warn("已启用演练模式，邮件不会被发送。",
+			zap.String("output", c.Output()),
+			zap.Bool("requeue", c.Requeue()),
+		)
+	})
+}
+
+// dryRun 记录渲染结果而不调用邮件驱动，output 为 outbox 时同时将普通邮件写入 outbox
+func dryRun(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	start := time.Now()
+	result := &mailer.Result{Provider: "dry-run", Accepted: m.Mail.Recipients()}
+	fields := []zap.Field{
+		zap.String("kind", m.Meta.Kind),
+		zap.String("template", m.Meta.Template),
+		zap.Strings("recipients", result.Accepted),
+		zap.String("subject", m.Mail.Subject),
+		zap.Int("html_size", len(m.Mail.Body)),
+		zap.Int("text_size", len(m.Mail.Text)),
+		zap.Int("attachments", len(m.Mail.Attachments)),
+	}
+	if m.Type == mailer.TypeTemplate && m.Template != nil {
+		keys := make([]string, 0, len(m.Template.Data))
+		for k := range m.Template.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fields = append(fields, zap.String("template_id", m.Template.ID), zap.Strings("template_data", keys))
+	}
+	if dryRunSender != nil && m.Type == mailer.TypeNormal {
+		r, err := dryRunSender.SendSingle(ctx, m)
+		if err != nil {
+			return nil, errors.Wrap(err, "演练模式下无法写入 outbox")
+		}
+		result.MessageID = r.MessageID
+		fields = append(fields, zap.String("message_id", r.MessageID))
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	logger.Info("[mail.dry_run] 演练模式，邮件未发送", fields...)
+	result.Latency = time.Since(start)
+	return result, dryRunError()
+}
+
+// dryRunBatch 逐个记录批量邮件的渲染结果
+func dryRunBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	results := make([]*mailer.RecipientResult, 0, len(b.Recipients))
+	for _, r := range b.Recipients {
+		m := b.Mailer(r)
+		err := renderTemplate(instance, m)
+		if err == nil {
+			fillText(m)
+			_, err = dryRun(ctx, m)
+		}
+		if errors.Is(err, ErrDryRun) {
+			err = nil
+		}
+		results = append(results, &mailer.RecipientResult{To: r.To, Err: err})
+	}
+	if err := combineErrors(results); err != nil {
+		return results, err
+	}
+	return results, dryRunError()
+}
+
+// dryRunError 按配置决定消息被确认还是放回队列：放回队列时返回包装了 ErrDryRun 的错误
+func dryRunError() error {
+	if !config.DryRun().Requeue() {
+		return nil
+	}
+	return rabbitmq.RequeueAfter(ErrDryRun, config.DryRun().RequeueDelay())
+}
@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSendSingleDryRun(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	viper.Set("dry_run.enabled", true)
+	s := &fakeSender{}
+	instance = s
+	t.Cleanup(func() {
+		storage.SetPath("")
+		viper.Set("dry_run.enabled", nil)
+		viper.Set("dry_run.requeue", nil)
+		instance = nil
+	})
+
+	m := &mailer.Mailer{
+		Type: mailer.TypeNormal,
+		Mail: mailer.Mail{To: []string{"user@example.com"}, Subject: "s", Body: "<p>hello</p>"},
+	}
+	result, err := SendSingle(context.Background(), m)
+	require.NoError(t, err)
+	assert.Equal(t, "dry-run", result.Provider)
+	assert.Equal(t, []string{"user@example.com"}, result.Accepted)
+	assert.Equal(t, 0, s.calls, "演练模式下不应调用驱动")
+	records, err := sendlog.Search(sendlog.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, records, "演练模式下不应写入发送日志")
+
+	out := &recordingSender{name: "outbox"}
+	dryRunSender = out
+	t.Cleanup(func() { dryRunSender = nil })
+	viper.Set("dry_run.requeue", true)
+	_, err = SendSingle(context.Background(), m)
+	assert.ErrorIs(t, err, ErrDryRun)
+	var r interface{ RequeueAfter() time.Duration }
+	assert.True(t, errors.As(err, &r), "放回队列时应返回可被消费者识别的错误")
+	assert.Len(t, out.mailers, 1)
+
+	results, err := SendBatch(context.Background(), testBatch(2))
+	assert.ErrorIs(t, err, ErrDryRun)
+	assert.Len(t, results, 2)
+	assert.Equal(t, 0, s.calls)
+}
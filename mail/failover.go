@@ -0,0 +1,201 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"go.uber.org/zap"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failoverProvider 故障转移链中的一个服务商及其健康状态
+type failoverProvider struct {
+	driver driver.Type
+	sender mailer.Sender
+
+	mu             sync.Mutex
+	failures       int       // 连续暂时性失败次数
+	unhealthyUntil time.Time // 在此之前跳过该服务商
+}
+
+func (p *failoverProvider) available(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !now.Before(p.unhealthyUntil)
+}
+
+// FailoverSender 按顺序尝试多个驱动：当前驱动返回暂时性错误时换用下一个。
+// 连续失败达到阈值的驱动会在冷却期内被跳过，冷却结束后重新参与发送，
+// 再次失败会立即重新进入冷却，成功则恢复健康。
+type FailoverSender struct {
+	providers []*failoverProvider
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+func NewFailoverSender(threshold int, cooldown time.Duration) *FailoverSender {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &FailoverSender{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Add 将驱动追加到链尾，先添加的驱动优先级更高
+func (t *FailoverSender) Add(d driver.Type, sender mailer.Sender) {
+	t.providers = append(t.providers, &failoverProvider{driver: d, sender: sender})
+}
+
+// String 返回驱动链的描述，例如 failover(aliyun,smtp)
+func (t *FailoverSender) String() string {
+	names := make([]string, 0, len(t.providers))
+	for _, p := range t.providers {
+		names = append(names, p.driver.String())
+	}
+	return "failover(" + strings.Join(names, ",") + ")"
+}
+
+// candidates 返回本次发送的尝试顺序：可用的驱动在前；
+// 冷却中的驱动排在最后作为兜底，避免所有驱动都被标记时直接放弃。
+func (t *FailoverSender) candidates() []*failoverProvider {
+	now := t.now()
+	available := make([]*failoverProvider, 0, len(t.providers))
+	var cooling []*failoverProvider
+	for _, p := range t.providers {
+		if p.available(now) {
+			available = append(available, p)
+		} else {
+			cooling = append(cooling, p)
+		}
+	}
+	return append(available, cooling...)
+}
+
+// Capabilities 返回链中所有驱动共同支持的特性，保证换用任意驱动时都不会因特性缺失而失败
+func (t *FailoverSender) Capabilities() mailer.Capabilities {
+	if len(t.providers) == 0 {
+		return mailer.Capabilities{}
+	}
+	c := mailer.Capabilities{Attachments: true, InlineAttachments: true, CustomHeaders: true, Templates: true}
+	for _, p := range t.providers {
+		pc := mailer.CapabilitiesOf(p.sender)
+		c.Attachments = c.Attachments && pc.Attachments
+		c.InlineAttachments = c.InlineAttachments && pc.InlineAttachments
+		c.CustomHeaders = c.CustomHeaders && pc.CustomHeaders
+		c.Templates = c.Templates && pc.Templates
+	}
+	return c
+}
+
+func (t *FailoverSender) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	var result *mailer.Result
+	err := t.try(ctx, func(p *failoverProvider) (err error) {
+		result, err = p.sender.SendSingle(ctx, m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MaxBatchSize 返回链中驱动批量发送上限的最小值，保证换用任意驱动时都不会超出上限
+func (t *FailoverSender) MaxBatchSize() int {
+	size := 0
+	for _, p := range t.providers {
+		b, ok := p.sender.(mailer.BatchSender)
+		if !ok {
+			return 1
+		}
+		if size == 0 || b.MaxBatchSize() < size {
+			size = b.MaxBatchSize()
+		}
+	}
+	return max(size, 1)
+}
+
+// SendBatch 与 SendSingle 相同，按顺序尝试各驱动的批量发送。
+// 链中存在不支持批量发送的驱动时返回 mailer.ErrBatchUnsupported，由调用方逐个调用 SendSingle，仍会故障转移
+func (t *FailoverSender) SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	for _, p := range t.providers {
+		if _, ok := p.sender.(mailer.BatchSender); !ok {
+			return nil, errors.Wrapf(mailer.ErrBatchUnsupported, "驱动 %s 不支持批量发送", p.driver)
+		}
+	}
+	var results []*mailer.RecipientResult
+	err := t.try(ctx, func(p *failoverProvider) (err error) {
+		results, err = p.sender.(mailer.BatchSender).SendBatch(ctx, b)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// try 按 candidates 的顺序调用 send，遇到暂时性错误时换用下一个驱动
+func (t *FailoverSender) try(ctx context.Context, send func(p *failoverProvider) error) error {
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	if len(t.providers) == 0 {
+		return errors.New("故障转移链中没有可用的邮件驱动")
+	}
+	var errs error
+	var requeue time.Duration // 各驱动要求的最长重新投递延迟，例如每日额度重置的时间
+	for _, p := range t.candidates() {
+		err := send(p)
+		if err == nil {
+			t.markSuccess(p)
+			logger.Info("[mail.failover] 邮件已发送", zap.Stringer("driver", p.driver))
+			return nil
+		}
+		errs = errors.CombineErrors(errs, errors.Wrapf(err, "驱动 %s 发送失败", p.driver))
+		if !mailer.IsTemporary(err) || ctx.Err() != nil {
+			return errs
+		}
+		var r interface{ RequeueAfter() time.Duration }
+		if errors.As(err, &r) {
+			requeue = max(requeue, r.RequeueAfter())
+		}
+		t.markFailure(ctx, p)
+		logger.Warn("[mail.failover] 驱动发送失败，尝试下一个驱动",
+			zap.Stringer("driver", p.driver),
+			zap.Error(err),
+		)
+	}
+	// 合并后只有第一个错误可以通过 errors.As 取得，因此显式保留重新投递延迟
+	if requeue > 0 {
+		return rabbitmq.RequeueAfter(mailer.Temporary(errs), requeue)
+	}
+	return mailer.Temporary(errs)
+}
+
+func (t *FailoverSender) markSuccess(p *failoverProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures = 0
+	p.unhealthyUntil = time.Time{}
+}
+
+func (t *FailoverSender) markFailure(ctx context.Context, p *failoverProvider) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failures++
+	if p.failures >= t.threshold {
+		p.unhealthyUntil = t.now().Add(t.cooldown)
+		logging.WithContext(ctx).Warn("[mail.failover] 驱动连续失败次数过多，暂时标记为不可用",
+			zap.Stringer("driver", p.driver),
+			zap.Int("failures", p.failures),
+			zap.Time("until", p.unhealthyUntil),
+		)
+	}
+}
@@ -0,0 +1,112 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	err   error
+	calls int
+}
+
+func (f *fakeSender) SendSingle(context.Context, *mailer.Mailer) (*mailer.Result, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &mailer.Result{Provider: "fake"}, nil
+}
+
+func send(s mailer.Sender) error {
+	_, err := s.SendSingle(context.Background(), &mailer.Mailer{})
+	return err
+}
+
+func TestFailoverSenderFallsBackOnTemporaryError(t *testing.T) {
+	primary := &fakeSender{err: mailer.Temporary(errors.New("throttled"))}
+	secondary := &fakeSender{}
+	f := NewFailoverSender(2, time.Minute)
+	f.Add(driver.TypeAliyun, primary)
+	f.Add(driver.TypeSMTP, secondary)
+
+	assert.NoError(t, send(f))
+	assert.Equal(t, 1, primary.calls)
+	assert.Equal(t, 1, secondary.calls)
+}
+
+func TestFailoverSenderStopsOnPermanentError(t *testing.T) {
+	primary := &fakeSender{err: errors.New("invalid address")}
+	secondary := &fakeSender{}
+	f := NewFailoverSender(2, time.Minute)
+	f.Add(driver.TypeAliyun, primary)
+	f.Add(driver.TypeSMTP, secondary)
+
+	assert.Error(t, send(f))
+	assert.Equal(t, 0, secondary.calls)
+}
+
+func TestFailoverSenderCooldown(t *testing.T) {
+	now := time.Now()
+	primary := &fakeSender{err: mailer.Temporary(errors.New("503"))}
+	secondary := &fakeSender{}
+	f := NewFailoverSender(2, time.Minute)
+	f.now = func() time.Time { return now }
+	f.Add(driver.TypeAliyun, primary)
+	f.Add(driver.TypeSMTP, secondary)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, send(f))
+	}
+	assert.Equal(t, 2, primary.calls, "达到阈值后应跳过主驱动")
+
+	// 冷却结束后重新探测，成功则恢复
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	assert.NoError(t, send(f))
+	assert.Equal(t, 3, primary.calls)
+	assert.Equal(t, 3, secondary.calls)
+}
+
+func TestFailoverSenderKeepsRequeueDelay(t *testing.T) {
+	resetAt := time.Now().Add(time.Hour)
+	primary := &fakeSender{err: mailer.Temporary(errors.New("503"))}
+	secondary := &fakeSender{err: &QuotaExceededError{Driver: driver.TypeSMTP, ResetAt: resetAt}}
+	f := NewFailoverSender(2, time.Minute)
+	f.Add(driver.TypeAliyun, primary)
+	f.Add(driver.TypeSMTP, secondary)
+
+	err := send(f)
+	assert.True(t, mailer.IsTemporary(err))
+	var r interface{ RequeueAfter() time.Duration }
+	if assert.True(t, errors.As(err, &r), "备用驱动额度用完时也应保留重新投递延迟") {
+		assert.InDelta(t, time.Hour, r.RequeueAfter(), float64(time.Minute))
+	}
+}
+
+func TestFailoverSenderBatch(t *testing.T) {
+	primary := &fakeBatchSender{size: 100, err: mailer.Temporary(errors.New("503"))}
+	secondary := &fakeBatchSender{size: 50}
+	f := NewFailoverSender(2, time.Minute)
+	f.Add(driver.TypeAliyun, primary)
+	f.Add(driver.TypeSendCloud, secondary)
+
+	assert.Equal(t, 50, f.MaxBatchSize())
+	results, err := sendBatch(context.Background(), f, testBatch(3))
+	require.NoError(t, err)
+	assert.Len(t, results, 3)
+	assert.Equal(t, [][]string{{"a@example.com", "b@example.com", "c@example.com"}}, secondary.batches, "主驱动失败时应换用备用驱动批量发送")
+
+	// 存在不支持批量发送的驱动时逐个发送
+	plain := &fakeSender{}
+	f.Add(driver.TypeSMTP, plain)
+	assert.Equal(t, 1, f.MaxBatchSize())
+	_, err = f.SendBatch(context.Background(), testBatch(1))
+	assert.ErrorIs(t, err, mailer.ErrBatchUnsupported)
+}
@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	netmail "net/mail"
+)
+
+// applyIdentity 按通知类型（Meta.Kind）填充发件人、回复地址与邮件标签。
+// 只填充邮件中为空的字段，调用方显式指定的值优先；均未配置时由驱动使用其默认发件人。
+func applyIdentity(m *mailer.Mailer) {
+	fillIdentity(m.Meta.Kind, &m.Mail.From, &m.Mail.ReplyTo, &m.Mail.Tag)
+}
+
+// applyBatchIdentity 与 applyIdentity 相同，用于批量邮件
+func applyBatchIdentity(b *mailer.Batch) {
+	fillIdentity(b.Meta.Kind, &b.From, &b.ReplyTo, &b.Tag)
+}
+
+func fillIdentity(kind string, from, replyTo, tag *string) {
+	id := config.MailIdentity(kind)
+	if *from == "" {
+		if address := id.From(); address != "" {
+			*from = (&netmail.Address{Name: id.Name(), Address: address}).String()
+		}
+	}
+	if *replyTo == "" {
+		*replyTo = id.ReplyTo()
+	}
+	if *tag == "" {
+		*tag = id.Tag()
+	}
+}
@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	netmail "net/mail"
+	"testing"
+)
+
+func TestApplyIdentity(t *testing.T) {
+	viper.Set("mail.identities.default.reply_to", "support@hitokoto.cn")
+	viper.Set("mail.identities.hitokoto_poll_daily_report.from", "poll@mail.hitokoto.cn")
+	viper.Set("mail.identities.hitokoto_poll_daily_report.name", "一言投票")
+	viper.Set("mail.identities.hitokoto_poll_daily_report.tag", "poll")
+	t.Cleanup(func() {
+		viper.Set("mail.identities.default.reply_to", "")
+		viper.Set("mail.identities.hitokoto_poll_daily_report", nil)
+	})
+
+	m := &mailer.Mailer{Meta: mailer.Meta{Kind: "hitokoto_poll_daily_report"}}
+	applyIdentity(m)
+	from, err := netmail.ParseAddress(m.Mail.From)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "一言投票", from.Name)
+		assert.Equal(t, "poll@mail.hitokoto.cn", from.Address)
+	}
+	assert.Equal(t, "support@hitokoto.cn", m.Mail.ReplyTo)
+	assert.Equal(t, "poll", m.Mail.Tag)
+
+	// 未单独配置的类型只使用默认配置，显式指定的字段不会被覆盖
+	m = &mailer.Mailer{Mail: mailer.Mail{ReplyTo: "reviewer@hitokoto.cn"}, Meta: mailer.Meta{Kind: "hitokoto_appended"}}
+	applyIdentity(m)
+	assert.Empty(t, m.Mail.From)
+	assert.Equal(t, "reviewer@hitokoto.cn", m.Mail.ReplyTo)
+	assert.Empty(t, m.Mail.Tag)
+}
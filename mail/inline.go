@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/consts"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// LogoContentID 为内联 Logo 的 Content-ID，模板中可以通过 cid:hitokoto-logo 引用
+const LogoContentID = "hitokoto-logo"
+
+var (
+	logoOnce sync.Once
+	logo     []byte
+)
+
+func loadLogo(ctx context.Context) []byte {
+	logoOnce.Do(func() {
+		path := config.MailInlineLogo()
+		if path == "" {
+			return
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			logging.WithContext(ctx).Warn("[mail] 无法读取内联 Logo，将继续使用 CDN 地址", zap.String("path", path), zap.Error(err))
+			return
+		}
+		logo = b
+	})
+	return logo
+}
+
+// embedLogo 在驱动支持内联资源时，将正文中的 CDN Logo 地址替换为内联资源
+func embedLogo(ctx context.Context, sender mailer.Sender, m *mailer.Mailer) {
+	if m.Type != mailer.TypeNormal ||
+		!strings.Contains(m.Mail.Body, consts.Logo) ||
+		!mailer.CapabilitiesOf(sender).InlineAttachments {
+		return
+	}
+	b := loadLogo(ctx)
+	if b == nil {
+		return
+	}
+	m.Mail.Body = strings.ReplaceAll(m.Mail.Body, consts.Logo, "cid:"+LogoContentID)
+	m.Mail.Attachments = append(m.Mail.Attachments, &mailer.Attachment{
+		Filename:  filepath.Base(config.MailInlineLogo()),
+		ContentID: LogoContentID,
+		Data:      b,
+	})
+}
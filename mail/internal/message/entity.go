@@ -0,0 +1,164 @@
+package message
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"path"
+	"sort"
+)
+
+// entity 为 MIME 树中的一个节点
+type entity struct {
+	header textproto.MIMEHeader
+	write  func(w io.Writer) error
+}
+
+// bodyEntity 根据邮件内容组装 MIME 树：
+//
+//	multipart/mixed
+//	├── multipart/alternative（存在纯文本正文时）
+//	│   ├── text/plain
+//	│   └── multipart/related（存在内联资源时）
+//	│       ├── text/html
+//	│       └── 内联资源...
+//	└── 附件...
+func bodyEntity(m *mailer.Mail) (*entity, error) {
+	body := textEntity("text/html", m.Body)
+	var inline, attachments []*entity
+	for _, v := range m.Attachments {
+		e, err := attachmentEntity(v)
+		if err != nil {
+			return nil, err
+		}
+		if v.Inline() {
+			inline = append(inline, e)
+		} else {
+			attachments = append(attachments, e)
+		}
+	}
+	if len(inline) > 0 {
+		body = multipartEntity("related", append([]*entity{body}, inline...))
+	}
+	if m.Text != "" {
+		body = multipartEntity("alternative", []*entity{textEntity("text/plain", m.Text), body})
+	}
+	if len(attachments) > 0 {
+		body = multipartEntity("mixed", append([]*entity{body}, attachments...))
+	}
+	return body, nil
+}
+
+func textEntity(contentType, s string) *entity {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+"; charset=UTF-8")
+	header.Set("Content-Transfer-Encoding", "quoted-printable")
+	return &entity{
+		header: header,
+		write: func(w io.Writer) error {
+			qp := quotedprintable.NewWriter(w)
+			if _, err := qp.Write([]byte(s)); err != nil {
+				return errors.Wrap(err, "无法编码邮件正文")
+			}
+			return qp.Close()
+		},
+	}
+}
+
+func attachmentEntity(a *mailer.Attachment) (*entity, error) {
+	content, err := a.Content()
+	if err != nil {
+		return nil, err
+	}
+	contentType := a.ContentType
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(path.Ext(a.Filename)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	}
+	header := textproto.MIMEHeader{}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.Wrapf(err, "无效的附件类型：%s", contentType)
+	}
+	disposition := "attachment"
+	if a.Inline() {
+		disposition = "inline"
+		header.Set("Content-ID", "<"+a.ContentID+">")
+	}
+	if a.Filename != "" {
+		params["name"] = a.Filename
+		header.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Filename}))
+	} else {
+		header.Set("Content-Disposition", disposition)
+	}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	header.Set("Content-Transfer-Encoding", "base64")
+	return &entity{
+		header: header,
+		write: func(w io.Writer) error {
+			return writeBase64(w, content)
+		},
+	}, nil
+}
+
+func multipartEntity(subtype string, children []*entity) *entity {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary}))
+	return &entity{
+		header: header,
+		write: func(w io.Writer) error {
+			mw := multipart.NewWriter(w)
+			if err := mw.SetBoundary(boundary); err != nil {
+				return err
+			}
+			for _, child := range children {
+				pw, err := mw.CreatePart(child.header)
+				if err != nil {
+					return err
+				}
+				if err = child.write(pw); err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		},
+	}
+}
+
+// writeBase64 以每行 76 个字符写入 base64 编码的内容
+func writeBase64(w io.Writer, b []byte) error {
+	const lineLength = 76
+	encoded := base64.StdEncoding.EncodeToString(b)
+	buf := new(bytes.Buffer)
+	for len(encoded) > lineLength {
+		buf.WriteString(encoded[:lineLength])
+		buf.WriteString("\r\n")
+		encoded = encoded[lineLength:]
+	}
+	buf.WriteString(encoded)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeEntityHeader 写入顶层实体的头部，Content-Type 在前，其余按字母序
+func writeEntityHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	writeHeader(buf, "Content-Type", header.Get("Content-Type"))
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		if k != "Content-Type" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeHeader(buf, k, header.Get(k))
+	}
+}
@@ -0,0 +1,184 @@
+// Package message 将 mailer.Mail 编码为 RFC 5322 / MIME 格式的邮件，供 SMTP 等需要原始报文的驱动使用。
+package message
+
+import (
+	"bytes"
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Builder 描述一封待编码的邮件
+type Builder struct {
+	From   *mail.Address
+	Mail   *mailer.Mail
+	Header textproto.MIMEHeader // 额外写入的邮件头
+	Date   time.Time
+
+	messageID string
+}
+
+// MessageID 返回最近一次 Build 写入的 Message-ID
+func (b *Builder) MessageID() string {
+	return b.messageID
+}
+
+// Build 编码邮件，生成的报文不包含 Bcc 头
+func (b *Builder) Build() ([]byte, error) {
+	if b.From == nil {
+		return nil, errors.New("发件人不能为空")
+	}
+	if b.Mail == nil {
+		return nil, errors.New("邮件不能为空")
+	}
+	to, err := ParseAddressList(b.Mail.To)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析收件人")
+	}
+	cc, err := ParseAddressList(b.Mail.CC)
+	if err != nil {
+		return nil, errors.Wrap(err, "无法解析抄送人")
+	}
+	date := b.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	header := b.header()
+
+	buf := new(bytes.Buffer)
+	writeHeader(buf, "From", b.From.String())
+	writeHeader(buf, "To", joinAddresses(to))
+	if len(cc) > 0 {
+		writeHeader(buf, "Cc", joinAddresses(cc))
+	}
+	if b.Mail.ReplyTo != "" {
+		replyTo, err := mail.ParseAddress(b.Mail.ReplyTo)
+		if err != nil {
+			return nil, errors.Wrap(err, "无法解析回复地址")
+		}
+		writeHeader(buf, "Reply-To", replyTo.String())
+	}
+	writeHeader(buf, "Subject", mime.BEncoding.Encode("UTF-8", b.Mail.Subject))
+	writeHeader(buf, "Date", date.Format(time.RFC1123Z))
+	if b.messageID = getHeader(header, "Message-ID"); b.messageID == "" {
+		b.messageID = MessageID(b.From.Address)
+		writeHeader(buf, "Message-ID", b.messageID)
+	}
+	writeHeader(buf, "MIME-Version", "1.0")
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range header[k] {
+			writeHeader(buf, k, v)
+		}
+	}
+	body, err := bodyEntity(b.Mail)
+	if err != nil {
+		return nil, err
+	}
+	writeEntityHeader(buf, body.header)
+	buf.WriteString("\r\n")
+	if err = body.write(buf); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes(), nil
+}
+
+// reservedHeaders 由 Builder 生成的邮件头，不允许被自定义邮件头覆盖
+var reservedHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Reply-To": true, "Subject": true, "Date": true,
+	"Mime-Version": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+}
+
+// header 合并 Builder.Header 与邮件中的自定义邮件头，保留原始的键名写法
+func (b *Builder) header() textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader, len(b.Header))
+	for k, v := range b.Header {
+		header[k] = v
+	}
+	for k, v := range b.Mail.RawHeaders() {
+		if !validHeaderKey(k) || reservedHeaders[textproto.CanonicalMIMEHeaderKey(k)] {
+			continue
+		}
+		// 与 Builder.Header 中的同名头部（忽略大小写）互斥，以邮件中的为准
+		for existing := range header {
+			if strings.EqualFold(existing, k) {
+				delete(header, existing)
+			}
+		}
+		header[k] = []string{v}
+	}
+	return header
+}
+
+// getHeader 忽略大小写读取邮件头的第一个值
+func getHeader(header textproto.MIMEHeader, key string) string {
+	for k, v := range header {
+		if strings.EqualFold(k, key) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// validHeaderKey 检查邮件头名称是否只包含可打印的 ASCII 字符且不含冒号（RFC 5322 2.2）
+func validHeaderKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, c := range k {
+		if c <= ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAddressList 解析地址列表，支持 "名称 <地址>" 和纯地址两种写法
+func ParseAddressList(list []string) ([]*mail.Address, error) {
+	addresses := make([]*mail.Address, 0, len(list))
+	for _, v := range list {
+		address, err := mail.ParseAddress(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "无效的邮件地址：%s", v)
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, nil
+}
+
+// MessageID 生成一个以发件域名结尾的 Message-ID
+func MessageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndex(from, "@"); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	return "<" + uuid.NewString() + "@" + domain + ">"
+}
+
+func joinAddresses(addresses []*mail.Address) string {
+	s := make([]string, 0, len(addresses))
+	for _, v := range addresses {
+		s = append(s, v.String())
+	}
+	return strings.Join(s, ", ")
+}
+
+func writeHeader(buf *bytes.Buffer, key, value string) {
+	// 去除换行，防止邮件头注入
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	buf.WriteString(key)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteString("\r\n")
+}
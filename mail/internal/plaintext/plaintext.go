@@ -0,0 +1,194 @@
+// Package plaintext 将 HTML 邮件正文转换为纯文本，用作 text/plain 备选正文。
+// 转换会保留段落、链接（以「文字 (地址)」形式）、列表与引用，丢弃样式、脚本与图片。
+package plaintext
+
+import (
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// FromHTML 将 HTML 转换为纯文本
+func FromHTML(s string) string {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil { // html.Parse 仅在读取失败时返回错误
+		return ""
+	}
+	w := &writer{}
+	w.walk(doc)
+	return w.String()
+}
+
+type writer struct {
+	lines   []string
+	line    strings.Builder // 当前行的内容，不含前缀
+	prefix  []string        // 引用、列表等嵌套的行前缀
+	marker  string          // 列表标记，替代下一行的最后一层前缀
+	started bool            // 当前行是否已写入内容
+	space   bool            // 下次写入前是否需要补一个空格
+	newline int             // 下次写入前需要的换行数，2 表示空一行
+	current string          // 当前行的前缀
+}
+
+func (w *writer) String() string {
+	w.flush()
+	return strings.TrimSpace(strings.Join(w.lines, "\n")) + "\n"
+}
+
+// flush 结束当前行
+func (w *writer) flush() {
+	if w.started {
+		w.lines = append(w.lines, w.current+w.line.String())
+		w.line.Reset()
+		w.started = false
+	}
+	w.space = false
+}
+
+// block 在块级元素边界处换行
+func (w *writer) block(n int) {
+	w.flush()
+	w.newline = max(w.newline, n)
+}
+
+func (w *writer) text(s string) {
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			w.space = w.started
+			continue
+		}
+		w.write(string(r))
+	}
+}
+
+// write 写入不做空白折叠的内容
+func (w *writer) write(s string) {
+	if !w.started {
+		if w.newline > 1 && len(w.lines) > 0 && w.lines[len(w.lines)-1] != "" {
+			w.lines = append(w.lines, "")
+		}
+		w.newline = 0
+		w.current = strings.Join(w.prefix, "")
+		if w.marker != "" {
+			w.current = strings.Join(w.prefix[:len(w.prefix)-1], "") + w.marker
+			w.marker = ""
+		}
+		w.started = true
+		w.space = false
+	}
+	if w.space {
+		w.line.WriteByte(' ')
+		w.space = false
+	}
+	w.line.WriteString(s)
+}
+
+func (w *writer) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+func (w *writer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title, atom.Img:
+	case atom.Br:
+		if w.started {
+			w.flush()
+		} else { // 连续的换行保留为一个空行
+			w.newline = min(w.newline+1, 2)
+		}
+	case atom.Hr:
+		w.block(2)
+		w.write("----------")
+		w.block(2)
+	case atom.A:
+		w.link(n)
+	case atom.Ul, atom.Ol:
+		w.list(n)
+	case atom.Blockquote:
+		w.block(2)
+		w.prefix = append(w.prefix, "> ")
+		w.children(n)
+		w.block(2)
+		w.prefix = w.prefix[:len(w.prefix)-1]
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Pre, atom.Table:
+		w.block(2)
+		w.children(n)
+		w.block(2)
+	case atom.Div, atom.Tr, atom.Li, atom.Dd, atom.Dt:
+		w.block(1)
+		w.children(n)
+		w.block(1)
+	case atom.Td, atom.Th:
+		w.space = w.started
+		w.children(n)
+		w.space = w.started
+	default:
+		w.children(n)
+	}
+}
+
+func (w *writer) link(n *html.Node) {
+	var href string
+	for _, v := range n.Attr {
+		if v.Key == "href" {
+			href = strings.TrimSpace(v.Val)
+		}
+	}
+	start := 0
+	if w.started {
+		start = w.line.Len()
+	}
+	w.children(n)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return
+	}
+	label := strings.TrimSpace(w.line.String()[min(start, w.line.Len()):])
+	if label == href || label == strings.TrimPrefix(href, "mailto:") {
+		return
+	}
+	if label == "" {
+		w.write(href)
+		return
+	}
+	w.space = false
+	w.write(" (" + href + ")")
+}
+
+func (w *writer) list(n *html.Node) {
+	w.block(2)
+	ordered := n.DataAtom == atom.Ol
+	i := 0
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			w.walk(c)
+			continue
+		}
+		i++
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(i) + ". "
+		}
+		w.block(1)
+		// 列表项的后续行与标记后的文字对齐
+		w.prefix = append(w.prefix, strings.Repeat(" ", len(marker)))
+		w.marker = marker
+		w.children(c)
+		w.flush()
+		w.marker = ""
+		w.prefix = w.prefix[:len(w.prefix)-1]
+	}
+	w.block(2)
+}
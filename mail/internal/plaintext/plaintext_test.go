@@ -0,0 +1,44 @@
+package plaintext
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromHTML(t *testing.T) {
+	s := FromHTML(`<html><head><title>一言</title><style>p { color: red; }</style></head><body>
+<h1>您好，a632079。</h1>
+<p>您于 2023-10-01 提交的句子：</p>
+<br />
+<p style="text-align: center;"><b>人生若只如初见</b></p>
+<p> —— 纳兰性德 「木兰词」</p>
+<blockquote><p>引用的内容<br>第二行</p></blockquote>
+<ul><li>第一项</li><li>第二项<br>续行</li></ul>
+<ol><li>甲</li><li>乙</li></ol>
+<p>请<a href="https://hitokoto.cn/">点击这里</a>查看，或发信至 <a href="mailto:i@loli.online">i@loli.online</a>。<img src="logo.png" alt="logo"></p>
+<table><tr><td>总数</td><td>10</td></tr><tr><td>通过</td><td>8</td></tr></table>
+</body></html>`)
+	assert.Equal(t, `您好，a632079。
+
+您于 2023-10-01 提交的句子：
+
+人生若只如初见
+
+—— 纳兰性德 「木兰词」
+
+> 引用的内容
+> 第二行
+
+- 第一项
+- 第二项
+  续行
+
+1. 甲
+2. 乙
+
+请点击这里 (https://hitokoto.cn/)查看，或发信至 i@loli.online。
+
+总数 10
+通过 8
+`, s)
+}
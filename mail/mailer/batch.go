@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+)
+
+// Batch 批量模板邮件：同一模板发送给多个收件人，每个收件人单独收到一封邮件。
+// Template.Data 为所有收件人共用的变量，Recipient.Data 中的同名变量会覆盖它。
+type Batch struct {
+	From       string
+	ReplyTo    string
+	Tag        string // 服务商的邮件标签，例如阿里云的 TagName
+	Subject    string
+	Template   *Template
+	Recipients []*Recipient
+	Meta       Meta
+}
+
+// Recipient 批量邮件的一个收件人
+type Recipient struct {
+	To   string
+	Data map[string]interface{}
+}
+
+// RecipientResult 单个收件人的发送结果，Err 与 Skipped 均为空表示服务商已接受该收件人
+type RecipientResult struct {
+	To      string
+	Err     error
+	Skipped string // 未发送的原因，例如收件人在抑制列表中；跳过不视为失败
+}
+
+// BatchSender 可由 Sender 选择性实现，用于在一次请求中向多个收件人发送模板邮件。
+// 未实现该接口的 Sender 会逐个调用 SendSingle。
+type BatchSender interface {
+	Sender
+	// MaxBatchSize 单次 SendBatch 允许的最大收件人数，调用方负责据此分批
+	MaxBatchSize() int
+	// SendBatch 发送一批邮件，返回的结果与 Batch.Recipients 一一对应。
+	// 返回 ErrBatchUnsupported 时调用方会改为逐个发送。
+	SendBatch(ctx context.Context, b *Batch) ([]*RecipientResult, error)
+}
+
+var ErrBatchUnsupported = errors.New("当前邮件驱动无法批量发送该邮件")
+
+// Data 返回合并公共变量后的收件人变量
+func (b *Batch) Data(r *Recipient) map[string]interface{} {
+	data := make(map[string]interface{}, len(r.Data))
+	if b.Template != nil {
+		for k, v := range b.Template.Data {
+			data[k] = v
+		}
+	}
+	for k, v := range r.Data {
+		data[k] = v
+	}
+	return data
+}
+
+// Mailer 将收件人展开为一封单独的模板邮件
+func (b *Batch) Mailer(r *Recipient) *Mailer {
+	var id string
+	if b.Template != nil {
+		id = b.Template.ID
+	}
+	return &Mailer{
+		Type: TypeTemplate,
+		Mail: Mail{
+			From:    b.From,
+			ReplyTo: b.ReplyTo,
+			To:      []string{r.To},
+			Subject: b.Subject,
+			Tag:     b.Tag,
+		},
+		Template: &Template{ID: id, Data: b.Data(r)},
+		Meta:     b.Meta,
+	}
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"net"
+)
+
+// temporaryError 将错误标记为暂时性错误
+type temporaryError struct {
+	error
+}
+
+func (e *temporaryError) Temporary() bool {
+	return true
+}
+
+func (e *temporaryError) Unwrap() error {
+	return e.error
+}
+
+// Temporary 将 err 标记为暂时性错误（如限流、服务端 5xx），表示稍后重试或换用其他服务商可能成功
+func Temporary(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &temporaryError{err}
+}
+
+// IsTemporary 判断发送失败是否为暂时性错误。
+// 驱动可以通过实现 Temporary() bool 方法或使用 Temporary 包装来声明；网络错误一律视为暂时性错误。
+// 调用方上下文被取消时返回 false，此时不应再继续尝试。
+func IsTemporary(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var t interface{ Temporary() bool }
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// permanentError 将错误标记为永久性错误
+type permanentError struct {
+	error
+}
+
+func (e *permanentError) Permanent() bool {
+	return true
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.error
+}
+
+// Permanent 将 err 标记为永久性错误（如收件人地址无效、发信账号不存在），表示重试不会成功，应直接进入死信流程
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsPermanent 判断发送失败是否被驱动明确标记为永久性错误。
+// 未被标记的错误既不是暂时性也不是永久性错误时，由调用方决定如何处理。
+func IsPermanent(err error) bool {
+	var p interface{ Permanent() bool }
+	return !IsTemporary(err) && errors.As(err, &p) && p.Permanent()
+}
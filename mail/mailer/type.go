@@ -1,9 +1,53 @@
 package mailer
 
-import "context"
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"io"
+	"strings"
+	"time"
+)
 
 type Sender interface {
-	SendSingle(ctx context.Context, mail *Mailer) error
+	// SendSingle 发送一封邮件，成功时返回服务商的发送结果
+	SendSingle(ctx context.Context, mail *Mailer) (*Result, error)
+}
+
+// Result 服务商接受邮件后的发送结果
+type Result struct {
+	Provider  string        // 实际发送邮件的驱动，例如 aliyun
+	MessageID string        // 服务商返回的邮件 ID（如阿里云的 EnvId），用于在服务商控制台中检索
+	RequestID string        // 服务商的请求 ID，用于提交工单
+	Accepted  []string      // 服务商已接受的收件人
+	Latency   time.Duration // 发送耗时
+	// Failed 拆分发送时部分收件人发送失败，其余收件人已经发送，整封邮件视为发送成功。
+	// 这些收件人不会被重试，以免已发送的收件人重复收到邮件
+	Failed []*RecipientResult
+}
+
+// Capabilities 描述驱动支持的可选特性
+type Capabilities struct {
+	Attachments       bool // 普通附件
+	InlineAttachments bool // 通过 cid: 引用的内联资源
+	// 自定义邮件头（含 Message-ID、In-Reply-To、References）。
+	// 不支持的驱动会忽略这些邮件头，邮件仍会正常发送，只是无法归入会话。
+	CustomHeaders bool
+	// 服务商的模板邮件（TypeTemplate）。不支持的驱动收到模板邮件时，由 mail 包在本地渲染后作为普通邮件发送。
+	Templates bool
+}
+
+// Capable 可由 Sender 选择性实现，用于声明其支持的特性。
+// 未实现该接口的 Sender 视为不支持任何可选特性。
+type Capable interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf 返回 Sender 支持的特性
+func CapabilitiesOf(s Sender) Capabilities {
+	if c, ok := s.(Capable); ok {
+		return c.Capabilities()
+	}
+	return Capabilities{}
 }
 
 type Type int
@@ -18,15 +62,74 @@ type Mailer struct {
 	Mail     Mail
 	Body     *MailBody
 	Template *Template
+	Meta     Meta
+}
+
+// Meta 写入发送日志、用于检索的信息，不会出现在邮件中
+type Meta struct {
+	Template string // 渲染正文所用的模板名称，模板邮件为空时取 Template.ID
+	Ref      string // 关联的业务 ID，例如句子 UUID
+	Kind     string // 通知类型，例如 hitokoto_appended，用于选择发件人身份（见 mail.identities 配置）
 }
 
 type Mail struct {
-	From    string
-	To      []string
-	CC      []string
-	BCC     []string
-	Subject string
-	Body    string
+	From        string
+	To          []string
+	CC          []string
+	BCC         []string
+	Subject     string
+	Body        string // HTML 正文
+	Text        string // 纯文本正文，为空时由 HTML 正文生成
+	Attachments []*Attachment
+
+	ReplyTo    string            // 回复地址
+	MessageID  string            // 含尖括号的 Message-ID，为空时由驱动或服务商生成
+	InReplyTo  string            // 含尖括号的上级 Message-ID
+	References []string          // 会话中的祖先 Message-ID
+	Headers    map[string]string // 其他自定义邮件头
+
+	Tag string // 服务商的邮件标签，用于在控制台中按类型统计，例如阿里云的 TagName；不支持的驱动会忽略
+}
+
+// Thread 将邮件归入以 root 为根的会话，id 为本邮件的 Message-ID，均不含尖括号
+func (m *Mail) Thread(root, id string) {
+	m.MessageID = "<" + id + ">"
+	m.InReplyTo = "<" + root + ">"
+	m.References = []string{m.InReplyTo}
+}
+
+// RawHeaders 返回需要原样写入邮件的头部，包括会话相关头部与自定义头部
+func (m *Mail) RawHeaders() map[string]string {
+	headers := make(map[string]string, len(m.Headers)+3)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	if m.MessageID != "" {
+		headers["Message-ID"] = m.MessageID
+	}
+	if m.InReplyTo != "" {
+		headers["In-Reply-To"] = m.InReplyTo
+	}
+	if len(m.References) > 0 {
+		headers["References"] = strings.Join(m.References, " ")
+	}
+	return headers
+}
+
+// Recipients 返回收件人、抄送与密送的全部地址
+func (m *Mail) Recipients() []string {
+	rcpt := make([]string, 0, len(m.To)+len(m.CC)+len(m.BCC))
+	return append(append(append(rcpt, m.To...), m.CC...), m.BCC...)
+}
+
+// HasInlineAttachments 判断邮件是否包含内联资源
+func (m *Mail) HasInlineAttachments() bool {
+	for _, v := range m.Attachments {
+		if v.Inline() {
+			return true
+		}
+	}
+	return false
 }
 
 type MailBody struct {
@@ -38,3 +141,47 @@ type Template struct {
 	ID   string
 	Data map[string]interface{}
 }
+
+// Attachment 邮件附件。ContentID 不为空时作为内联资源，正文中通过 cid:ContentID 引用。
+// 内容可以由 Data 或 Reader 提供，Reader 会在首次读取后缓存到 Data 中，以便重试时复用。
+type Attachment struct {
+	Filename    string
+	ContentType string
+	ContentID   string
+	Data        []byte
+	Reader      io.Reader
+}
+
+func (a *Attachment) Inline() bool {
+	return a.ContentID != ""
+}
+
+// Content 返回附件内容
+func (a *Attachment) Content() ([]byte, error) {
+	if a.Data == nil && a.Reader != nil {
+		b, err := io.ReadAll(a.Reader)
+		if err != nil {
+			return nil, errors.Wrapf(err, "无法读取附件：%s", a.Filename)
+		}
+		a.Data, a.Reader = b, nil
+	}
+	return a.Data, nil
+}
+
+var (
+	ErrAttachmentUnsupported       = errors.New("当前邮件驱动不支持附件")
+	ErrInlineAttachmentUnsupported = errors.New("当前邮件驱动不支持内联资源")
+)
+
+// CheckAttachments 检查邮件附件是否被 Capabilities 支持，不支持时返回明确的错误
+func CheckAttachments(c Capabilities, m *Mail) error {
+	for _, v := range m.Attachments {
+		if v.Inline() && !c.InlineAttachments {
+			return errors.Wrapf(ErrInlineAttachmentUnsupported, "内联资源：%s", v.ContentID)
+		}
+		if !v.Inline() && !c.Attachments {
+			return errors.Wrapf(ErrAttachmentUnsupported, "附件：%s", v.Filename)
+		}
+	}
+	return nil
+}
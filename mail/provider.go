@@ -6,32 +6,100 @@ import (
 	"github.com/hitokoto-osc/notification-worker/mail/driver"
 	"github.com/hitokoto-osc/notification-worker/mail/mailer"
 	"go.uber.org/zap"
+	"time"
 
 	_ "github.com/hitokoto-osc/notification-worker/mail/driver/alicloud"
+	_ "github.com/hitokoto-osc/notification-worker/mail/driver/outbox"
+	_ "github.com/hitokoto-osc/notification-worker/mail/driver/sendcloud"
+	_ "github.com/hitokoto-osc/notification-worker/mail/driver/smtp"
+	_ "github.com/hitokoto-osc/notification-worker/mail/driver/tencentcloud"
 )
 
 func init() {
 	config.RegisterCallback(func() {
 		defer zap.L().Sync()
-		driverType := driver.Type(config.MailDriver())
-		d := driver.Get(driverType)
-		if d == nil {
-			zap.L().Fatal("无法加载邮件驱动：驱动不存在。", zap.Int("driver", int(driverType)))
+		senders := make(map[driver.Type]mailer.Sender)
+		instance, driverName = defaultSender(senders)
+		rules := config.MailRouting().Rules()
+		if len(rules) == 0 {
+			return
 		}
-		var err error
-		instance, err = d.Register()
-		if err != nil {
-			zap.L().Fatal("无法加载邮件驱动：驱动注册失败。", zap.Error(err), zap.Int("driver", int(driverType)))
+		r := NewRoutingSender(driverName, instance)
+		if d, ok := config.MailRouting().Default(); ok {
+			r = NewRoutingSender(d.String(), registered(senders, d))
 		}
+		for _, v := range rules {
+			r.Add(v.Driver.String(), registered(senders, v.Driver), v.Domains...)
+		}
+		zap.L().Info("已启用按收件人域名路由邮件驱动。", zap.Stringer("routing", r))
+		instance = r
+		driverName = r.String()
 	})
 }
 
+// defaultSender 返回 mail.driver 或故障转移链对应的驱动
+func defaultSender(senders map[driver.Type]mailer.Sender) (mailer.Sender, string) {
+	chain := config.MailFailover().Drivers()
+	if len(chain) == 0 {
+		return registered(senders, config.MailDriver()), config.MailDriver().String()
+	}
+	f := NewFailoverSender(config.MailFailover().FailureThreshold(), config.MailFailover().Cooldown())
+	for _, v := range chain {
+		f.Add(v, registered(senders, v))
+	}
+	zap.L().Info("已启用邮件驱动故障转移。", zap.Stringers("drivers", chain))
+	return f, f.String()
+}
+
+// registered 返回已注册的驱动，同一驱动在故障转移链与路由规则中共用一个实例与限速器
+func registered(senders map[driver.Type]mailer.Sender, driverType driver.Type) mailer.Sender {
+	if s, ok := senders[driverType]; ok {
+		return s
+	}
+	s := mustRegister(driverType)
+	senders[driverType] = s
+	return s
+}
+
+func mustRegister(driverType driver.Type) mailer.Sender {
+	d := driver.Get(driverType)
+	if d == nil {
+		zap.L().Fatal("无法加载邮件驱动：驱动不存在。", zap.Stringer("driver", driverType))
+	}
+	sender, err := d.Register()
+	if err != nil {
+		zap.L().Fatal("无法加载邮件驱动：驱动注册失败。", zap.Error(err), zap.Stringer("driver", driverType))
+	}
+	return withLimiter(driverType, sender)
+}
+
 var instance mailer.Sender
 
 func GetSender() mailer.Sender {
 	return instance
 }
 
-func SendSingle(ctx context.Context, m *mailer.Mailer) error {
-	return instance.SendSingle(ctx, m)
+// SendSingle 发送一封邮件。所有收件人均被抑制或在非生产环境中被丢弃时跳过发送，返回的结果与错误均为 nil。
+// 演练模式下不调用驱动，只记录渲染结果。
+func SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if !filterSuppressed(ctx, m) || !guardStaging(ctx, m) {
+		return nil, nil
+	}
+	applyIdentity(m)
+	if err := renderTemplate(instance, m); err != nil {
+		recordSend(ctx, m, nil, err)
+		return nil, err
+	}
+	fillText(m)
+	embedLogo(ctx, instance, m)
+	if config.DryRun().Enabled() {
+		return dryRun(ctx, m)
+	}
+	start := time.Now()
+	result, err := instance.SendSingle(ctx, m)
+	if result != nil && result.Latency == 0 {
+		result.Latency = time.Since(start)
+	}
+	recordSend(ctx, m, result, err)
+	return result, err
 }
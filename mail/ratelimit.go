@@ -0,0 +1,221 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"golang.org/x/time/rate"
+	"math"
+	"sync"
+	"time"
+)
+
+// quotaLocation 服务商（如阿里云邮件推送）按北京时间零点重置每日额度
+var quotaLocation = time.FixedZone("CST", 8*60*60)
+
+// QuotaExceededError 表示驱动当日额度已用完。
+// 它实现了 Temporary 与 RequeueAfter，故障转移会换用其他驱动，消费者会在额度重置后重新投递消息。
+type QuotaExceededError struct {
+	Driver  driver.Type
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("驱动 %s 今日发送额度已用完，将于 %s 重置", e.Driver, e.ResetAt.Format(time.DateTime))
+}
+
+func (e *QuotaExceededError) Temporary() bool {
+	return true
+}
+
+// RequeueAfter 返回距离额度重置的时间
+func (e *QuotaExceededError) RequeueAfter() time.Duration {
+	return time.Until(e.ResetAt)
+}
+
+// Budget 限速器的剩余额度
+type Budget struct {
+	Tokens  float64   // 令牌桶中的剩余令牌，不限速时为 +Inf
+	Daily   int       // 今日剩余额度，不限额时为 -1
+	ResetAt time.Time // 每日额度的重置时间
+}
+
+// Limiter 驱动的令牌桶限速与每日额度。
+// 每日计数只保存在进程内存中，重启后从零开始，因此应将 per_day 设置得比服务商额度略低。
+type Limiter struct {
+	driver driver.Type
+	rate   *rate.Limiter // 为空时不限速
+	perDay int           // 为 0 时不限额
+
+	mu   sync.Mutex
+	day  string
+	used int
+	now  func() time.Time
+}
+
+// NewLimiter 创建限速器，perSecond 与 perDay 均为 0 时返回 nil
+func NewLimiter(d driver.Type, perSecond float64, burst, perDay int) *Limiter {
+	if perSecond <= 0 && perDay <= 0 {
+		return nil
+	}
+	l := &Limiter{driver: d, perDay: perDay, now: time.Now}
+	if perSecond > 0 {
+		if burst <= 0 {
+			burst = int(math.Ceil(perSecond))
+		}
+		l.rate = rate.NewLimiter(rate.Limit(perSecond), burst)
+	}
+	return l
+}
+
+// Wait 占用 n 封邮件的额度，必要时阻塞至令牌可用或 ctx 结束。
+// 当日额度不足时立即返回 *QuotaExceededError。
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if err := l.reserve(n); err != nil {
+		return err
+	}
+	if l.rate != nil {
+		if err := l.rate.WaitN(ctx, n); err != nil {
+			l.Refund(n)
+			return errors.Wrap(err, "等待发送令牌失败")
+		}
+	}
+	return nil
+}
+
+// Refund 归还 n 封邮件的每日额度，用于服务商未接受的请求
+func (l *Limiter) Refund(n int) {
+	if l.perDay <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.day == l.today() {
+		l.used = max(l.used-n, 0)
+	}
+}
+
+// Remaining 返回限速器的剩余额度
+func (l *Limiter) Remaining() Budget {
+	b := Budget{Tokens: math.Inf(1), Daily: -1}
+	if l.rate != nil {
+		b.Tokens = l.rate.Tokens()
+	}
+	if l.perDay > 0 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.rollover()
+		b.Daily = l.perDay - l.used
+		b.ResetAt = l.resetAt()
+	}
+	return b
+}
+
+// MaxBurst 返回单次 Wait 允许的最大数量
+func (l *Limiter) MaxBurst() int {
+	if l.rate == nil {
+		return math.MaxInt
+	}
+	return l.rate.Burst()
+}
+
+func (l *Limiter) reserve(n int) error {
+	if l.perDay <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover()
+	if l.used+n > l.perDay {
+		return &QuotaExceededError{Driver: l.driver, ResetAt: l.resetAt()}
+	}
+	l.used += n
+	return nil
+}
+
+func (l *Limiter) today() string {
+	return l.now().In(quotaLocation).Format(time.DateOnly)
+}
+
+func (l *Limiter) rollover() {
+	if today := l.today(); today != l.day {
+		l.day, l.used = today, 0
+	}
+}
+
+func (l *Limiter) resetAt() time.Time {
+	y, m, d := l.now().In(quotaLocation).Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, quotaLocation)
+}
+
+// limitedSender 在调用驱动前等待限速器
+type limitedSender struct {
+	mailer.Sender
+	limiter *Limiter
+}
+
+func (t *limitedSender) Capabilities() mailer.Capabilities {
+	return mailer.CapabilitiesOf(t.Sender)
+}
+
+func (t *limitedSender) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	if err := t.limiter.Wait(ctx, 1); err != nil {
+		return nil, err
+	}
+	result, err := t.Sender.SendSingle(ctx, m)
+	if err != nil {
+		t.limiter.Refund(1)
+	}
+	return result, err
+}
+
+// limitedBatchSender 在 limitedSender 的基础上保留驱动的批量发送能力，一批邮件按收件人数计入额度
+type limitedBatchSender struct {
+	*limitedSender
+	batch mailer.BatchSender
+}
+
+func (t *limitedBatchSender) MaxBatchSize() int {
+	return min(t.batch.MaxBatchSize(), t.limiter.MaxBurst())
+}
+
+func (t *limitedBatchSender) SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	n := len(b.Recipients)
+	if err := t.limiter.Wait(ctx, n); err != nil {
+		return nil, err
+	}
+	results, err := t.batch.SendBatch(ctx, b)
+	if err != nil {
+		t.limiter.Refund(n)
+	}
+	return results, err
+}
+
+var limiters = map[driver.Type]*Limiter{}
+
+// withLimiter 按配置为驱动套上限速器，未配置限速时原样返回
+func withLimiter(d driver.Type, sender mailer.Sender) mailer.Sender {
+	c := config.MailRateLimit(d)
+	l := NewLimiter(d, c.PerSecond(), c.Burst(), c.PerDay())
+	if l == nil {
+		return sender
+	}
+	limiters[d] = l
+	s := &limitedSender{Sender: sender, limiter: l}
+	if b, ok := sender.(mailer.BatchSender); ok {
+		return &limitedBatchSender{limitedSender: s, batch: b}
+	}
+	return s
+}
+
+// RemainingBudget 返回各个已配置限速的驱动的剩余额度
+func RemainingBudget() map[driver.Type]Budget {
+	budgets := make(map[driver.Type]Budget, len(limiters))
+	for d, l := range limiters {
+		budgets[d] = l.Remaining()
+	}
+	return budgets
+}
@@ -0,0 +1,52 @@
+package mail
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/mail/driver"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimiterDailyQuota(t *testing.T) {
+	now := time.Date(2023, 10, 1, 23, 0, 0, 0, quotaLocation)
+	l := NewLimiter(driver.TypeAliyun, 0, 0, 2)
+	l.now = func() time.Time { return now }
+
+	require.NoError(t, l.Wait(context.Background(), 1))
+	require.NoError(t, l.Wait(context.Background(), 1))
+	err := l.Wait(context.Background(), 1)
+	var e *QuotaExceededError
+	require.ErrorAs(t, err, &e)
+	assert.Equal(t, time.Date(2023, 10, 2, 0, 0, 0, 0, quotaLocation), e.ResetAt)
+	assert.True(t, mailer.IsTemporary(err))
+	assert.Equal(t, 0, l.Remaining().Daily)
+
+	l.Refund(1)
+	assert.Equal(t, 1, l.Remaining().Daily)
+
+	now = now.Add(time.Hour) // 次日零点重置
+	assert.Equal(t, 2, l.Remaining().Daily)
+}
+
+func TestLimiterRespectsContext(t *testing.T) {
+	l := NewLimiter(driver.TypeAliyun, 0.001, 1, 0)
+	require.NoError(t, l.Wait(context.Background(), 1))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.Wait(ctx, 1))
+	assert.Equal(t, -1, l.Remaining().Daily)
+}
+
+func TestLimitedSenderRefundsOnError(t *testing.T) {
+	l := NewLimiter(driver.TypeAliyun, 0, 0, 1)
+	s := &limitedSender{Sender: &fakeSender{err: assert.AnError}, limiter: l}
+	assert.Error(t, send(s))
+	assert.Equal(t, 1, l.Remaining().Daily)
+}
+
+func TestNewLimiterDisabled(t *testing.T) {
+	assert.Nil(t, NewLimiter(driver.TypeSMTP, 0, 0, 0))
+}
@@ -0,0 +1,318 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"go.uber.org/zap"
+	netmail "net/mail"
+	"strings"
+)
+
+// routingRule 一条路由规则：收件人域名匹配 domains 时使用 sender 发送
+type routingRule struct {
+	name    string
+	domains []string
+	sender  mailer.Sender
+}
+
+func (r *routingRule) match(domain string) bool {
+	for _, v := range r.domains {
+		if matchDomain(v, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain 判断域名是否与 pattern 一致，*.example.com 匹配 example.com 的所有子域名
+func matchDomain(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(domain, "."+suffix)
+	}
+	return domain == pattern
+}
+
+// RoutingSender 按收件人域名选择驱动，例如 QQ 邮箱走 SMTP、其余走阿里云。
+// 规则按添加顺序匹配，未匹配任何规则的收件人使用 fallback。
+// 一封邮件的收件人分属不同驱动时会按驱动拆分为多封邮件分别发送。
+type RoutingSender struct {
+	fallbackName string
+	fallback     mailer.Sender
+	rules        []*routingRule
+}
+
+func NewRoutingSender(fallbackName string, fallback mailer.Sender) *RoutingSender {
+	return &RoutingSender{fallbackName: fallbackName, fallback: fallback}
+}
+
+// Add 追加一条路由规则，domains 中的 *.example.com 匹配 example.com 的所有子域名
+func (t *RoutingSender) Add(name string, sender mailer.Sender, domains ...string) {
+	t.rules = append(t.rules, &routingRule{name: name, domains: domains, sender: sender})
+}
+
+// String 返回路由的描述，例如 routing(smtp,aliyun)，最后一项为默认驱动
+func (t *RoutingSender) String() string {
+	names := make([]string, 0, len(t.rules)+1)
+	for _, r := range t.rules {
+		names = append(names, r.name)
+	}
+	return "routing(" + strings.Join(append(names, t.fallbackName), ",") + ")"
+}
+
+// domainOf 返回收件人地址的域名（小写），兼容 "名称 <地址>" 格式
+func domainOf(address string) string {
+	if a, err := netmail.ParseAddress(address); err == nil {
+		address = a.Address
+	}
+	i := strings.LastIndex(address, "@")
+	if i < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(address[i+1:]))
+}
+
+// route 返回收件人应使用的规则，nil 表示使用 fallback
+func (t *RoutingSender) route(address string) *routingRule {
+	domain := domainOf(address)
+	for _, r := range t.rules {
+		if r.match(domain) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Capabilities 返回所有驱动共同支持的特性，因为调用方在发送前无法确定邮件会交给哪个驱动
+func (t *RoutingSender) Capabilities() mailer.Capabilities {
+	c := mailer.CapabilitiesOf(t.fallback)
+	for _, r := range t.rules {
+		rc := mailer.CapabilitiesOf(r.sender)
+		c.Attachments = c.Attachments && rc.Attachments
+		c.InlineAttachments = c.InlineAttachments && rc.InlineAttachments
+		c.CustomHeaders = c.CustomHeaders && rc.CustomHeaders
+		c.Templates = c.Templates && rc.Templates
+	}
+	return c
+}
+
+// routedMail 拆分后交给同一驱动发送的邮件
+type routedMail struct {
+	name    string
+	sender  mailer.Sender
+	mailers []*mailer.Mailer
+}
+
+// split 按驱动拆分收件人。没有 To 的分组会将 CC 提升为 To；
+// 只有 BCC 的分组会为每个 BCC 收件人单独发送一封邮件，避免互相暴露地址。
+func (t *RoutingSender) split(m *mailer.Mailer) []*routedMail {
+	type group struct {
+		name        string
+		sender      mailer.Sender
+		to, cc, bcc []string
+	}
+	var groups []*group
+	index := make(map[*routingRule]*group)
+	add := func(address string, field func(g *group) *[]string) {
+		r := t.route(address)
+		g, ok := index[r]
+		if !ok {
+			g = &group{name: t.fallbackName, sender: t.fallback}
+			if r != nil {
+				g.name, g.sender = r.name, r.sender
+			}
+			index[r] = g
+			groups = append(groups, g)
+		}
+		p := field(g)
+		*p = append(*p, address)
+	}
+	for _, v := range m.Mail.To {
+		add(v, func(g *group) *[]string { return &g.to })
+	}
+	for _, v := range m.Mail.CC {
+		add(v, func(g *group) *[]string { return &g.cc })
+	}
+	for _, v := range m.Mail.BCC {
+		add(v, func(g *group) *[]string { return &g.bcc })
+	}
+	if len(groups) <= 1 {
+		// 所有收件人使用同一驱动时原样发送
+		r := &routedMail{name: t.fallbackName, sender: t.fallback, mailers: []*mailer.Mailer{m}}
+		if len(groups) == 1 {
+			r.name, r.sender = groups[0].name, groups[0].sender
+		}
+		return []*routedMail{r}
+	}
+	clone := func(to, cc, bcc []string) *mailer.Mailer {
+		c := *m
+		c.Mail.To, c.Mail.CC, c.Mail.BCC = to, cc, bcc
+		return &c
+	}
+	routed := make([]*routedMail, 0, len(groups))
+	for _, g := range groups {
+		r := &routedMail{name: g.name, sender: g.sender}
+		switch {
+		case len(g.to) > 0:
+			r.mailers = append(r.mailers, clone(g.to, g.cc, g.bcc))
+		case len(g.cc) > 0:
+			r.mailers = append(r.mailers, clone(g.cc, nil, g.bcc))
+		default:
+			for _, v := range g.bcc {
+				r.mailers = append(r.mailers, clone([]string{v}, nil, nil))
+			}
+		}
+		routed = append(routed, r)
+	}
+	return routed
+}
+
+// SendSingle 按收件人域名发送邮件。拆分发送时部分驱动发送失败，已发送的部分不再重发：
+// 返回合并后的结果与 nil 错误，失败的收件人及其错误记录在 Result.Failed 中；
+// 全部失败时返回合并后的错误，仅在所有失败均为暂时性错误时才视为暂时性错误。
+func (t *RoutingSender) SendSingle(ctx context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	routed := t.split(m)
+	if len(routed) == 1 && len(routed[0].mailers) == 1 {
+		return routed[0].sender.SendSingle(ctx, routed[0].mailers[0])
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	var (
+		results   []*mailer.Result
+		failed    []*mailer.RecipientResult
+		errs      error
+		temporary = true
+	)
+	for _, r := range routed {
+		for _, v := range r.mailers {
+			result, err := r.sender.SendSingle(ctx, v)
+			if err != nil {
+				err = errors.Wrapf(err, "驱动 %s 发送失败", r.name)
+				temporary = temporary && mailer.IsTemporary(err)
+				errs = errors.CombineErrors(errs, err)
+				for _, address := range v.Mail.Recipients() {
+					failed = append(failed, &mailer.RecipientResult{To: address, Err: err})
+				}
+				logger.Warn("[mail.routing] 部分收件人发送失败",
+					zap.String("driver", r.name),
+					zap.Strings("recipients", v.Mail.Recipients()),
+					zap.Error(err),
+				)
+				continue
+			}
+			if result == nil {
+				result = &mailer.Result{Provider: r.name, Accepted: v.Mail.Recipients()}
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		if temporary {
+			errs = mailer.Temporary(errs)
+		}
+		return nil, errs
+	}
+	merged := mergeResults(results)
+	if len(failed) > 0 {
+		// 合并结果可能是某个驱动返回的原始结果，复制后再写入失败的收件人
+		c := *merged
+		c.Failed = append(c.Failed, failed...)
+		merged = &c
+	}
+	return merged, nil
+}
+
+// MaxBatchSize 返回各驱动批量发送上限中的最大值。SendBatch 会按驱动拆分收件人，并按各驱动的上限再次分批
+func (t *RoutingSender) MaxBatchSize() int {
+	size := 1
+	for _, s := range append([]mailer.Sender{t.fallback}, t.senders()...) {
+		if b, ok := s.(mailer.BatchSender); ok {
+			size = max(size, b.MaxBatchSize())
+		}
+	}
+	return size
+}
+
+func (t *RoutingSender) senders() []mailer.Sender {
+	senders := make([]mailer.Sender, 0, len(t.rules))
+	for _, r := range t.rules {
+		senders = append(senders, r.sender)
+	}
+	return senders
+}
+
+// SendBatch 按收件人域名拆分批量邮件，每组交给对应的驱动批量发送；
+// 驱动不支持批量发送时该组逐个发送。返回的结果与 b.Recipients 一一对应
+func (t *RoutingSender) SendBatch(ctx context.Context, b *mailer.Batch) ([]*mailer.RecipientResult, error) {
+	type group struct {
+		name    string
+		sender  mailer.Sender
+		indexes []int
+		batch   mailer.Batch
+	}
+	var groups []*group
+	index := make(map[*routingRule]*group)
+	for i, v := range b.Recipients {
+		r := t.route(v.To)
+		g, ok := index[r]
+		if !ok {
+			g = &group{name: t.fallbackName, sender: t.fallback, batch: *b}
+			if r != nil {
+				g.name, g.sender = r.name, r.sender
+			}
+			g.batch.Recipients = nil
+			index[r] = g
+			groups = append(groups, g)
+		}
+		g.indexes = append(g.indexes, i)
+		g.batch.Recipients = append(g.batch.Recipients, v)
+	}
+	results := make([]*mailer.RecipientResult, len(b.Recipients))
+	for _, g := range groups {
+		r, err := sendBatch(ctx, g.sender, &g.batch)
+		if len(r) != len(g.batch.Recipients) {
+			r = failAll(&g.batch, errors.Wrapf(err, "驱动 %s 发送失败", g.name))
+		}
+		for i, v := range r {
+			results[g.indexes[i]] = v
+		}
+	}
+	return results, nil
+}
+
+// mergeResults 合并拆分发送的结果，没有任何结果时返回 nil
+func mergeResults(results []*mailer.Result) *mailer.Result {
+	if len(results) == 0 {
+		return nil
+	}
+	if len(results) == 1 {
+		return results[0]
+	}
+	var providers, messageIDs, requestIDs []string
+	merged := &mailer.Result{}
+	for _, v := range results {
+		providers = appendUnique(providers, v.Provider)
+		messageIDs = appendUnique(messageIDs, v.MessageID)
+		requestIDs = appendUnique(requestIDs, v.RequestID)
+		merged.Accepted = append(merged.Accepted, v.Accepted...)
+		merged.Latency = max(merged.Latency, v.Latency)
+	}
+	merged.Provider = strings.Join(providers, "+")
+	merged.MessageID = strings.Join(messageIDs, ",")
+	merged.RequestID = strings.Join(requestIDs, ",")
+	return merged
+}
+
+func appendUnique(s []string, v string) []string {
+	if v == "" {
+		return s
+	}
+	for _, e := range s {
+		if e == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
@@ -0,0 +1,191 @@
+package mail
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+// recordingSender 记录收到的邮件
+type recordingSender struct {
+	name    string
+	err     error
+	mailers []*mailer.Mailer
+}
+
+func (r *recordingSender) SendSingle(_ context.Context, m *mailer.Mailer) (*mailer.Result, error) {
+	r.mailers = append(r.mailers, m)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &mailer.Result{Provider: r.name, MessageID: r.name + "-id", Accepted: m.Mail.Recipients()}, nil
+}
+
+// capableSender 声明指定特性的驱动
+type capableSender struct {
+	caps mailer.Capabilities
+}
+
+func (c capableSender) SendSingle(context.Context, *mailer.Mailer) (*mailer.Result, error) {
+	return &mailer.Result{}, nil
+}
+
+func (c capableSender) Capabilities() mailer.Capabilities {
+	return c.caps
+}
+
+func TestRoutingSenderMatchesDomains(t *testing.T) {
+	smtp, aliyun := &recordingSender{name: "smtp"}, &recordingSender{name: "aliyun"}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "qq.com", "*.example.com")
+
+	assert.Same(t, r.rules[0], r.route("a@QQ.com"))
+	assert.Same(t, r.rules[0], r.route("Name <b@mail.example.com>"))
+	assert.Nil(t, r.route("c@example.com"))
+	assert.Nil(t, r.route("d@gmail.com"))
+	assert.Equal(t, "routing(smtp,aliyun)", r.String())
+}
+
+func TestRoutingSenderSingleRoute(t *testing.T) {
+	smtp, aliyun := &recordingSender{name: "smtp"}, &recordingSender{name: "aliyun"}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "qq.com")
+
+	m := &mailer.Mailer{Mail: mailer.Mail{To: []string{"a@qq.com"}, CC: []string{"b@qq.com"}}}
+	result, err := r.SendSingle(context.Background(), m)
+	assert.NoError(t, err)
+	assert.Equal(t, "smtp", result.Provider)
+	assert.Len(t, aliyun.mailers, 0)
+	assert.Same(t, m, smtp.mailers[0])
+}
+
+func TestRoutingSenderSplitsMixedRecipients(t *testing.T) {
+	smtp, aliyun := &recordingSender{name: "smtp"}, &recordingSender{name: "aliyun"}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "qq.com")
+
+	m := &mailer.Mailer{Mail: mailer.Mail{
+		Subject: "hi",
+		To:      []string{"a@gmail.com"},
+		CC:      []string{"b@qq.com"},
+		BCC:     []string{"c@gmail.com", "d@qq.com"},
+	}}
+	result, err := r.SendSingle(context.Background(), m)
+	assert.NoError(t, err)
+	if assert.Len(t, aliyun.mailers, 1) {
+		assert.Equal(t, []string{"a@gmail.com"}, aliyun.mailers[0].Mail.To)
+		assert.Equal(t, []string{"c@gmail.com"}, aliyun.mailers[0].Mail.BCC)
+		assert.Empty(t, aliyun.mailers[0].Mail.CC)
+	}
+	if assert.Len(t, smtp.mailers, 1) {
+		// 没有 To 时 CC 被提升为 To
+		assert.Equal(t, []string{"b@qq.com"}, smtp.mailers[0].Mail.To)
+		assert.Equal(t, []string{"d@qq.com"}, smtp.mailers[0].Mail.BCC)
+		assert.Equal(t, "hi", smtp.mailers[0].Mail.Subject)
+	}
+	assert.Equal(t, "aliyun+smtp", result.Provider)
+	assert.Equal(t, "aliyun-id,smtp-id", result.MessageID)
+	assert.ElementsMatch(t, []string{"a@gmail.com", "b@qq.com", "c@gmail.com", "d@qq.com"}, result.Accepted)
+	// 原邮件不应被修改
+	assert.Equal(t, []string{"b@qq.com"}, m.Mail.CC)
+}
+
+func TestRoutingSenderBCCOnlyGroup(t *testing.T) {
+	smtp, aliyun := &recordingSender{name: "smtp"}, &recordingSender{name: "aliyun"}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "qq.com")
+
+	m := &mailer.Mailer{Mail: mailer.Mail{To: []string{"a@gmail.com"}, BCC: []string{"b@qq.com", "c@qq.com"}}}
+	_, err := r.SendSingle(context.Background(), m)
+	assert.NoError(t, err)
+	if assert.Len(t, smtp.mailers, 2) {
+		assert.Equal(t, []string{"b@qq.com"}, smtp.mailers[0].Mail.To)
+		assert.Equal(t, []string{"c@qq.com"}, smtp.mailers[1].Mail.To)
+		assert.Empty(t, smtp.mailers[0].Mail.BCC)
+	}
+}
+
+func TestRoutingSenderPartialFailure(t *testing.T) {
+	smtp := &recordingSender{name: "smtp", err: mailer.Temporary(errors.New("421"))}
+	aliyun := &recordingSender{name: "aliyun"}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "qq.com")
+
+	m := &mailer.Mailer{Mail: mailer.Mail{To: []string{"a@gmail.com", "b@qq.com"}}}
+	result, err := r.SendSingle(context.Background(), m)
+	assert.NoError(t, err, "已发送的收件人不应因重试而重复收到邮件")
+	if assert.NotNil(t, result) {
+		assert.Equal(t, []string{"a@gmail.com"}, result.Accepted)
+		if assert.Len(t, result.Failed, 1) {
+			assert.Equal(t, "b@qq.com", result.Failed[0].To)
+			assert.Error(t, result.Failed[0].Err)
+		}
+	}
+
+	aliyun.err = errors.New("550")
+	_, err = r.SendSingle(context.Background(), m)
+	assert.Error(t, err, "全部失败时返回错误")
+	assert.False(t, mailer.IsTemporary(err))
+
+	aliyun.err = mailer.Temporary(errors.New("throttled"))
+	_, err = r.SendSingle(context.Background(), m)
+	assert.True(t, mailer.IsTemporary(err))
+}
+
+func TestRecordSendPerRecipient(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { storage.SetPath("") })
+
+	smtp := &recordingSender{name: "smtp", err: errors.New("550")}
+	r := NewRoutingSender("aliyun", &recordingSender{name: "aliyun"})
+	r.Add("smtp", smtp, "qq.com")
+	m := &mailer.Mailer{Mail: mailer.Mail{To: []string{"a@gmail.com", "b@qq.com"}}}
+	result, err := r.SendSingle(context.Background(), m)
+	require.NoError(t, err)
+	recordSend(context.Background(), m, result, err)
+
+	records, err := sendlog.Search(sendlog.Query{Recipient: "a@gmail.com"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, sendlog.OutcomeSent, records[0].Outcome)
+	records, err = sendlog.Search(sendlog.Query{Recipient: "b@qq.com"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, sendlog.OutcomeFailed, records[0].Outcome)
+	assert.Contains(t, records[0].Error, "550")
+}
+
+func TestRoutingSenderCapabilities(t *testing.T) {
+	r := NewRoutingSender("outbox", capableSender{mailer.Capabilities{Attachments: true, InlineAttachments: true, CustomHeaders: true}})
+	r.Add("aliyun", capableSender{mailer.Capabilities{CustomHeaders: true}}, "qq.com")
+	assert.Equal(t, mailer.Capabilities{CustomHeaders: true}, r.Capabilities())
+}
+
+func TestRoutingSenderBatch(t *testing.T) {
+	aliyun := &fakeBatchSender{size: 100}
+	smtp := &fakeSender{err: mailer.Permanent(errors.New("550"))}
+	r := NewRoutingSender("aliyun", aliyun)
+	r.Add("smtp", smtp, "b.example.com")
+
+	assert.Equal(t, 100, r.MaxBatchSize())
+	b := &mailer.Batch{Template: &mailer.Template{ID: "poll_daily_report"}}
+	for _, to := range []string{"x@a.example.com", "y@b.example.com", "z@a.example.com"} {
+		b.Recipients = append(b.Recipients, &mailer.Recipient{To: to})
+	}
+	results, err := r.SendBatch(context.Background(), b)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, [][]string{{"x@a.example.com", "z@a.example.com"}}, aliyun.batches, "同一驱动的收件人应合并为一批")
+	assert.Equal(t, 1, smtp.calls, "不支持批量发送的驱动应逐个发送")
+	assert.Equal(t, "x@a.example.com", results[0].To)
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "y@b.example.com", results[1].To)
+	assert.Error(t, results[1].Err)
+	assert.NoError(t, results[2].Err)
+}
@@ -0,0 +1,109 @@
+package mail
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/rabbitmq"
+	"go.uber.org/zap"
+	"time"
+)
+
+// driverName 当前使用的驱动，发送失败时写入发送日志；启用故障转移时为驱动链
+var driverName string
+
+// newRecord 以邮件与上下文中的信息创建一条发送日志
+func newRecord(ctx context.Context, m *mailer.Mailer, recipient string, outcome sendlog.Outcome) *sendlog.Record {
+	r := &sendlog.Record{
+		Time:        time.Now(),
+		Outcome:     outcome,
+		Recipient:   recipient,
+		Subject:     m.Mail.Subject,
+		Template:    m.Meta.Template,
+		Ref:         m.Meta.Ref,
+		Driver:      driverName,
+		TraceID:     rabbitmq.TraceID(ctx),
+		ConsumerTag: rabbitmq.ConsumerTag(ctx),
+	}
+	if r.Template == "" && m.Template != nil {
+		r.Template = m.Template.ID
+	}
+	return r
+}
+
+// recordSend 为每个收件人、抄送与密送地址记录一次发送结果，写入失败只记录错误。
+// 拆分发送时 result.Failed 中的收件人按各自的错误记录为失败
+func recordSend(ctx context.Context, m *mailer.Mailer, result *mailer.Result, err error) {
+	failed := make(map[string]error)
+	if result != nil {
+		for _, v := range result.Failed {
+			failed[v.To] = v.Err
+		}
+	}
+	var records []*sendlog.Record
+	for _, address := range m.Mail.Recipients() {
+		e := err
+		if f, ok := failed[address]; ok {
+			e = f
+		}
+		outcome := sendlog.OutcomeSent
+		if e != nil {
+			outcome = sendlog.OutcomeFailed
+		}
+		r := newRecord(ctx, m, address, outcome)
+		if result != nil {
+			r.Driver, r.MessageID = result.Provider, result.MessageID
+		}
+		if e != nil {
+			r.Error = e.Error()
+		}
+		records = append(records, r)
+	}
+	writeRecords(ctx, records...)
+}
+
+// recordBatch 为批量邮件的每个收件人记录发送结果。results 为空时整批视为失败
+func recordBatch(ctx context.Context, b *mailer.Batch, results []*mailer.RecipientResult, err error) {
+	if results == nil {
+		results = failAll(b, err)
+	}
+	records := make([]*sendlog.Record, 0, len(results))
+	for _, v := range results {
+		outcome := sendlog.OutcomeSent
+		switch {
+		case v.Skipped != "":
+			outcome = sendlog.OutcomeSkipped
+		case v.Err != nil:
+			outcome = sendlog.OutcomeFailed
+		}
+		r := newRecord(ctx, b.Mailer(&mailer.Recipient{To: v.To}), v.To, outcome)
+		if v.Skipped != "" {
+			r.Error = v.Skipped
+		} else if v.Err != nil {
+			r.Error = v.Err.Error()
+		}
+		records = append(records, r)
+	}
+	writeRecords(ctx, records...)
+}
+
+// recordSkipped 记录被跳过的收件人
+func recordSkipped(ctx context.Context, m *mailer.Mailer, address, reason string) {
+	r := newRecord(ctx, m, address, sendlog.OutcomeSkipped)
+	r.Error = reason
+	writeRecords(ctx, r)
+}
+
+// writeRecords 写入发送日志，演练模式下不写入
+func writeRecords(ctx context.Context, records ...*sendlog.Record) {
+	if config.DryRun().Enabled() {
+		return
+	}
+	if err := sendlog.Add(records...); err != nil {
+		logger := logging.WithContext(ctx)
+		logger.Error("[mail.sendlog] 无法写入发送日志", zap.Error(err))
+		logger.Sync()
+	}
+}
@@ -0,0 +1,76 @@
+package sendlog
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/cli"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	cli.Register(&cli.Command{
+		Name:  "sendlog",
+		Usage: "查询发送日志：search [-to] [-uuid] [-trace] [-since] [-until] [-limit] | prune",
+		Run:   run,
+	})
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少操作，可用操作：search、prune")
+	}
+	switch args[0] {
+	case "search":
+		fs := flag.NewFlagSet("sendlog search", flag.ContinueOnError)
+		to := fs.String("to", "", "收件人地址")
+		uuid := fs.String("uuid", "", "句子 UUID 等业务 ID")
+		trace := fs.String("trace", "", "trace_id")
+		since := fs.String("since", "", "起始时间，例如 2023-09-01、2023-09-01 12:00:00 或 24h（最近 24 小时）")
+		until := fs.String("until", "", "结束时间，格式同 -since")
+		limit := fs.Int("limit", 50, "最多显示的记录数，0 表示不限制")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		q := Query{Recipient: *to, Ref: *uuid, TraceID: *trace, Limit: *limit}
+		var err error
+		if q.Since, err = cli.ParseTime(*since); err != nil {
+			return err
+		}
+		if q.Until, err = cli.ParseTime(*until); err != nil {
+			return err
+		}
+		records, err := Search(q)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tOUTCOME\tRECIPIENT\tSUBJECT\tTEMPLATE\tREF\tDRIVER\tMESSAGE_ID\tTRACE_ID\tERROR")
+		for _, r := range records {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				r.Time.Local().Format(time.DateTime), r.Outcome, r.Recipient, r.Subject, r.Template,
+				r.Ref, r.Driver, r.MessageID, r.TraceID, r.Error)
+		}
+		return w.Flush()
+	case "prune":
+		fs := flag.NewFlagSet("sendlog prune", flag.ContinueOnError)
+		retention := fs.Duration("retention", config.SendLog().Retention(), "保留时间，早于该时间的记录会被删除")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *retention <= 0 {
+			return errors.New("保留时间必须大于 0")
+		}
+		n, err := Prune(time.Now().Add(-*retention))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已清理 %d 条发送日志\n", n)
+	default:
+		return errors.Newf("未知的操作：%s", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// Package sendlog 在内嵌数据库中记录每一次发送尝试与服务商回调的投递状态，供排查用户反馈使用。
+// 记录按时间排序保存，并按收件人与业务 ID（例如句子 UUID）建立索引；超过保留时间的记录会被定期清理。
+package sendlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	bucket      = []byte("sendlog")
+	byRecipient = []byte("sendlog_recipient")
+	byRef       = []byte("sendlog_ref")
+)
+
+type Outcome string
+
+const (
+	OutcomeSent    Outcome = "sent"    // 服务商已接受
+	OutcomeFailed  Outcome = "failed"  // 发送失败
+	OutcomeSkipped Outcome = "skipped" // 未发送，例如收件人在抑制列表中
+)
+
+// Record 一条发送日志。发送尝试的 Outcome 为 sent、failed 或 skipped；
+// 服务商回调的 Outcome 为事件类型，例如 delivered、bounced。
+type Record struct {
+	Time        time.Time `json:"time"`
+	Outcome     Outcome   `json:"outcome"`
+	Recipient   string    `json:"recipient"`
+	Subject     string    `json:"subject,omitempty"`
+	Template    string    `json:"template,omitempty"`
+	Ref         string    `json:"ref,omitempty"` // 关联的业务 ID，例如句子 UUID
+	Driver      string    `json:"driver,omitempty"`
+	MessageID   string    `json:"message_id,omitempty"` // 服务商返回的邮件 ID
+	TraceID     string    `json:"trace_id,omitempty"`
+	ConsumerTag string    `json:"consumer_tag,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// key 主键为 8 字节纳秒时间戳与 8 字节序号，保证按时间排序且不重复
+func key(t time.Time, seq uint64) []byte {
+	k := make([]byte, 16)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	binary.BigEndian.PutUint64(k[8:], seq)
+	return k
+}
+
+// indexKey 索引键为「值 + 0x00 + 主键」，同一值下的记录按时间排序
+func indexKey(value string, pk []byte) []byte {
+	return append(append([]byte(value), 0), pk...)
+}
+
+// normalize 返回收件人索引使用的地址：解析 "Name <addr>" 形式的收件人并取小写地址，无法解析时原样取小写
+func normalize(address string) string {
+	if a, err := mail.ParseAddress(address); err == nil {
+		return strings.ToLower(a.Address)
+	}
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// Add 写入发送日志
+func Add(records ...*Record) error {
+	if !config.SendLog().Enabled() || len(records) == 0 {
+		return nil
+	}
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		recipients, err := tx.CreateBucketIfNotExists(byRecipient)
+		if err != nil {
+			return err
+		}
+		refs, err := tx.CreateBucketIfNotExists(byRef)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if r.Time.IsZero() {
+				r.Time = time.Now()
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			v, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			pk := key(r.Time, seq)
+			if err = b.Put(pk, v); err != nil {
+				return err
+			}
+			if err = recipients.Put(indexKey(normalize(r.Recipient), pk), nil); err != nil {
+				return err
+			}
+			if r.Ref != "" {
+				if err = refs.Put(indexKey(r.Ref, pk), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "无法写入发送日志")
+	}
+	autoPrune()
+	return nil
+}
+
+// Query 查询条件，各条件同时生效，零值表示不限制
+type Query struct {
+	Recipient string
+	Ref       string
+	TraceID   string
+	Since     time.Time
+	Until     time.Time
+	Limit     int // 最多返回的记录数，0 表示不限制
+}
+
+func (q *Query) match(r *Record) bool {
+	return (q.Recipient == "" || normalize(r.Recipient) == normalize(q.Recipient)) &&
+		(q.Ref == "" || r.Ref == q.Ref) &&
+		(q.TraceID == "" || r.TraceID == q.TraceID) &&
+		(q.Since.IsZero() || !r.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || r.Time.Before(q.Until))
+}
+
+// Search 按时间倒序返回符合条件的记录
+func Search(q Query) ([]*Record, error) {
+	var records []*Record
+	err := storage.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		// visit 处理一条记录，返回 false 时停止遍历
+		visit := func(v []byte) (bool, error) {
+			if v == nil {
+				return true, nil
+			}
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return false, errors.Wrap(err, "无法解析发送日志")
+			}
+			if q.match(&r) {
+				records = append(records, &r)
+			}
+			return q.Limit <= 0 || len(records) < q.Limit, nil
+		}
+		var index *bolt.Bucket
+		var prefix []byte
+		switch {
+		case q.Recipient != "":
+			index, prefix = tx.Bucket(byRecipient), indexKey(normalize(q.Recipient), nil)
+		case q.Ref != "":
+			index, prefix = tx.Bucket(byRef), indexKey(q.Ref, nil)
+		}
+		if index != nil {
+			return reversePrefix(index.Cursor(), prefix, func(k []byte) (bool, error) {
+				return visit(b.Get(k[len(prefix):]))
+			})
+		}
+		if q.Recipient != "" || q.Ref != "" {
+			return nil // 索引不存在，没有任何记录
+		}
+		c := b.Cursor()
+		var k, v []byte
+		if q.Until.IsZero() {
+			k, v = c.Last()
+		} else if k, v = c.Seek(key(q.Until, 0)); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if !q.Since.IsZero() && bytes.Compare(k, key(q.Since, 0)) < 0 {
+				break
+			}
+			if next, err := visit(v); err != nil || !next {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "无法读取发送日志")
+	}
+	return records, nil
+}
+
+// reversePrefix 从后向前遍历以 prefix 开头的键
+func reversePrefix(c *bolt.Cursor, prefix []byte, fn func(k []byte) (bool, error)) error {
+	// 跳到前缀之后的第一个键，再回退一步即为前缀范围内的最后一个键
+	end := append(append([]byte(nil), prefix[:len(prefix)-1]...), 1)
+	k, _ := c.Seek(end)
+	if k == nil {
+		k, _ = c.Last()
+	} else {
+		k, _ = c.Prev()
+	}
+	for ; k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Prev() {
+		if next, err := fn(k); err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prune 删除早于 before 的记录及其索引，返回删除的记录数
+func Prune(before time.Time) (int, error) {
+	var n int
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		recipients, refs := tx.Bucket(byRecipient), tx.Bucket(byRef)
+		var expired [][]byte
+		end := key(before, 0)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err == nil {
+				if recipients != nil {
+					if err = recipients.Delete(indexKey(normalize(r.Recipient), k)); err != nil {
+						return err
+					}
+				}
+				if refs != nil && r.Ref != "" {
+					if err = refs.Delete(indexKey(r.Ref, k)); err != nil {
+						return err
+					}
+				}
+			}
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, errors.Wrap(err, "无法清理发送日志")
+}
+
+// pruneInterval 写入日志时自动清理的最小间隔
+const pruneInterval = time.Hour
+
+var (
+	pruneMu   sync.Mutex
+	lastPrune time.Time
+)
+
+// autoPrune 按保留时间清理过期记录，每个进程每小时至多执行一次
+func autoPrune() {
+	retention := config.SendLog().Retention()
+	if retention <= 0 {
+		return
+	}
+	pruneMu.Lock()
+	defer pruneMu.Unlock()
+	if time.Since(lastPrune) < pruneInterval {
+		return
+	}
+	lastPrune = time.Now()
+	n, err := Prune(time.Now().Add(-retention))
+	if err != nil {
+		zap.L().Error("[sendlog] 无法清理发送日志", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Info("[sendlog] 已清理过期的发送日志", zap.Int("count", n))
+	}
+}
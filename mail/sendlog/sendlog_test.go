@@ -0,0 +1,80 @@
+package sendlog
+
+import (
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setup(t *testing.T) time.Time {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	lastPrune = time.Now() // 避免测试中自动清理
+	t.Cleanup(func() { storage.SetPath("") })
+
+	base := time.Date(2023, 9, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, Add(
+		&Record{Time: base, Outcome: OutcomeSent, Recipient: `"Alice" <A@example.com>`, Ref: "uuid-1", TraceID: "t1"},
+		&Record{Time: base.Add(time.Hour), Outcome: OutcomeFailed, Recipient: "b@example.com", Ref: "uuid-1", Error: "boom"},
+		&Record{Time: base.Add(2 * time.Hour), Outcome: OutcomeSkipped, Recipient: "a@example.com", Ref: "uuid-2"},
+		&Record{Time: base.Add(3 * time.Hour), Outcome: "bounced", Recipient: "a@example.com"},
+	))
+	return base
+}
+
+func outcomes(records []*Record) []Outcome {
+	var o []Outcome
+	for _, r := range records {
+		o = append(o, r.Outcome)
+	}
+	return o
+}
+
+func TestSearch(t *testing.T) {
+	base := setup(t)
+
+	records, err := Search(Query{Recipient: "a@EXAMPLE.com"})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{"bounced", OutcomeSkipped, OutcomeSent}, outcomes(records), "按时间倒序")
+
+	records, err = Search(Query{Ref: "uuid-1"})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{OutcomeFailed, OutcomeSent}, outcomes(records))
+
+	records, err = Search(Query{Since: base.Add(time.Hour), Until: base.Add(3 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{OutcomeSkipped, OutcomeFailed}, outcomes(records))
+
+	records, err = Search(Query{Recipient: "a@example.com", Since: base.Add(time.Minute), Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{"bounced"}, outcomes(records))
+
+	records, err = Search(Query{TraceID: "t1"})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{OutcomeSent}, outcomes(records))
+
+	records, err = Search(Query{Recipient: "nobody@example.com"})
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestPrune(t *testing.T) {
+	base := setup(t)
+
+	n, err := Prune(base.Add(90 * time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	records, err := Search(Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []Outcome{"bounced", OutcomeSkipped}, outcomes(records))
+
+	require.NoError(t, storage.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, 2, tx.Bucket(byRecipient).Stats().KeyN, "索引应随记录一起删除")
+		assert.Equal(t, 1, tx.Bucket(byRef).Stats().KeyN)
+		return nil
+	}))
+}
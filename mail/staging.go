@@ -0,0 +1,134 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"go.uber.org/zap"
+	netmail "net/mail"
+	"strings"
+)
+
+const (
+	stagingRewrite   = "rewrite"
+	stagingAllowlist = "allowlist"
+)
+
+// HeaderStagingOriginalTo rewrite 模式下记录原始收件人的邮件头，只有支持自定义邮件头的驱动会写入。
+// 不使用 X-Original-To，因为收件服务器可能添加或覆盖该邮件头
+const HeaderStagingOriginalTo = "X-Staging-Original-To"
+
+func init() {
+	config.RegisterCallback(func() {
+		if config.IsProduction() {
+			return
+		}
+		defer zap.L().Sync()
+		c := config.Staging()
+		switch c.Mode() {
+		case stagingRewrite:
+			if c.CatchAll() == "" {
+				zap.L().Fatal("非生产环境的 rewrite 模式需要设置 staging.catch_all", zap.String("environment", config.Environment()))
+			}
+		case stagingAllowlist:
+			if len(c.Allowlist()) == 0 {
+				zap.L().Warn("非生产环境的白名单为空，所有邮件都会被丢弃", zap.String("environment", config.Environment()))
+			}
+		default:
+			zap.L().Fatal("未知的收件人保护模式，可用模式：rewrite、allowlist", zap.String("mode", c.Mode()))
+		}
+		zap.L().Info("非生产环境，已启用收件人保护。",
+			zap.String("environment", config.Environment()),
+			zap.String("mode", c.Mode()),
+		)
+	})
+}
+
+// stagingMode 返回当前的收件人保护模式，生产环境返回空字符串
+func stagingMode() string {
+	if config.IsProduction() {
+		return ""
+	}
+	return config.Staging().Mode()
+}
+
+// allowed 判断地址是否在白名单中，白名单项可以是完整地址或域名
+func allowed(address string) bool {
+	if a, err := netmail.ParseAddress(address); err == nil {
+		address = a.Address
+	}
+	address = strings.ToLower(strings.TrimSpace(address))
+	domain := domainOf(address)
+	for _, v := range config.Staging().Allowlist() {
+		if strings.Contains(v, "@") {
+			if strings.EqualFold(strings.TrimSpace(v), address) {
+				return true
+			}
+		} else if matchDomain(v, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+const stagingSkipReason = "非生产环境，收件人不在白名单中"
+
+// guardStaging 在非生产环境下改写或过滤收件人，生产环境下不做任何处理。
+// 没有剩余收件人时返回 false，本次发送被跳过且不视为失败。
+func guardStaging(ctx context.Context, m *mailer.Mailer) bool {
+	switch stagingMode() {
+	case stagingRewrite:
+		rewriteRecipients(ctx, m)
+	case stagingAllowlist:
+		return filterAllowlist(ctx, m)
+	}
+	return true
+}
+
+// rewriteRecipients 将所有收件人改写为 catch_all，原始收件人写入邮件头与主题前缀
+func rewriteRecipients(ctx context.Context, m *mailer.Mailer) {
+	original := m.Mail.Recipients()
+	catchAll := config.Staging().CatchAll()
+	m.Mail.To, m.Mail.CC, m.Mail.BCC = []string{catchAll}, nil, nil
+	headers := make(map[string]string, len(m.Mail.Headers)+1)
+	for k, v := range m.Mail.Headers {
+		headers[k] = v
+	}
+	headers[HeaderStagingOriginalTo] = strings.Join(original, ", ")
+	m.Mail.Headers = headers
+	if config.Staging().SubjectPrefix() {
+		m.Mail.Subject = fmt.Sprintf("[%s → %s] %s", config.Environment(), strings.Join(original, ", "), m.Mail.Subject)
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	logger.Info("[mail.staging] 非生产环境，收件人已改写",
+		zap.Strings("original", original),
+		zap.String("catch_all", catchAll),
+	)
+}
+
+// filterAllowlist 移除白名单以外的收件人、抄送与密送地址，并记录跳过原因
+func filterAllowlist(ctx context.Context, m *mailer.Mailer) bool {
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	filter := func(list []string) []string {
+		kept := list[:0:0]
+		for _, v := range list {
+			if allowed(v) {
+				kept = append(kept, v)
+				continue
+			}
+			logger.Info("[mail.staging] 非生产环境，丢弃白名单以外的收件人", zap.String("address", v))
+			recordSkipped(ctx, m, v, stagingSkipReason)
+		}
+		return kept
+	}
+	m.Mail.To, m.Mail.CC, m.Mail.BCC = filter(m.Mail.To), filter(m.Mail.CC), filter(m.Mail.BCC)
+	if len(m.Mail.To) == 0 {
+		logger.Info("[mail.staging] 所有收件人均不在白名单中，跳过发送", zap.String("subject", m.Mail.Subject))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"context"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func setStaging(t *testing.T, values map[string]any) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	viper.Set("environment", "staging")
+	for k, v := range values {
+		viper.Set("staging."+k, v)
+	}
+	t.Cleanup(func() {
+		storage.SetPath("")
+		viper.Set("environment", "production")
+		for k := range values {
+			viper.Set("staging."+k, nil)
+		}
+	})
+}
+
+func TestGuardStagingInactiveInProduction(t *testing.T) {
+	m := &mailer.Mailer{Mail: mailer.Mail{To: []string{"user@example.com"}, Subject: "s"}}
+	assert.True(t, guardStaging(context.Background(), m))
+	assert.Equal(t, []string{"user@example.com"}, m.Mail.To)
+	assert.Equal(t, "s", m.Mail.Subject)
+}
+
+func TestGuardStagingRewrite(t *testing.T) {
+	setStaging(t, map[string]any{"mode": "rewrite", "catch_all": "qa@hitokoto.cn"})
+
+	m := &mailer.Mailer{Mail: mailer.Mail{
+		To:      []string{"user@example.com"},
+		CC:      []string{"cc@example.com"},
+		BCC:     []string{"bcc@example.com"},
+		Subject: "喵！",
+		Headers: map[string]string{"X-Foo": "bar"},
+	}}
+	assert.True(t, guardStaging(context.Background(), m))
+	assert.Equal(t, []string{"qa@hitokoto.cn"}, m.Mail.To)
+	assert.Empty(t, m.Mail.CC)
+	assert.Empty(t, m.Mail.BCC)
+	assert.Equal(t, "user@example.com, cc@example.com, bcc@example.com", m.Mail.Headers[HeaderStagingOriginalTo])
+	assert.Equal(t, "bar", m.Mail.Headers["X-Foo"])
+	assert.Equal(t, "[staging → user@example.com, cc@example.com, bcc@example.com] 喵！", m.Mail.Subject)
+}
+
+func TestGuardStagingAllowlist(t *testing.T) {
+	setStaging(t, map[string]any{"mode": "allowlist", "allowlist": []string{"dev@example.com", "*.hitokoto.cn"}})
+
+	m := &mailer.Mailer{Mail: mailer.Mail{
+		To:  []string{"Dev <dev@example.com>", "user@example.com"},
+		BCC: []string{"qa@mail.hitokoto.cn", "qa@hitokoto.cn"},
+	}}
+	assert.True(t, guardStaging(context.Background(), m))
+	assert.Equal(t, []string{"Dev <dev@example.com>"}, m.Mail.To)
+	assert.Equal(t, []string{"qa@mail.hitokoto.cn"}, m.Mail.BCC)
+
+	m = &mailer.Mailer{Mail: mailer.Mail{To: []string{"user@example.com"}}}
+	assert.False(t, guardStaging(context.Background(), m), "所有收件人均不在白名单中时应跳过发送")
+}
+
+func TestSendBatchStaging(t *testing.T) {
+	setStaging(t, map[string]any{"mode": "allowlist", "allowlist": []string{"a@example.com"}, "catch_all": "qa@hitokoto.cn"})
+	s := &fakeBatchSender{size: 10}
+	instance = s
+	t.Cleanup(func() { instance = nil })
+
+	results, err := SendBatch(context.Background(), testBatch(2))
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Empty(t, results[0].Skipped)
+	assert.NotEmpty(t, results[1].Skipped)
+	assert.Equal(t, [][]string{{"a@example.com"}}, s.batches)
+
+	viper.Set("staging.mode", "rewrite")
+	r := &recordingSender{name: "fake"}
+	instance = r
+	results, err = SendBatch(context.Background(), testBatch(2))
+	require.NoError(t, err)
+	assert.Equal(t, "b@example.com", results[1].To)
+	require.Len(t, r.mailers, 2)
+	assert.Equal(t, []string{"qa@hitokoto.cn"}, r.mailers[1].Mail.To)
+	assert.Equal(t, "b@example.com", r.mailers[1].Mail.Headers[HeaderStagingOriginalTo])
+}
@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/logging"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/hitokoto-osc/notification-worker/mail/suppression"
+	"go.uber.org/zap"
+)
+
+// checkSuppressed 查询抑制列表。读取失败时记录错误并放行，避免数据库故障阻断所有邮件
+func checkSuppressed(ctx context.Context, addresses []string) map[string]*suppression.Entry {
+	if !config.Suppression().Enabled() || len(addresses) == 0 {
+		return nil
+	}
+	found, err := suppression.Check(addresses...)
+	if err != nil {
+		logging.WithContext(ctx).Error("[mail.suppression] 无法查询抑制列表，继续发送", zap.Error(err))
+		return nil
+	}
+	return found
+}
+
+func skipReason(e *suppression.Entry) string {
+	if e.Reason == "" {
+		return fmt.Sprintf("收件人在抑制列表中（%s）", e.Kind)
+	}
+	return fmt.Sprintf("收件人在抑制列表中（%s：%s）", e.Kind, e.Reason)
+}
+
+// filterSuppressed 从收件人、抄送与密送中移除被抑制的地址，并记录跳过原因。
+// 没有剩余收件人时返回 false，本次发送被跳过且不视为失败。
+func filterSuppressed(ctx context.Context, m *mailer.Mailer) bool {
+	addresses := make([]string, 0, len(m.Mail.To)+len(m.Mail.CC)+len(m.Mail.BCC))
+	addresses = append(append(append(addresses, m.Mail.To...), m.Mail.CC...), m.Mail.BCC...)
+	suppressed := checkSuppressed(ctx, addresses)
+	if len(suppressed) == 0 {
+		return true
+	}
+	logger := logging.WithContext(ctx)
+	defer logger.Sync()
+	for address, e := range suppressed {
+		logger.Info("[mail.suppression] 跳过被抑制的收件人",
+			zap.String("address", address),
+			zap.String("kind", string(e.Kind)),
+			zap.String("reason", skipReason(e)),
+		)
+		recordSkipped(ctx, m, address, skipReason(e))
+	}
+	filter := func(list []string) []string {
+		kept := list[:0:0]
+		for _, v := range list {
+			if suppressed[v] == nil {
+				kept = append(kept, v)
+			}
+		}
+		return kept
+	}
+	m.Mail.To, m.Mail.CC, m.Mail.BCC = filter(m.Mail.To), filter(m.Mail.CC), filter(m.Mail.BCC)
+	if len(m.Mail.To) == 0 {
+		logger.Info("[mail.suppression] 所有收件人均被抑制，跳过发送", zap.String("subject", m.Mail.Subject))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package suppression
+
+import (
+	"flag"
+	"fmt"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/cli"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	cli.Register(&cli.Command{
+		Name:  "suppression",
+		Usage: "管理抑制列表：add <地址> [-kind] [-reason] | remove <地址> | list [-all] | prune",
+		Run:   run,
+	})
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return errors.New("缺少操作，可用操作：add、remove、list、prune")
+	}
+	switch args[0] {
+	case "add":
+		fs := flag.NewFlagSet("suppression add", flag.ContinueOnError)
+		kind := fs.String("kind", string(KindManual), "抑制类型：hard_bounce、soft_bounce、complaint、manual")
+		reason := fs.String("reason", "", "原因")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return errors.New("缺少邮件地址")
+		}
+		k, err := ParseKind(*kind)
+		if err != nil {
+			return err
+		}
+		for _, address := range fs.Args() {
+			e, err := Add(address, k, *reason, "cli")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("已抑制 %s（%s，%s）\n", e.Address, e.Kind, expiry(e))
+		}
+	case "remove":
+		if len(args) < 2 {
+			return errors.New("缺少邮件地址")
+		}
+		for _, address := range args[1:] {
+			removed, err := Remove(address)
+			if err != nil {
+				return err
+			}
+			if removed {
+				fmt.Printf("已移除 %s\n", address)
+			} else {
+				fmt.Printf("%s 不在抑制列表中\n", address)
+			}
+		}
+	case "list":
+		fs := flag.NewFlagSet("suppression list", flag.ContinueOnError)
+		all := fs.Bool("all", false, "包含已失效的记录")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		entries, err := List(*all)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ADDRESS\tKIND\tSOURCE\tCREATED\tEXPIRES\tREASON")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.Address, e.Kind, e.Source, e.CreatedAt.Format(time.DateTime), expiry(e), e.Reason)
+		}
+		return w.Flush()
+	case "prune":
+		n, err := Prune()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("已清理 %d 条失效记录\n", n)
+	default:
+		return errors.Newf("未知的操作：%s", args[0])
+	}
+	return nil
+}
+
+func expiry(e *Entry) string {
+	if e.ExpiresAt.IsZero() {
+		return "永久"
+	}
+	return e.ExpiresAt.Format(time.DateTime)
+}
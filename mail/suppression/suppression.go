@@ -0,0 +1,208 @@
+// Package suppression 维护不再投递的收件人列表（抑制列表）。
+// 硬退信、投诉的地址默认永久抑制，软退信在有效期后自动解除，有效期可按类型配置。
+package suppression
+
+import (
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	bolt "go.etcd.io/bbolt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+var bucket = []byte("suppression")
+
+type Kind string
+
+const (
+	KindHardBounce Kind = "hard_bounce" // 地址不存在等永久性退信
+	KindSoftBounce Kind = "soft_bounce" // 邮箱已满等暂时性退信
+	KindComplaint  Kind = "complaint"   // 收件人投诉为垃圾邮件
+	KindManual     Kind = "manual"      // 管理员手动添加
+)
+
+// ParseKind 解析抑制类型
+func ParseKind(s string) (Kind, error) {
+	switch k := Kind(strings.ToLower(strings.TrimSpace(s))); k {
+	case KindHardBounce, KindSoftBounce, KindComplaint, KindManual:
+		return k, nil
+	default:
+		return "", errors.Newf("未知的抑制类型：%s", s)
+	}
+}
+
+// Entry 一条抑制记录
+type Entry struct {
+	Address   string    `json:"address"`
+	Kind      Kind      `json:"kind"`
+	Reason    string    `json:"reason,omitempty"`
+	Source    string    `json:"source,omitempty"` // 记录来源，例如 cli、aliyun 回调
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"` // 零值表示永久有效
+}
+
+// Expired 判断记录在 now 时是否已失效
+func (e *Entry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// outlives 判断 e 是否比 other 更晚失效
+func (e *Entry) outlives(other *Entry) bool {
+	if other.ExpiresAt.IsZero() {
+		return false
+	}
+	return e.ExpiresAt.IsZero() || e.ExpiresAt.After(other.ExpiresAt)
+}
+
+// Normalize 将 "名称 <地址>" 或地址规范化为小写的纯地址，作为抑制列表的键
+func Normalize(address string) (string, error) {
+	a, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", errors.Wrapf(err, "无效的邮件地址：%s", address)
+	}
+	return strings.ToLower(a.Address), nil
+}
+
+// Add 添加或更新抑制记录，有效期取自配置 suppression.ttl.<kind>。
+// 已存在永久记录时，不会被较短的软退信记录覆盖。
+func Add(address string, kind Kind, reason, source string) (*Entry, error) {
+	key, err := Normalize(address)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	e := &Entry{Address: key, Kind: kind, Reason: reason, Source: source, CreatedAt: now}
+	if ttl := config.Suppression().TTL(string(kind)); ttl > 0 {
+		e.ExpiresAt = now.Add(ttl)
+	}
+	err = storage.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket)
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			var existing Entry
+			if err = json.Unmarshal(v, &existing); err == nil && !existing.Expired(now) && existing.outlives(e) {
+				e = &existing
+				return nil
+			}
+		}
+		v, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), v)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "无法写入抑制列表")
+	}
+	return e, nil
+}
+
+// Remove 删除抑制记录，记录不存在时返回 false
+func Remove(address string) (bool, error) {
+	key, err := Normalize(address)
+	if err != nil {
+		return false, err
+	}
+	var removed bool
+	err = storage.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil || b.Get([]byte(key)) == nil {
+			return nil
+		}
+		removed = true
+		return b.Delete([]byte(key))
+	})
+	return removed, errors.Wrap(err, "无法删除抑制记录")
+}
+
+// Check 返回 addresses 中仍然有效的抑制记录，键为传入的原始地址
+func Check(addresses ...string) (map[string]*Entry, error) {
+	found := make(map[string]*Entry)
+	now := time.Now()
+	err := storage.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		for _, address := range addresses {
+			key, err := Normalize(address)
+			if err != nil {
+				continue // 无效地址交由驱动报错
+			}
+			v := b.Get([]byte(key))
+			if v == nil {
+				continue
+			}
+			var e Entry
+			if err = json.Unmarshal(v, &e); err != nil {
+				return errors.Wrapf(err, "无法解析抑制记录：%s", key)
+			}
+			if !e.Expired(now) {
+				found[address] = &e
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "无法读取抑制列表")
+	}
+	return found, nil
+}
+
+// List 返回所有记录，includeExpired 为 false 时跳过已失效的记录
+func List(includeExpired bool) ([]*Entry, error) {
+	var entries []*Entry
+	now := time.Now()
+	err := storage.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return errors.Wrapf(err, "无法解析抑制记录：%s", k)
+			}
+			if includeExpired || !e.Expired(now) {
+				entries = append(entries, &e)
+			}
+			return nil
+		})
+	})
+	return entries, errors.Wrap(err, "无法读取抑制列表")
+}
+
+// Prune 删除已失效的记录，返回删除的数量
+func Prune() (int, error) {
+	var n int
+	now := time.Now()
+	err := storage.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		if b == nil {
+			return nil
+		}
+		var expired [][]byte
+		if err := b.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err == nil && e.Expired(now) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(expired)
+		return nil
+	})
+	return n, errors.Wrap(err, "无法清理抑制列表")
+}
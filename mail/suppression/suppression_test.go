@@ -0,0 +1,70 @@
+package suppression
+
+import (
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func useTempStorage(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { storage.SetPath("") })
+}
+
+func TestAddCheckRemove(t *testing.T) {
+	useTempStorage(t)
+
+	found, err := Check("a@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, found, "数据库不存在时应视为空列表")
+
+	e, err := Add("Foo <A@Example.com>", KindHardBounce, "550 user unknown", "test")
+	require.NoError(t, err)
+	assert.Equal(t, "a@example.com", e.Address)
+	assert.True(t, e.ExpiresAt.IsZero(), "硬退信默认永久抑制")
+
+	found, err = Check("a@example.com", "b@example.com", "invalid")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, KindHardBounce, found["a@example.com"].Kind)
+
+	removed, err := Remove("a@example.com")
+	require.NoError(t, err)
+	assert.True(t, removed)
+	found, err = Check("a@example.com")
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestSoftBounceDoesNotOverrideHardBounce(t *testing.T) {
+	useTempStorage(t)
+
+	_, err := Add("a@example.com", KindHardBounce, "", "test")
+	require.NoError(t, err)
+	e, err := Add("a@example.com", KindSoftBounce, "mailbox full", "test")
+	require.NoError(t, err)
+	assert.Equal(t, KindHardBounce, e.Kind)
+
+	e, err = Add("b@example.com", KindSoftBounce, "mailbox full", "test")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(72*time.Hour), e.ExpiresAt, time.Minute)
+}
+
+func TestPrune(t *testing.T) {
+	useTempStorage(t)
+
+	_, err := Add("a@example.com", KindManual, "", "test")
+	require.NoError(t, err)
+	entries, err := List(false)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	expired := &Entry{ExpiresAt: time.Now().Add(-time.Second)}
+	assert.True(t, expired.Expired(time.Now()))
+	n, err := Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 0, n, "永久记录不应被清理")
+}
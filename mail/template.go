@@ -0,0 +1,59 @@
+package mail
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/django"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"strings"
+)
+
+// localTemplatePrefix 本地邮件模板所在的目录，Template.ID 可以省略该前缀
+const localTemplatePrefix = "email/"
+
+// renderTemplate 驱动不支持模板邮件时，在本地 django 模板集中查找 Template.ID，
+// 以 Template.Data 与全局变量渲染后将邮件转换为普通邮件；驱动支持模板邮件时不做任何处理。
+// 邮件未指定主题时使用模板的 .subject.django 主题模板，模板也没有主题时返回永久性错误。
+func renderTemplate(sender mailer.Sender, m *mailer.Mailer) error {
+	if m.Type != mailer.TypeTemplate || mailer.CapabilitiesOf(sender).Templates {
+		return nil
+	}
+	if m.Template == nil || m.Template.ID == "" {
+		return errors.New("模板邮件缺少模板 ID")
+	}
+	name, err := localTemplate(m.Template.ID)
+	if err != nil {
+		return err
+	}
+	html, text, err := django.RenderMail(name, django.Context(m.Template.Data))
+	if err != nil {
+		return errors.Wrapf(err, "无法在本地渲染模板：%s", name)
+	}
+	if m.Mail.Subject == "" {
+		subject, err := django.RenderSubject(name, django.Context(m.Template.Data))
+		if err != nil {
+			return errors.Wrapf(err, "无法在本地渲染模板主题：%s", name)
+		}
+		if subject == "" {
+			return mailer.Permanent(errors.Newf("模板邮件缺少主题，且本地模板没有主题：%s", name))
+		}
+		m.Mail.Subject = subject
+	}
+	m.Type = mailer.TypeNormal
+	m.Mail.Body, m.Mail.Text = html, text
+	if m.Meta.Template == "" {
+		m.Meta.Template = name
+	}
+	return nil
+}
+
+// localTemplate 返回 Template.ID 对应的本地模板名称，本地不存在该模板时返回永久性错误
+func localTemplate(id string) (string, error) {
+	name := id
+	if !django.Exists(name) && !strings.HasPrefix(name, localTemplatePrefix) {
+		name = localTemplatePrefix + name
+	}
+	if !django.Exists(name) {
+		return "", mailer.Permanent(errors.Newf("驱动不支持模板邮件，且本地不存在模板：%s", id))
+	}
+	return name, nil
+}
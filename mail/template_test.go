@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func templateMailer(id string) *mailer.Mailer {
+	return &mailer.Mailer{
+		Type:     mailer.TypeTemplate,
+		Mail:     mailer.Mail{To: []string{"user@example.com"}, Subject: "s"},
+		Template: &mailer.Template{ID: id, Data: map[string]interface{}{"username": "a632079", "hitokoto": "人生若只如初见"}},
+	}
+}
+
+func TestRenderTemplateLocally(t *testing.T) {
+	m := templateMailer("hitokoto_reviewed")
+	require.NoError(t, renderTemplate(&fakeSender{}, m))
+	assert.Equal(t, mailer.TypeNormal, m.Type)
+	assert.Contains(t, m.Mail.Body, "人生若只如初见")
+	assert.Contains(t, m.Mail.Text, "人生若只如初见")
+	assert.Equal(t, "email/hitokoto_reviewed", m.Meta.Template)
+
+	m = templateMailer("email/hitokoto_appended")
+	require.NoError(t, renderTemplate(&fakeSender{}, m))
+	assert.Contains(t, m.Mail.Body, "人生若只如初见")
+
+	assert.Error(t, renderTemplate(&fakeSender{}, templateMailer("not_exists")))
+}
+
+func TestRenderTemplateSubject(t *testing.T) {
+	m := templateMailer("hitokoto_reviewed")
+	m.Mail.Subject = ""
+	require.NoError(t, renderTemplate(&fakeSender{}, m))
+	assert.Equal(t, "喵！您的句子审核结果出来了！", m.Mail.Subject, "未指定主题时应使用模板的主题")
+
+	m = templateMailer("email/partials/footer")
+	m.Mail.Subject = ""
+	err := renderTemplate(&fakeSender{}, m)
+	assert.True(t, mailer.IsPermanent(err), "模板没有主题时应返回永久性错误")
+	assert.Equal(t, mailer.TypeTemplate, m.Type)
+}
+
+func TestRenderTemplateNative(t *testing.T) {
+	m := templateMailer("provider_template")
+	require.NoError(t, renderTemplate(capableSender{mailer.Capabilities{Templates: true}}, m))
+	assert.Equal(t, mailer.TypeTemplate, m.Type, "支持模板邮件的驱动应使用服务商模板")
+	assert.Empty(t, m.Mail.Body)
+}
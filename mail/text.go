@@ -0,0 +1,14 @@
+package mail
+
+import (
+	"github.com/hitokoto-osc/notification-worker/mail/internal/plaintext"
+	"github.com/hitokoto-osc/notification-worker/mail/mailer"
+)
+
+// fillText 为没有纯文本正文的 HTML 邮件生成 text/plain 备选正文，降低被反垃圾策略判为纯 HTML 邮件的概率
+func fillText(m *mailer.Mailer) {
+	if m.Type != mailer.TypeNormal || m.Mail.Text != "" || m.Mail.Body == "" {
+		return
+	}
+	m.Mail.Text = plaintext.FromHTML(m.Mail.Body)
+}
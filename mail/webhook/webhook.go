@@ -0,0 +1,205 @@
+// Package webhook 接收邮件服务商推送的投递状态回调。
+//
+// 各驱动通过 Register 注册自己的 Provider，负责校验签名并将推送内容转换为统一的 Event；
+// 回调地址为 /webhook/<名称>，例如 /webhook/aliyun。事件交给 Subscribe 注册的订阅者处理，
+// 所有事件默认写入发送日志，退信与投诉同时写入抑制列表。
+package webhook
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/mail/suppression"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventDelivered  EventType = "delivered"  // 收件服务器已接收
+	EventBounced    EventType = "bounced"    // 退信
+	EventComplained EventType = "complained" // 收件人投诉为垃圾邮件
+	EventOpened     EventType = "opened"     // 收件人打开了邮件
+)
+
+// Event 统一格式的投递状态事件
+type Event struct {
+	Provider  string
+	Type      EventType
+	Recipient string
+	MessageID string // 服务商的邮件 ID，例如阿里云的 EnvId
+	Hard      bool   // 仅对退信有效，是否为地址不存在等永久性退信
+	Reason    string // 服务商返回的原因，例如 SMTP 应答
+	Time      time.Time
+}
+
+// Provider 解析某个服务商的回调
+type Provider interface {
+	// Verify 校验回调确实来自服务商，body 为完整的请求体
+	Verify(r *http.Request, body []byte) error
+	// Parse 将请求体转换为事件，一次回调可以包含多个事件，不关心的事件直接忽略
+	Parse(body []byte) ([]*Event, error)
+}
+
+// maxBodySize 回调请求体的大小上限
+const maxBodySize = 1 << 20
+
+var (
+	providers   = map[string]Provider{}
+	subscribers []func(e *Event) error
+)
+
+func init() {
+	Subscribe(suppress)
+	Subscribe(record)
+}
+
+// Register 注册服务商的回调解析器，重复注册同名解析器会 panic
+func Register(name string, p Provider) {
+	if _, ok := providers[name]; ok {
+		panic("webhook: 重复注册回调解析器 " + name)
+	}
+	providers[name] = p
+}
+
+// Subscribe 注册事件订阅者。订阅者返回错误时回调以 500 响应，服务商会重新推送，因此订阅者应当是幂等的
+func Subscribe(fn func(e *Event) error) {
+	subscribers = append(subscribers, fn)
+}
+
+// Handler 返回处理 /webhook/<名称> 的 HTTP Handler
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook/", handle)
+	return mux
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	logger := zap.L().With(zap.String("path", r.URL.Path), zap.String("remote", r.RemoteAddr))
+	defer logger.Sync()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/webhook/")
+	p, ok := providers[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "无法读取请求体", http.StatusBadRequest)
+		return
+	}
+	if err = p.Verify(r, body); err != nil {
+		logger.Warn("[webhook] 回调校验失败", zap.Error(err))
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	events, err := p.Parse(body)
+	if err != nil {
+		logger.Warn("[webhook] 无法解析回调", zap.Error(err), zap.ByteString("body", body))
+		http.Error(w, "无法解析回调", http.StatusBadRequest)
+		return
+	}
+	for _, e := range events {
+		e.Provider = name
+		logger.Info("[webhook] 收到投递状态事件",
+			zap.String("type", string(e.Type)),
+			zap.String("recipient", e.Recipient),
+			zap.String("message_id", e.MessageID),
+			zap.Bool("hard", e.Hard),
+			zap.String("reason", e.Reason),
+			zap.Time("time", e.Time),
+		)
+		for _, fn := range subscribers {
+			if err = fn(e); err != nil {
+				logger.Error("[webhook] 无法处理投递状态事件", zap.Error(err), zap.String("recipient", e.Recipient))
+				http.Error(w, "无法处理事件", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// suppress 将退信与投诉的收件人加入抑制列表
+func suppress(e *Event) error {
+	var kind suppression.Kind
+	switch {
+	case e.Type == EventBounced && e.Hard:
+		kind = suppression.KindHardBounce
+	case e.Type == EventBounced:
+		kind = suppression.KindSoftBounce
+	case e.Type == EventComplained:
+		kind = suppression.KindComplaint
+	default:
+		return nil
+	}
+	if _, err := suppression.Normalize(e.Recipient); err != nil {
+		zap.L().Warn("[webhook] 事件的收件人地址无效，忽略", zap.Error(err))
+		return nil
+	}
+	_, err := suppression.Add(e.Recipient, kind, e.Reason, e.Provider)
+	return err
+}
+
+// record 将事件写入发送日志
+func record(e *Event) error {
+	return sendlog.Add(&sendlog.Record{
+		Time:      e.Time,
+		Outcome:   sendlog.Outcome(e.Type),
+		Recipient: e.Recipient,
+		Driver:    e.Provider,
+		MessageID: e.MessageID,
+		Error:     e.Reason,
+	})
+}
+
+var (
+	mu     sync.Mutex
+	server *http.Server
+)
+
+// Serve 按配置在后台启动回调服务，监听失败时返回错误
+func Serve() error {
+	mu.Lock()
+	defer mu.Unlock()
+	l, err := net.Listen("tcp", config.Webhook().Addr())
+	if err != nil {
+		return errors.Wrap(err, "无法监听回调地址")
+	}
+	server = &http.Server{
+		Handler:           Handler(),
+		ReadHeaderTimeout: config.Webhook().ReadTimeout(),
+		ReadTimeout:       config.Webhook().ReadTimeout(),
+	}
+	go func(s *http.Server) {
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zap.L().Error("[webhook] 回调服务异常退出", zap.Error(err))
+		}
+	}(server)
+	zap.L().Info("[webhook] 已启动投递状态回调服务", zap.String("addr", l.Addr().String()))
+	return nil
+}
+
+// Shutdown 关闭回调服务，等待处理中的请求完成
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	err := server.Shutdown(ctx)
+	server = nil
+	return err
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/mail/sendlog"
+	"github.com/hitokoto-osc/notification-worker/mail/suppression"
+	"github.com/hitokoto-osc/notification-worker/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeProvider 请求体每行为「事件类型 收件人」，请求头 X-Token 必须为 secret
+type fakeProvider struct{}
+
+func (fakeProvider) Verify(r *http.Request, _ []byte) error {
+	if r.Header.Get("X-Token") != "secret" {
+		return errors.New("invalid token")
+	}
+	return nil
+}
+
+func (fakeProvider) Parse(body []byte) ([]*Event, error) {
+	var events []*Event
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		typ, recipient, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, errors.Newf("invalid line: %s", line)
+		}
+		events = append(events, &Event{Type: EventType(typ), Recipient: recipient, Hard: true})
+	}
+	return events, nil
+}
+
+func init() {
+	Register("fake", fakeProvider{})
+}
+
+func post(path, token, body string) int {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("X-Token", token)
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestHandle(t *testing.T) {
+	storage.SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { storage.SetPath("") })
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhook/fake", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.StatusNotFound, post("/webhook/unknown", "secret", ""))
+	assert.Equal(t, http.StatusForbidden, post("/webhook/fake", "wrong", "bounced a@example.com"))
+	assert.Equal(t, http.StatusBadRequest, post("/webhook/fake", "secret", "garbage"))
+
+	body := "delivered a@example.com\nbounced b@example.com\ncomplained c@example.com\nbounced invalid"
+	assert.Equal(t, http.StatusNoContent, post("/webhook/fake", "secret", body))
+	found, err := suppression.Check("a@example.com", "b@example.com", "c@example.com")
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, suppression.KindHardBounce, found["b@example.com"].Kind)
+	assert.Equal(t, suppression.KindComplaint, found["c@example.com"].Kind)
+	assert.Equal(t, "fake", found["b@example.com"].Source)
+
+	records, err := sendlog.Search(sendlog.Query{Recipient: "a@example.com"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, sendlog.Outcome(EventDelivered), records[0].Outcome)
+	assert.Equal(t, "fake", records[0].Driver)
+}
+
+func TestHandleSubscriberError(t *testing.T) {
+	saved := subscribers
+	t.Cleanup(func() { subscribers = saved })
+	var received []*Event
+	subscribers = nil
+	Subscribe(func(e *Event) error {
+		received = append(received, e)
+		return errors.New("storage unavailable")
+	})
+	assert.Equal(t, http.StatusInternalServerError, post("/webhook/fake", "secret", "opened a@example.com"))
+	require.Len(t, received, 1)
+	assert.Equal(t, EventOpened, received[0].Type)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/cockroachdb/errors"
 	"github.com/hitokoto-osc/notification-worker/logging"
 	"go.uber.org/zap"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -28,6 +29,8 @@ type Consumer struct {
 	done chan error
 	// Current producer connection settings
 	session Session
+	// Retry policy for failed deliveries, nil means dead-lettering by the queue
+	retry *RetryPolicy
 }
 
 type ConsumerOptions struct {
@@ -126,14 +129,15 @@ func (c *Consumer) HandleError() {
 
 // Register connect internally declares the exchanges and queues
 func (c *Consumer) Register() error {
-	e := c.session.Exchange
-	q := c.session.Queue
-	bo := c.session.BindingOptions
+	return declare(c.channel, c.session.Exchange, c.session.Queue, c.session.BindingOptions)
+}
 
+// declare declares the exchange and queue, then binds them
+func declare(channel *amqp.Channel, e Exchange, q Queue, bo BindingOptions) error {
 	var err error
 
 	// declaring Exchange
-	if err = c.channel.ExchangeDeclare(
+	if err = channel.ExchangeDeclare(
 		e.Name,       // name of the exchange
 		e.Type,       // type
 		e.Durable,    // durable
@@ -146,7 +150,7 @@ func (c *Consumer) Register() error {
 	}
 
 	// declaring Queue
-	_, err = c.channel.QueueDeclare(
+	_, err = channel.QueueDeclare(
 		q.Name,       // name of the queue
 		q.Durable,    // durable
 		q.AutoDelete, // delete when usused
@@ -159,7 +163,7 @@ func (c *Consumer) Register() error {
 	}
 
 	// binding Exchange to Queue
-	if err = c.channel.QueueBind(
+	if err = channel.QueueBind(
 		// bind to real queue
 		q.Name,        // name of the queue
 		bo.RoutingKey, // bindingKey
@@ -205,6 +209,8 @@ func (c *Consumer) Consume(handler func(ctx Ctx, delivery amqp.Delivery) error)
 				defer cancel()
 				u := uuid.NewString()
 				rCtx := NewCtxFromContext(ctxWithDeadline, c.instance)
+				rCtx.Set(ctxKeyTraceID, u)
+				rCtx.Set(ctxKeyConsumerTag, co.Tag)
 				logging.NewContext(rCtx,
 					zap.String("trace_id", u),
 					zap.String("consumer_tag", co.Tag),
@@ -217,16 +223,35 @@ func (c *Consumer) Consume(handler func(ctx Ctx, delivery amqp.Delivery) error)
 						done <- true
 					}()
 					if e := c.handler(rCtx, delivery); e != nil {
-						log.Error(
-							"[RabbitMQ.Consumer] Occur a error while consuming a message. ",
-							zap.Error(e),
-							zap.Any("headers", delivery.Headers),
-							zap.ByteString(
-								"body",
-								delivery.Body,
-							),
-						)
-						if !co.AutoAck && co.AckByError {
+						if c.retry != nil && !co.AutoAck && co.AckByError {
+							c.handleFailure(rCtx, delivery, e)
+							return
+						}
+						delay, requeue := requeueDelay(e)
+						requeue = requeue && !co.AutoAck && co.AckByError
+						if !requeue {
+							log.Error(
+								"[RabbitMQ.Consumer] Occur a error while consuming a message. ",
+								zap.Error(e),
+								zap.Any("headers", delivery.Headers),
+								zap.ByteString(
+									"body",
+									delivery.Body,
+								),
+							)
+						}
+						if requeue {
+							// 消息暂时无法处理：持有消息至延迟结束后放回队列，不进入死信流程
+							log.Warn("[RabbitMQ.Consumer] 消息将稍后重新投递", zap.Duration("delay", delay), zap.Error(e))
+							time.AfterFunc(delay, func() {
+								if e := delivery.Nack(false, true); e != nil {
+									log.Error(
+										"NACK failed:",
+										zap.Error(errors.WithMessage(e, "[RabbitMQ.Consumer] Requeue Error")),
+									)
+								}
+							})
+						} else if !co.AutoAck && co.AckByError {
 							log.Debug("[RabbitMQ.Consumer] exec NACK")
 							if e = delivery.Nack(false, false); e != nil {
 								log.Error(
@@ -265,6 +290,92 @@ func (c *Consumer) Consume(handler func(ctx Ctx, delivery amqp.Delivery) error)
 	return nil
 }
 
+// handleFailure 按错误类别与重试策略处理失败的消息：受限流的消息稍后放回原队列，
+// 暂时性错误投递到延迟重试队列，永久错误或重试次数耗尽时投递死信桶，并在消息头中记录去向。
+func (c *Consumer) handleFailure(ctx Ctx, delivery amqp.Delivery, err error) {
+	log := logging.WithContext(ctx)
+	defer log.Sync()
+	p := c.retry
+	class := Classify(err)
+	attempts := attemptsOf(delivery.Headers)
+	if class != ClassRateLimited {
+		attempts++
+	}
+	route := p.route(class, attempts)
+	fields := []zap.Field{
+		zap.String("class", string(class)),
+		zap.String("route", string(route)),
+		zap.Int("attempts", attempts),
+		zap.Error(err),
+	}
+	if route == RouteRequeue {
+		// 消息暂时无法处理：持有消息至延迟结束后放回队列，不计入重试次数
+		delay, _ := requeueDelay(err)
+		log.Warn("[RabbitMQ.Consumer] 消息将稍后重新投递", append(fields, zap.Duration("delay", delay))...)
+		time.AfterFunc(delay, func() {
+			if e := delivery.Nack(false, true); e != nil {
+				log.Error("NACK failed:", zap.Error(errors.WithMessage(e, "[RabbitMQ.Consumer] Requeue Error")))
+			}
+		})
+		return
+	}
+	origin := DelayTarget{
+		Exchange:   c.session.Exchange.Name,
+		Queue:      c.session.Queue.Name,
+		RoutingKey: c.session.BindingOptions.RoutingKey,
+	}
+	msg := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		ContentType:  delivery.ContentType,
+		MessageId:    delivery.MessageId,
+		Timestamp:    delivery.Timestamp,
+		Headers:      failureHeaders(delivery.Headers, origin, attempts, class, route, err),
+		Body:         delivery.Body,
+	}
+	var e error
+	if route == RouteRetry {
+		delay := p.backoff(attempts)
+		log.Warn("[RabbitMQ.Consumer] 处理消息失败，将稍后重试", append(fields, zap.Duration("delay", delay))...)
+		e = c.instance.publishDelayed(ctx, origin, delay, p.jitter(delay), msg)
+	} else {
+		log.Error("[RabbitMQ.Consumer] 处理消息失败，投递死信桶",
+			append(fields, zap.Any("headers", delivery.Headers), zap.ByteString("body", delivery.Body))...)
+		e = c.publishDeadLetter(ctx, msg)
+	}
+	if e != nil {
+		// Broker 未确认重试或死信消息时保留原消息，稍后放回原队列重新处理，避免消息丢失
+		log.Error("[RabbitMQ.Consumer] 无法投递失败的消息，稍后放回原队列", zap.Duration("delay", publishFailureDelay), zap.Error(e))
+		time.AfterFunc(publishFailureDelay, func() {
+			if e := delivery.Nack(false, true); e != nil {
+				log.Error("NACK failed:", zap.Error(errors.WithMessage(e, "[RabbitMQ.Consumer] Requeue Error")))
+			}
+		})
+		return
+	}
+	if e = delivery.Ack(false); e != nil {
+		log.Error("ACK failed:", zap.Error(errors.WithMessage(e, "[RabbitMQ.Consumer] ACK Error")))
+	}
+}
+
+// publishDeadLetter 将消息头与消息体打包后投递到重试策略的死信桶，等待 Broker 确认
+func (c *Consumer) publishDeadLetter(ctx Ctx, msg amqp.Publishing) error {
+	target := c.retry.DeadLetter
+	if target.Exchange == "" {
+		return errors.New("[RabbitMQ.Consumer] 重试策略未设置死信桶")
+	}
+	body, err := DeadLetterBody(msg.Headers, msg.Body)
+	if err != nil {
+		return err
+	}
+	msg.Body = body
+	key := target.RoutingKey
+	if key == "" {
+		// 与 Ctx.GetProducer 的默认路由键一致
+		key = strings.Trim(target.Exchange+"."+target.Queue, ".")
+	}
+	return c.instance.PublishConfirmed(ctx, target.Exchange, key, msg)
+}
+
 // QOS controls how many messages the server will try to keep on the network for
 // consumers before receiving delivery acks.  The intent of Qos is to make sure
 // the network buffers stay full between the server and client.
@@ -7,6 +7,11 @@ import (
 	"strings"
 )
 
+const (
+	ctxKeyTraceID     = "trace_id"
+	ctxKeyConsumerTag = "consumer_tag"
+)
+
 type ctx struct {
 	context.Context
 	m        map[string]any
@@ -93,3 +98,22 @@ func (c *ctx) GetProducerWithOptions(options ProducerRegisterOptions) (*Producer
 func (c *ctx) GetProducerByUUID(uuid string) (*Producer, bool) {
 	return c.instance.GetProducer(uuid)
 }
+
+// TraceID 返回消息处理上下文中的 trace_id，非消费者上下文返回空字符串
+func TraceID(c context.Context) string {
+	return getString(c, ctxKeyTraceID)
+}
+
+// ConsumerTag 返回消息处理上下文中的消费者标签，非消费者上下文返回空字符串
+func ConsumerTag(c context.Context) string {
+	return getString(c, ctxKeyConsumerTag)
+}
+
+func getString(c context.Context, key string) string {
+	g, ok := c.(interface{ Get(key string) any })
+	if !ok {
+		return ""
+	}
+	v, _ := g.Get(key).(string)
+	return v
+}
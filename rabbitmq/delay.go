@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"context"
+	"github.com/cockroachdb/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RetryExchange 延迟重试队列所在的 headers 交换机，按 HeaderRetryQueue 将消息路由到对应的重试队列
+	RetryExchange = "notification_retry"
+	// DelayedExchange 启用延迟消息插件时使用的 x-delayed-message 交换机
+	DelayedExchange = "notification_delayed"
+	// HeaderRetryQueue 消息要进入的重试队列。headers 交换机匹配时忽略 x- 开头的消息头与绑定参数，因此不能使用 x- 前缀
+	HeaderRetryQueue = "retry-queue"
+	// legacyHeaderRetryQueue 旧版本使用的消息头，以它绑定的重试队列会收到所有重试消息，声明时需解除该绑定
+	legacyHeaderRetryQueue = "x-retry-queue"
+)
+
+// DelayTarget 延迟投递的目标，即消息最初所在的交换机与队列
+type DelayTarget struct {
+	Exchange   string
+	Queue      string // 启用延迟消息插件时，用于将原队列绑定到延迟交换机
+	RoutingKey string
+}
+
+// RetryQueueName 返回某交换机某一延迟的重试队列名称，例如 notification.retry.16s
+func RetryQueueName(exchange string, delay time.Duration) string {
+	return exchange + ".retry." + delay.String()
+}
+
+// retryQueueArgs 重试队列中的消息在 delay 后过期，经死信回到原交换机。
+// 不设置 x-dead-letter-routing-key，因此死信保留投递到重试交换机时的原路由键。
+func retryQueueArgs(exchange string, delay time.Duration) amqp.Table {
+	return amqp.Table{
+		"x-message-ttl":          delay.Milliseconds(),
+		"x-dead-letter-exchange": exchange,
+	}
+}
+
+// confirmTimeout 等待 Broker 确认发布的最长时间
+const confirmTimeout = 10 * time.Second
+
+// retryBindingArgs 重试队列绑定到重试交换机的参数，只接收 HeaderRetryQueue 为该队列的消息
+func retryBindingArgs(queue string) amqp.Table {
+	return amqp.Table{
+		"x-match":        "all",
+		HeaderRetryQueue: queue,
+	}
+}
+
+// legacyRetryBindingArgs 旧版本的绑定参数，匹配时只剩下 x-match，等同于接收所有消息
+func legacyRetryBindingArgs(queue string) amqp.Table {
+	return amqp.Table{
+		"x-match":              "all",
+		legacyHeaderRetryQueue: queue,
+	}
+}
+
+// delayer 延迟投递与死信投递共用的 Channel，处于发布确认模式，拓扑只在首次使用时声明
+type delayer struct {
+	mu       sync.Mutex
+	channel  *amqp.Channel
+	returns  chan amqp.Return // 无法路由的消息
+	declared map[string]bool
+}
+
+func (d *delayer) open(conn *amqp.Connection) (*amqp.Channel, error) {
+	if d.channel != nil && !d.channel.IsClosed() {
+		return d.channel, nil
+	}
+	if conn == nil {
+		return nil, errors.New("[RabbitMQ.Delay] connection is nil")
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "[RabbitMQ.Delay] Channel creation error")
+	}
+	if err = ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return nil, errors.Wrap(err, "[RabbitMQ.Delay] 无法开启发布确认")
+	}
+	d.channel = ch
+	d.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	d.declared = make(map[string]bool) // Channel 重建后重新声明，防止拓扑被删除
+	return ch, nil
+}
+
+// publish 发布消息并等待 Broker 确认，mandatory 为 true 时无法路由的消息视为发布失败。
+// 发布失败或等待超时时关闭 Channel，避免迟到的确认或退回被当作下一条消息的结果。调用方需持有 d.mu
+func (d *delayer) publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (err error) {
+	ch := d.channel
+	defer func() {
+		if err != nil {
+			_ = ch.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+	if err != nil {
+		return errors.Wrap(err, "[RabbitMQ.Delay] 无法发布消息")
+	}
+	ok, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "[RabbitMQ.Delay] 等待 Broker 确认失败")
+	}
+	if !ok {
+		return errors.Newf("[RabbitMQ.Delay] Broker 拒绝了消息（交换机 %s，路由键 %s）", exchange, key)
+	}
+	// 无法路由的消息会先于确认退回
+	select {
+	case r := <-d.returns:
+		return errors.Newf("[RabbitMQ.Delay] 消息无法路由：%s（交换机 %s，路由键 %s）", r.ReplyText, r.Exchange, r.RoutingKey)
+	default:
+		return nil
+	}
+}
+
+// PublishConfirmed 将消息发布到 exchange 并等待 Broker 确认，无法路由的消息视为发布失败。
+// 返回 nil 后才可以确认原消息
+func (r *Instance) PublishConfirmed(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	d := &r.delayer
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := d.open(r.RabbitMQ.Conn()); err != nil {
+		return err
+	}
+	return d.publish(ctx, exchange, key, true, msg)
+}
+
+// PublishDelayed 在 delay 之后将消息投递回 target，由 Broker 负责计时，调用方无需等待，进程重启也不会丢失。
+// 返回 nil 表示 Broker 已确认收到消息，此时才可以确认原消息。
+// 默认为每个（交换机，延迟）声明一个带 x-message-ttl 的重试队列，消息过期后经死信回到原交换机；
+// Config.DelayedExchange 为 true 时改用延迟消息插件，并将原队列绑定到延迟交换机。
+// 由于重试队列按延迟区分，应只使用有限的几种延迟。
+func (r *Instance) PublishDelayed(ctx context.Context, target DelayTarget, delay time.Duration, msg amqp.Publishing) error {
+	return r.publishDelayed(ctx, target, delay, delay, msg)
+}
+
+// publishDelayed 在 actual 之后投递消息，actual 不大于 delay，重试队列按 delay 声明，
+// 较短的 actual 通过消息的 expiration 实现（死信时 RabbitMQ 会移除该属性）。
+func (r *Instance) publishDelayed(ctx context.Context, target DelayTarget, delay, actual time.Duration, msg amqp.Publishing) error {
+	actual = min(actual, delay)
+	d := &r.delayer
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ch, err := d.open(r.RabbitMQ.Conn())
+	if err != nil {
+		return err
+	}
+	headers := make(amqp.Table, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	msg.Headers = headers
+
+	if r.RabbitMQ.config.DelayedExchange {
+		if err = d.declareDelayed(ch, target); err != nil {
+			return errors.Wrap(err, "[RabbitMQ.Delay] 无法声明延迟交换机")
+		}
+		msg.Headers["x-delay"] = actual.Milliseconds()
+		// 延迟消息插件在投递时才路由消息，不支持 mandatory
+		return d.publish(ctx, DelayedExchange, target.RoutingKey, false, msg)
+	}
+	queue := RetryQueueName(target.Exchange, delay)
+	if err = d.declareRetry(ch, target.Exchange, queue, delay); err != nil {
+		return errors.Wrapf(err, "[RabbitMQ.Delay] 无法声明重试队列：%s", queue)
+	}
+	msg.Headers[HeaderRetryQueue] = queue
+	if actual < delay {
+		msg.Expiration = strconv.FormatInt(actual.Milliseconds(), 10)
+	}
+	return d.publish(ctx, RetryExchange, target.RoutingKey, true, msg)
+}
+
+func (d *delayer) declareRetry(ch *amqp.Channel, exchange, queue string, delay time.Duration) error {
+	if d.declared[queue] {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(RetryExchange, amqp.ExchangeHeaders, true, false, false, false, nil); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, retryQueueArgs(exchange, delay)); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(queue, "", RetryExchange, false, retryBindingArgs(queue)); err != nil {
+		return err
+	}
+	// 解除旧版本的绑定，否则每条重试消息都会被复制到该队列；绑定不存在时 Broker 同样返回成功
+	if err := ch.QueueUnbind(queue, "", RetryExchange, legacyRetryBindingArgs(queue)); err != nil {
+		return err
+	}
+	d.declared[queue] = true
+	return nil
+}
+
+func (d *delayer) declareDelayed(ch *amqp.Channel, target DelayTarget) error {
+	key := DelayedExchange + "/" + target.Queue + "/" + target.RoutingKey
+	if d.declared[key] {
+		return nil
+	}
+	if err := ch.ExchangeDeclare(DelayedExchange, "x-delayed-message", true, false, false, false, amqp.Table{
+		"x-delayed-type": amqp.ExchangeDirect,
+	}); err != nil {
+		return err
+	}
+	if err := ch.QueueBind(target.Queue, target.RoutingKey, DelayedExchange, false, nil); err != nil {
+		return err
+	}
+	d.declared[key] = true
+	return nil
+}
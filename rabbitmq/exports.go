@@ -14,6 +14,7 @@ type Instance struct {
 	Consumers        ConsumerList
 	Producers        ProducerList
 	consumersOptions []ConsumerRegisterOptions // 用于批量注册
+	delayer          delayer                   // 延迟投递使用的 Channel 与已声明的拓扑
 	closed           chan bool
 	isClosed         bool
 	err              error
@@ -78,7 +79,9 @@ type ConsumerRegisterOptions struct {
 	Queue           Queue
 	BindingOptions  BindingOptions
 	ConsumerOptions ConsumerOptions
-	CallFunc        func(ctx Ctx, delivery amqp.Delivery) error
+	// Retry 处理失败时的重试策略，只在 AckByError 时生效；为 nil 时拒绝消息，交给队列的死信交换机处理
+	Retry    *RetryPolicy
+	CallFunc func(ctx Ctx, delivery amqp.Delivery) error
 }
 
 // RegisterConsumerConfig register a consumer config to queue
@@ -125,6 +128,7 @@ func (r *Instance) RegisterConsumer(options ConsumerRegisterOptions) error {
 	if err != nil {
 		return err
 	}
+	consumer.retry = options.Retry
 	err = consumer.Consume(options.CallFunc)
 	if err != nil {
 		return err
@@ -136,6 +140,26 @@ func (r *Instance) RegisterConsumer(options ConsumerRegisterOptions) error {
 	return nil
 }
 
+// QueueRegisterOptions is the options of declaring a queue without consumer
+type QueueRegisterOptions struct {
+	Exchange       Exchange
+	Queue          Queue
+	BindingOptions BindingOptions
+}
+
+// DeclareQueue declares the exchange and queue and binds them, for queues that have no consumer
+func (r *Instance) DeclareQueue(options QueueRegisterOptions) error {
+	if r.RabbitMQ.Conn() == nil {
+		return errors.New("[RabbitMQ] connection is nil")
+	}
+	channel, err := r.RabbitMQ.Conn().Channel()
+	if err != nil {
+		return errors.Wrap(err, "[RabbitMQ] get channel error")
+	}
+	defer channel.Close()
+	return declare(channel, options.Exchange, options.Queue, options.BindingOptions)
+}
+
 // ProducerRegisterOptions is the options of register producer
 type ProducerRegisterOptions struct {
 	Exchange          Exchange
@@ -0,0 +1,50 @@
+package rabbitmq
+
+import (
+	"github.com/cockroachdb/errors"
+	"time"
+)
+
+// MaxRequeueDelay 重新投递前持有消息的最长时间。
+// RabbitMQ 默认的 consumer_timeout 为 30 分钟，未确认的消息超过该时间会导致 Channel 被关闭，
+// 因此更长的等待会被拆分为多次重新投递。
+const MaxRequeueDelay = 10 * time.Minute
+
+// publishFailureDelay 重试或死信消息未被 Broker 确认时，放回原消息前等待的时间
+const publishFailureDelay = 5 * time.Second
+
+// requeuer 可由处理函数返回的错误实现，表示消息暂时无法处理，应在一段时间后重新投递，
+// 而不是作为失败消息进入死信流程（例如邮件驱动的每日额度已用完）。
+type requeuer interface {
+	RequeueAfter() time.Duration
+}
+
+type requeueError struct {
+	error
+	after time.Duration
+}
+
+func (e *requeueError) Unwrap() error {
+	return e.error
+}
+
+func (e *requeueError) RequeueAfter() time.Duration {
+	return e.after
+}
+
+// RequeueAfter 包装错误，使消费者在 after 之后重新投递消息
+func RequeueAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &requeueError{error: err, after: after}
+}
+
+// requeueDelay 返回错误要求的重新投递延迟
+func requeueDelay(err error) (time.Duration, bool) {
+	var r requeuer
+	if !errors.As(err, &r) {
+		return 0, false
+	}
+	return min(max(r.RequeueAfter(), 0), MaxRequeueDelay), true
+}
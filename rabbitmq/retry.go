@@ -0,0 +1,205 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"github.com/cockroachdb/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// ErrorClass 处理函数返回错误的类别，决定消息的去向
+type ErrorClass string
+
+const (
+	ClassTransient   ErrorClass = "transient"    // 暂时性错误，按重试策略延迟重试，未分类的错误均视为暂时性错误
+	ClassPermanent   ErrorClass = "permanent"    // 永久错误，例如消息格式错误，重试没有意义，直接投递死信桶
+	ClassRateLimited ErrorClass = "rate_limited" // 受限流，由 RequeueAfter 返回，稍后放回原队列且不计入重试次数
+)
+
+// Route 失败消息的去向
+type Route string
+
+const (
+	RouteRetry      Route = "retry"       // 投递到延迟重试队列
+	RouteDeadLetter Route = "dead_letter" // 投递到死信桶
+	RouteRequeue    Route = "requeue"     // 稍后放回原队列
+)
+
+const (
+	// HeaderAttempts 消息已处理失败的次数
+	HeaderAttempts = "x-attempts"
+	// HeaderErrorClass 最近一次失败的错误类别
+	HeaderErrorClass = "x-error-class"
+	// HeaderRoute 最近一次失败后消息的去向
+	HeaderRoute = "x-route"
+	// HeaderLastError 最近一次失败的错误信息
+	HeaderLastError = "x-last-error"
+	// HeaderOriginalExchange 消息最初所在的交换机
+	HeaderOriginalExchange = "x-original-exchange"
+	// HeaderOriginalQueue 消息最初所在的队列
+	HeaderOriginalQueue = "x-original-queue"
+	// HeaderOriginalRoutingKey 消息最初的路由键
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	// HeaderFailedAt 最近一次失败的时间
+	HeaderFailedAt = "x-failed-at"
+)
+
+// maxErrorHeaderLength 记录在消息头中的错误信息的最大长度
+const maxErrorHeaderLength = 1024
+
+type classError struct {
+	error
+	class ErrorClass
+}
+
+func (e *classError) Unwrap() error {
+	return e.error
+}
+
+// Permanent 将错误标记为永久错误，消息不会重试而是直接投递死信桶
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{error: err, class: ClassPermanent}
+}
+
+// Transient 将错误标记为暂时性错误，用于覆盖内部错误的类别
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classError{error: err, class: ClassTransient}
+}
+
+// Classify 返回错误的类别，最外层的 Permanent 或 Transient 标记优先
+func Classify(err error) ErrorClass {
+	var c *classError
+	if errors.As(err, &c) {
+		return c.class
+	}
+	if _, ok := requeueDelay(err); ok {
+		return ClassRateLimited
+	}
+	return ClassTransient
+}
+
+// RetryPolicy 消费者的重试策略。设置后失败的消息由消费者直接投递到延迟重试队列或死信桶，不再经由队列的死信交换机；
+// 只有投递失败时才会拒绝消息，交给死信交换机处理。
+type RetryPolicy struct {
+	MaxAttempts int           // 最多处理次数（含首次处理），小于 1 时按 1 处理
+	Backoff     time.Duration // 第一次重试前的等待时间
+	Multiplier  float64       // 每次重试等待时间的增长倍数，小于 1 时按 1 处理
+	MaxBackoff  time.Duration // 等待时间上限，0 表示不限制
+	// Jitter 随机抖动比例（0 ~ 1），实际等待时间在 [delay×(1-Jitter), delay] 内随机，避免大量消息同时重试。
+	// 重试队列仍按 delay 区分，因此抖动不会增加重试队列的数量。
+	Jitter     float64
+	DeadLetter DelayTarget // 永久错误或重试次数耗尽时投递的死信桶
+}
+
+// backoff 返回第 attempts 次失败后重试前的等待时间
+func (p *RetryPolicy) backoff(attempts int) time.Duration {
+	d := float64(p.Backoff) * math.Pow(max(p.Multiplier, 1), float64(max(attempts-1, 0)))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(d)
+}
+
+// jitter 在 [d×(1-Jitter), d] 内随机选取实际等待时间
+func (p *RetryPolicy) jitter(d time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return d
+	}
+	return d - time.Duration(rand.Float64()*min(p.Jitter, 1)*float64(d))
+}
+
+// route 返回第 attempts 次失败后消息的去向
+func (p *RetryPolicy) route(class ErrorClass, attempts int) Route {
+	switch {
+	case class == ClassRateLimited:
+		return RouteRequeue
+	case class == ClassPermanent, attempts >= p.MaxAttempts:
+		return RouteDeadLetter
+	default:
+		return RouteRetry
+	}
+}
+
+// attemptsOf 返回消息头中记录的失败次数
+func attemptsOf(headers amqp.Table) int {
+	switch v := headers[HeaderAttempts].(type) {
+	case int64:
+		return int(v)
+	case int32:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// failureHeaders 复制消息头，并记录消息的来源、失败次数、错误类别、去向与错误信息
+func failureHeaders(headers amqp.Table, origin DelayTarget, attempts int, class ErrorClass, route Route, err error) amqp.Table {
+	h := make(amqp.Table, len(headers)+8)
+	for k, v := range headers {
+		h[k] = v
+	}
+	msg := err.Error()
+	if len(msg) > maxErrorHeaderLength {
+		msg = strings.ToValidUTF8(msg[:maxErrorHeaderLength], "")
+	}
+	h[HeaderOriginalExchange] = origin.Exchange
+	h[HeaderOriginalQueue] = origin.Queue
+	h[HeaderOriginalRoutingKey] = origin.RoutingKey
+	h[HeaderFailedAt] = time.Now().Truncate(time.Second) // AMQP 的时间戳精确到秒
+	h[HeaderAttempts] = int64(attempts)
+	h[HeaderErrorClass] = string(class)
+	h[HeaderRoute] = string(route)
+	h[HeaderLastError] = msg
+	return h
+}
+
+// DeadLetter 死信桶中的消息体，包含原消息头与原消息体
+type DeadLetter struct {
+	Header map[string]interface{} `json:"header"`
+	Body   string                 `json:"body"`
+}
+
+// DeadLetterBody 返回投递到死信桶的消息体
+func DeadLetterBody(headers amqp.Table, body []byte) ([]byte, error) {
+	return json.Marshal(&DeadLetter{Header: headers, Body: string(body)})
+}
+
+// ParseDeadLetter 解析死信桶中的消息体
+func ParseDeadLetter(data []byte) (*DeadLetter, error) {
+	d := &DeadLetter{}
+	if err := json.Unmarshal(data, d); err != nil {
+		return nil, errors.Wrap(err, "无法解析死信")
+	}
+	return d, nil
+}
+
+// retryHeaders 重试与死信流程写入的消息头，重新投递时需要移除
+var retryHeaders = []string{
+	"x-death", "x-first-death-exchange", "x-first-death-queue", "x-first-death-reason",
+	"x-last-death-exchange", "x-last-death-queue", "x-last-death-reason",
+	"x-delay", HeaderRetryQueue, legacyHeaderRetryQueue, HeaderAttempts, HeaderErrorClass, HeaderRoute, HeaderLastError,
+	HeaderOriginalExchange, HeaderOriginalQueue, HeaderOriginalRoutingKey, HeaderFailedAt,
+}
+
+// ResetRetryHeaders 返回移除了重试计数与死信记录的消息头副本，用于将死信作为新消息重新投递
+func ResetRetryHeaders(headers amqp.Table) amqp.Table {
+	h := make(amqp.Table, len(headers))
+	for k, v := range headers {
+		h[k] = v
+	}
+	for _, k := range retryHeaders {
+		delete(h, k)
+	}
+	return h
+}
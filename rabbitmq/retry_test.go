@@ -0,0 +1,98 @@
+package rabbitmq
+
+import (
+	"github.com/cockroachdb/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	err := errors.New("boom")
+	assert.Equal(t, ClassTransient, Classify(err))
+	assert.Equal(t, ClassPermanent, Classify(Permanent(err)))
+	assert.Equal(t, ClassPermanent, Classify(errors.Wrap(Permanent(err), "解析消息失败")))
+	assert.Equal(t, ClassRateLimited, Classify(RequeueAfter(err, time.Minute)))
+	assert.Equal(t, ClassTransient, Classify(Transient(Permanent(err))))
+	assert.Nil(t, Permanent(nil))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, Backoff: 4 * time.Second, Multiplier: 4, MaxBackoff: time.Minute}
+	assert.Equal(t, 4*time.Second, p.backoff(1))
+	assert.Equal(t, 16*time.Second, p.backoff(2))
+	assert.Equal(t, time.Minute, p.backoff(3))
+
+	assert.Equal(t, RouteRetry, p.route(ClassTransient, 2))
+	assert.Equal(t, RouteDeadLetter, p.route(ClassTransient, 3))
+	assert.Equal(t, RouteDeadLetter, p.route(ClassPermanent, 1))
+	assert.Equal(t, RouteRequeue, p.route(ClassRateLimited, 5))
+
+	assert.Equal(t, 16*time.Second, p.jitter(16*time.Second))
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.jitter(16 * time.Second)
+		assert.True(t, d >= 8*time.Second && d <= 16*time.Second, d)
+	}
+}
+
+func TestFailureHeaders(t *testing.T) {
+	original := amqp.Table{"foo": "bar", HeaderAttempts: int64(2)}
+	assert.Equal(t, 2, attemptsOf(original))
+	origin := DelayTarget{Exchange: "notification", Queue: "hitokoto_appended", RoutingKey: "notification.hitokoto_appended"}
+	h := failureHeaders(original, origin, 3, ClassPermanent, RouteDeadLetter, errors.New(strings.Repeat("错", 1000)))
+	assert.Equal(t, "bar", h["foo"])
+	assert.Equal(t, "hitokoto_appended", h[HeaderOriginalQueue])
+	assert.Equal(t, "notification.hitokoto_appended", h[HeaderOriginalRoutingKey])
+	assert.Equal(t, int64(3), h[HeaderAttempts])
+	assert.Equal(t, "permanent", h[HeaderErrorClass])
+	assert.Equal(t, "dead_letter", h[HeaderRoute])
+	assert.LessOrEqual(t, len(h[HeaderLastError].(string)), maxErrorHeaderLength)
+	assert.Equal(t, int64(2), original[HeaderAttempts], "原消息头不应被修改")
+}
+
+func TestDeadLetterBody(t *testing.T) {
+	body, err := DeadLetterBody(amqp.Table{HeaderRoute: "dead_letter"}, []byte(`{"uuid":"1"}`))
+	assert.NoError(t, err)
+	d, err := ParseDeadLetter(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "dead_letter", d.Header[HeaderRoute])
+	assert.Equal(t, `{"uuid":"1"}`, d.Body)
+	_, err = ParseDeadLetter([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestResetRetryHeaders(t *testing.T) {
+	h := ResetRetryHeaders(amqp.Table{
+		"x-death":              []interface{}{amqp.Table{"count": int64(5)}},
+		HeaderAttempts:         int64(6),
+		HeaderRoute:            "dead_letter",
+		HeaderRetryQueue:       "notification.retry.4s",
+		legacyHeaderRetryQueue: "notification.retry.4s",
+		"trace":                "keep",
+	})
+	assert.Equal(t, amqp.Table{"trace": "keep"}, h)
+}
+
+// headersMatch 按 headers 交换机 x-match: all 的规则判断消息头是否匹配绑定参数，x- 开头的绑定参数不参与匹配
+func headersMatch(binding, headers amqp.Table) bool {
+	for k, v := range binding {
+		if strings.HasPrefix(k, "x-") {
+			continue
+		}
+		if headers[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRetryBindingArgs(t *testing.T) {
+	short, long := RetryQueueName("notification", 4*time.Second), RetryQueueName("notification", 16*time.Second)
+	headers := amqp.Table{HeaderRetryQueue: short}
+	assert.True(t, headersMatch(retryBindingArgs(short), headers))
+	assert.False(t, headersMatch(retryBindingArgs(long), headers), "重试消息只应路由到消息头指定的重试队列")
+	assert.True(t, headersMatch(legacyRetryBindingArgs(long), headers), "旧版本的绑定会匹配所有消息，需在声明时解除")
+}
@@ -9,6 +9,8 @@ type Config struct {
 	Username string
 	Password string
 	Vhost    string
+	// DelayedExchange 使用 rabbitmq_delayed_message_exchange 插件实现延迟投递，为 false 时使用带 TTL 的重试队列
+	DelayedExchange bool
 }
 
 // URI convert config to amqp uri
@@ -0,0 +1,143 @@
+// Package storage 提供 worker 与 CLI 共用的内嵌数据库（bbolt）。
+//
+// bbolt 通过文件锁保证同一时间只有一个进程打开数据库（只读打开之间可以共享），因此数据库只在事务期间打开：
+// 进程内并发的事务共用同一个句柄，最后一个事务结束后立即关闭并释放文件锁。
+// 这样 CLI 可以在 worker 运行期间使用，双方都只需等待对方当前的事务结束，最长等待 storage.lock_timeout。
+package storage
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/hitokoto-osc/notification-worker/config"
+	bolt "go.etcd.io/bbolt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	mu   sync.Mutex
+	idle = sync.NewCond(&mu) // 所有事务结束时广播
+	path string              // 为空时使用配置中的路径
+	db   *bolt.DB            // 进程内正在进行的事务共用的句柄
+	refs int                 // 正在使用 db 的事务数
+
+	writers int // 等待只读句柄关闭的写入事务数
+)
+
+// SetPath 指定数据库路径，覆盖配置，主要用于测试
+func SetPath(p string) {
+	mu.Lock()
+	defer mu.Unlock()
+	path = p
+}
+
+func dbPath() string {
+	if path != "" {
+		return path
+	}
+	return config.Storage().Path()
+}
+
+// Open 以读写方式打开一次数据库后立即关闭，worker 启动时调用，以便在启动阶段发现路径或权限问题
+func Open() error {
+	d, err := acquire(true)
+	if err != nil {
+		return err
+	}
+	release(d)
+	return nil
+}
+
+// Close 等待进程内的事务结束，退出前调用。数据库在事务结束后已经关闭，这里只保证不再有事务持有文件锁
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	for refs > 0 {
+		idle.Wait()
+	}
+	return nil
+}
+
+// acquire 返回共用的句柄并增加引用计数，需要写入而当前句柄为只读时，等待只读事务结束后以读写方式重新打开
+func acquire(write bool) (*bolt.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if write {
+		writers++
+		for db != nil && db.IsReadOnly() {
+			idle.Wait()
+		}
+		writers--
+		defer idle.Broadcast() // 唤醒等待该写入的只读事务，使其共用读写句柄或在打开失败后自行打开
+	} else {
+		// 有写入在等待只读句柄关闭时，新的只读事务也需等待，避免写入一直无法进行
+		for writers > 0 && (db == nil || db.IsReadOnly()) {
+			idle.Wait()
+		}
+	}
+	if db == nil {
+		d, err := open(write)
+		if err != nil {
+			return nil, err
+		}
+		db = d
+	}
+	refs++
+	return db, nil
+}
+
+// release 减少引用计数，最后一个事务结束时关闭数据库并释放文件锁
+func release(d *bolt.DB) {
+	mu.Lock()
+	defer mu.Unlock()
+	refs--
+	if refs > 0 {
+		return
+	}
+	_ = d.Close()
+	db = nil
+	idle.Broadcast()
+}
+
+func open(write bool) (*bolt.DB, error) {
+	p := dbPath()
+	if write {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return nil, errors.Wrap(err, "无法创建数据库目录")
+		}
+	}
+	d, err := bolt.Open(p, 0o600, &bolt.Options{
+		Timeout:  config.Storage().LockTimeout(),
+		ReadOnly: !write,
+	})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, errors.Wrapf(err, "无法打开数据库：%s 正被其他进程长时间占用", p)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "无法打开数据库：%s", p)
+	}
+	return d, nil
+}
+
+// Update 在读写事务中执行 fn
+func Update(fn func(tx *bolt.Tx) error) error {
+	d, err := acquire(true)
+	if err != nil {
+		return err
+	}
+	defer release(d)
+	return d.Update(fn)
+}
+
+// View 在只读事务中执行 fn，数据库文件不存在时视为空数据库，fn 不会被调用
+func View(fn func(tx *bolt.Tx) error) error {
+	if _, err := os.Stat(dbPath()); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	d, err := acquire(false)
+	if err != nil {
+		return err
+	}
+	defer release(d)
+	return d.View(fn)
+}
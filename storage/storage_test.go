@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReleaseLockAfterTransaction(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "notification.db")
+	SetPath(p)
+	t.Cleanup(func() { SetPath("") })
+
+	called := false
+	require.NoError(t, View(func(tx *bolt.Tx) error {
+		called = true
+		return nil
+	}))
+	assert.False(t, called, "数据库不存在时不应调用 fn")
+
+	require.NoError(t, Open())
+	require.NoError(t, Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte("test"))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("k"), []byte("v"))
+	}))
+	assert.Nil(t, db, "事务结束后应关闭数据库")
+
+	// 模拟 worker 运行期间使用 CLI：另一个句柄可以立即取得文件锁
+	other, err := bolt.Open(p, 0o600, &bolt.Options{Timeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, other.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, []byte("v"), tx.Bucket([]byte("test")).Get([]byte("k")))
+		return nil
+	}))
+	require.NoError(t, other.Close())
+	require.NoError(t, Close())
+}
+
+func TestConcurrentTransactionsShareHandle(t *testing.T) {
+	SetPath(filepath.Join(t.TempDir(), "notification.db"))
+	t.Cleanup(func() { SetPath("") })
+	require.NoError(t, Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte("test"))
+		return err
+	}))
+
+	// 只读事务进行中时，写入等待其结束后以读写方式重新打开
+	done := make(chan error)
+	require.NoError(t, View(func(tx *bolt.Tx) error {
+		first := db
+		assert.True(t, first.IsReadOnly())
+		require.NoError(t, View(func(tx *bolt.Tx) error {
+			assert.Same(t, first, db, "并发的事务应共用同一个句柄")
+			return nil
+		}))
+		go func() {
+			done <- Update(func(tx *bolt.Tx) error {
+				assert.False(t, db.IsReadOnly(), "写入时应以读写方式打开")
+				return tx.Bucket([]byte("test")).Put([]byte("k"), []byte("v"))
+			})
+		}()
+		return nil
+	}))
+	require.NoError(t, <-done)
+	require.NoError(t, View(func(tx *bolt.Tx) error {
+		assert.Equal(t, []byte("v"), tx.Bucket([]byte("test")).Get([]byte("k")))
+		return nil
+	}))
+}